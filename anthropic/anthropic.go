@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -30,6 +31,7 @@ type Model struct {
 	effort              Effort
 	customPayloadValues map[string]any
 	betaFeatures        []string
+	serverTools         []ServerTool
 	httpClient          *http.Client
 
 	// Vertex AI fields
@@ -151,6 +153,12 @@ func (m *Model) SetHTTPClient(client *http.Client) {
 	m.httpClient = client
 }
 
+// SupportsPrefill reports whether a trailing assistant message is continued
+// rather than answered, which the API doesn't allow with extended thinking.
+func (m *Model) SupportsPrefill() bool {
+	return m.maxThinkingTokens <= 0 && !m.adaptiveThinking
+}
+
 type schemaContainerKind uint8
 
 const (
@@ -280,20 +288,19 @@ func schemaTypeIncludesObject(raw any) bool {
 	return false
 }
 
-func (m *Model) Generate(
-	ctx context.Context,
+// buildPayload converts a request to the body of a Messages API request,
+// without the stream flag.
+func (m *Model) buildPayload(
 	systemPrompt content.Content,
 	messages []llms.Message,
 	toolbox *tools.Toolbox,
 	jsonOutputSchema *tools.ValueSchema,
-) llms.ProviderStream {
-	debugger := llms.GetDebugger(ctx)
-
+) (map[string]any, error) {
 	var apiMessages []message
 	for _, msg := range messages {
 		apiMessage, err := messageFromLLM(msg)
 		if err != nil {
-			return &Stream{err: fmt.Errorf("anthropic: failed to convert message role=%s: %w", msg.Role, err)}
+			return nil, fmt.Errorf("anthropic: failed to convert message role=%s: %w", msg.Role, err)
 		}
 		apiMessages = append(apiMessages, apiMessage)
 	}
@@ -307,7 +314,6 @@ func (m *Model) Generate(
 
 	payload := map[string]any{
 		"messages":   apiMessages,
-		"stream":     true,
 		"max_tokens": maxTokens,
 	}
 
@@ -318,8 +324,8 @@ func (m *Model) Generate(
 		// Vertex AI requires beta features as a body parameter rather than
 		// an HTTP header. Sending them as headers causes 400 errors for
 		// certain betas (e.g. context-1m-2025-08-07).
-		if len(m.betaFeatures) > 0 {
-			payload["anthropic_beta"] = m.betaFeatures
+		if betas := m.betas(); len(betas) > 0 {
+			payload["anthropic_beta"] = betas
 		}
 	} else {
 		payload["model"] = m.model
@@ -328,7 +334,7 @@ func (m *Model) Generate(
 	if systemPrompt != nil {
 		apiSystemPrompt, err := contentFromLLM(systemPrompt)
 		if err != nil {
-			return &Stream{err: fmt.Errorf("anthropic: failed to convert system prompt: %w", err)}
+			return nil, fmt.Errorf("anthropic: failed to convert system prompt: %w", err)
 		}
 		payload["system"] = apiSystemPrompt
 	}
@@ -338,7 +344,7 @@ func (m *Model) Generate(
 	if jsonOutputSchema != nil {
 		schema, err := normalizeOutputSchemaForAnthropic(jsonOutputSchema)
 		if err != nil {
-			return &Stream{err: fmt.Errorf("anthropic: failed to normalize JSON output schema: %w", err)}
+			return nil, fmt.Errorf("anthropic: failed to normalize JSON output schema: %w", err)
 		}
 		outputConfig["format"] = map[string]any{
 			"type":   "json_schema",
@@ -350,7 +356,7 @@ func (m *Model) Generate(
 		// Build full tool list first.
 		allTools, err := toolsFromToolbox(toolbox)
 		if err != nil {
-			return &Stream{err: err}
+			return nil, err
 		}
 		choice := toolbox.Choice
 
@@ -381,7 +387,7 @@ func (m *Model) Generate(
 					}
 				}
 				if len(filtered) == 0 {
-					return &Stream{err: fmt.Errorf("anthropic: no allowed tools found in toolbox")}
+					return nil, fmt.Errorf("anthropic: no allowed tools found in toolbox")
 				}
 				allTools = filtered
 				toolChoice = ToolChoice{Type: "auto"}
@@ -402,7 +408,7 @@ func (m *Model) Generate(
 					}
 				}
 				if !exists {
-					return &Stream{err: fmt.Errorf("anthropic: required tool %q not found in toolbox", name)}
+					return nil, fmt.Errorf("anthropic: required tool %q not found in toolbox", name)
 				}
 				toolChoice = ToolChoice{Type: "tool", Name: name}
 				// Note: No need to filter here; forcing a specific tool is supported by Anthropic.
@@ -420,7 +426,7 @@ func (m *Model) Generate(
 					}
 				}
 				if len(filtered) == 0 {
-					return &Stream{err: fmt.Errorf("anthropic: none of the required tools are present in toolbox")}
+					return nil, fmt.Errorf("anthropic: none of the required tools are present in toolbox")
 				}
 				allTools = filtered
 				toolChoice = ToolChoice{Type: "any"}
@@ -430,8 +436,10 @@ func (m *Model) Generate(
 			toolChoice = ToolChoice{Type: "auto"}
 		}
 
-		payload["tools"] = allTools
+		payload["tools"] = m.toolsPayload(allTools)
 		payload["tool_choice"] = toolChoice
+	} else if len(m.serverTools) > 0 {
+		payload["tools"] = m.toolsPayload(nil)
 	}
 
 	if m.adaptiveThinking {
@@ -465,6 +473,24 @@ func (m *Model) Generate(
 		payload["output_config"] = outputConfig
 	}
 
+	return payload, nil
+}
+
+func (m *Model) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []llms.Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) llms.ProviderStream {
+	debugger := llms.GetDebugger(ctx)
+
+	payload, err := m.buildPayload(systemPrompt, messages, toolbox, jsonOutputSchema)
+	if err != nil {
+		return &Stream{err: err}
+	}
+	payload["stream"] = true
+
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return &Stream{err: fmt.Errorf("error encoding JSON: %w", err)}
@@ -474,17 +500,78 @@ func (m *Model) Generate(
 		debugger.RawRequest(m.endpoint, jsonData)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", m.endpoint, bytes.NewReader(jsonData))
+	resp, err := m.do(ctx, "POST", m.endpoint, jsonData)
+	if err != nil {
+		return &Stream{err: err}
+	}
+
+	return &Stream{ctx: ctx, model: m.model, stream: resp.Body, debugger: debugger}
+}
+
+// CountTokens counts the input tokens of a request with the token counting
+// endpoint. The request is converted like Generate converts it, so the count
+// includes the server tools and any thinking settings.
+func (m *Model) CountTokens(ctx context.Context, systemPrompt content.Content, messages []llms.Message, toolbox *tools.Toolbox) (int, error) {
+	payload, err := m.buildPayload(systemPrompt, messages, toolbox, nil)
+	if err != nil {
+		return 0, err
+	}
+	// The endpoint doesn't take the output limit, and custom values are
+	// usually generation settings it doesn't take either.
+	delete(payload, "max_tokens")
+	for k := range m.customPayloadValues {
+		delete(payload, k)
+	}
+
+	endpoint := m.endpoint + "/count_tokens"
+	if m.vertexAI {
+		// Vertex AI has a single endpoint for all models, which takes the
+		// model in the body.
+		endpoint = strings.Replace(m.endpoint, "/models/"+m.model+":streamRawPredict", "/models/count-tokens:rawPredict", 1)
+		payload["model"] = m.model
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding JSON: %w", err)
+	}
+	if debugger := llms.GetDebugger(ctx); debugger != nil {
+		debugger.RawRequest(endpoint, jsonData)
+	}
+	resp, err := m.do(ctx, "POST", endpoint, jsonData)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("error decoding token count: %w", err)
+	}
+	return result.InputTokens, nil
+}
+
+// do sends a request to the API, returning an error for any response but
+// 200 OK.
+func (m *Model) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
-		return &Stream{err: fmt.Errorf("error creating request: %w", err)}
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	if m.vertexAI {
 		// Vertex AI uses OAuth2 Bearer tokens instead of API keys.
 		token, err := m.tokenSource.Token()
 		if err != nil {
-			return &Stream{err: fmt.Errorf("anthropic: failed to get OAuth2 token: %w", err)}
+			return nil, fmt.Errorf("anthropic: failed to get OAuth2 token: %w", err)
 		}
 		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	} else {
@@ -496,7 +583,7 @@ func (m *Model) Generate(
 	// For Vertex AI, betas are already included in the request body as
 	// anthropic_beta, so we only add them as headers for direct Anthropic.
 	if !m.vertexAI {
-		for _, beta := range m.betaFeatures {
+		for _, beta := range m.betas() {
 			req.Header.Add("anthropic-beta", beta)
 		}
 	}
@@ -507,7 +594,7 @@ func (m *Model) Generate(
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return &Stream{err: fmt.Errorf("error making request: %w", err)}
+		return nil, fmt.Errorf("error making request: %w", err)
 	}
 	if resp.StatusCode != http.StatusOK {
 		defer resp.Body.Close()
@@ -522,24 +609,26 @@ func (m *Model) Generate(
 			}
 			if jsonErr := json.Unmarshal(bodyBytes, &anthropicErr); jsonErr == nil && anthropicErr.Type == "error" {
 				// Successfully parsed the Anthropic error format
-				return &Stream{err: &llms.HTTPError{
+				return nil, &llms.HTTPError{
 					StatusCode: resp.StatusCode,
 					Status:     resp.Status,
+					RetryAfter: llms.ParseRetryAfter(resp.Header),
 					ErrorType:  anthropicErr.Error.Type,
 					Message:    anthropicErr.Error.Message,
-				}}
+				}
 			}
 			// Body read okay, but JSON parsing failed or structure mismatch.
 			// Fall through to return status only.
 		}
 		// Default fallback: Read error, empty body, or failed/unexpected JSON parse.
-		return &Stream{err: &llms.HTTPError{
+		return nil, &llms.HTTPError{
 			StatusCode: resp.StatusCode,
 			Status:     resp.Status,
-		}}
+			RetryAfter: llms.ParseRetryAfter(resp.Header),
+		}
 	}
 
-	return &Stream{ctx: ctx, model: m.model, stream: resp.Body, debugger: debugger}
+	return resp, nil
 }
 
 type Stream struct {
@@ -552,7 +641,28 @@ type Stream struct {
 	lastThought *content.Thought
 	debugger    llms.Debugger
 
+	// Citations of the current text block, which span the whole block and so
+	// are only complete once it stops.
+	textBlockStart   int
+	pendingCitations []content.Citation
+	lastCitation     content.Citation
+
+	// Server tool calls by ID, and the server_tool_use block being streamed.
+	serverToolCalls   map[string]*serverToolCall
+	currentServerTool *serverToolCall
+	lastSearch        llms.SearchActivity
+
 	cachedInputTokens, cacheCreationInputTokens, inputTokens, outputTokens int
+	longCacheCreationInputTokens, webSearchRequests, codeExecutions        int
+}
+
+var _ llms.StopReasoner = (*Stream)(nil)
+
+// serverToolCall is a server_tool_use block of the response.
+type serverToolCall struct {
+	item  *content.ServerTool
+	block contentBlock
+	input []byte
 }
 
 func (s *Stream) Err() error {
@@ -580,6 +690,16 @@ func (s *Stream) Thought() content.Thought {
 	return content.Thought{}
 }
 
+// Citation returns the citation of the last StreamStatusCitation.
+func (s *Stream) Citation() content.Citation {
+	return s.lastCitation
+}
+
+// Search returns the web search most recently surfaced via StreamStatusSearch.
+func (s *Stream) Search() llms.SearchActivity {
+	return s.lastSearch
+}
+
 func (s *Stream) ToolCall() llms.ToolCall {
 	if len(s.message.ToolCalls) == 0 {
 		return llms.ToolCall{}
@@ -587,12 +707,54 @@ func (s *Stream) ToolCall() llms.ToolCall {
 	return s.message.ToolCalls[len(s.message.ToolCalls)-1]
 }
 
+// StopReason returns why the model stopped, once the stream is done.
+func (s *Stream) StopReason() llms.StopReason {
+	return s.message.StopReason
+}
+
+// stopReason normalizes an Anthropic stop_reason.
+func stopReason(reason string) llms.StopReason {
+	switch reason {
+	case "end_turn":
+		return llms.StopReasonEndTurn
+	case "tool_use":
+		return llms.StopReasonToolUse
+	case "max_tokens", "model_context_window_exceeded":
+		return llms.StopReasonMaxTokens
+	case "stop_sequence":
+		return llms.StopReasonStopSequence
+	case "refusal":
+		return llms.StopReasonRefusal
+	case "pause_turn":
+		return llms.StopReasonPauseTurn
+	default:
+		return llms.StopReasonOther
+	}
+}
+
+// stopReasonError returns the error for a stop reason that means the response
+// is unusable or incomplete, or nil for a normal stop.
+func stopReasonError(reason string) error {
+	switch r := stopReason(reason); r {
+	case llms.StopReasonEndTurn, llms.StopReasonToolUse, llms.StopReasonStopSequence, llms.StopReasonRefusal, llms.StopReasonPauseTurn:
+		return nil
+	case llms.StopReasonMaxTokens:
+		return fmt.Errorf("%w (stop_reason=%q)", llms.ErrOutputTruncated, reason)
+	default:
+		return &llms.StopReasonError{Reason: r, ProviderReason: reason}
+	}
+}
+
 func (s *Stream) Usage() llms.Usage {
 	return llms.Usage{
 		CachedInputTokens:        s.cachedInputTokens,
 		CacheCreationInputTokens: s.cacheCreationInputTokens,
 		InputTokens:              s.inputTokens,
 		OutputTokens:             s.outputTokens,
+
+		LongCacheCreationInputTokens: s.longCacheCreationInputTokens,
+		WebSearchRequests:            s.webSearchRequests,
+		CodeExecutionRequests:        s.codeExecutions,
 	}
 }
 
@@ -600,6 +762,7 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 	reader := bufio.NewReader(s.stream)
 	return func(yield func(llms.StreamStatus) bool) {
 		defer io.Copy(io.Discard, s.stream)
+		defer s.dropUnfinishedServerToolCall()
 		lastToolCallIndex := -1
 		var resetNextArgumentsDelta bool
 		// Track content block types by index so we can signal when a thinking block ends
@@ -680,6 +843,12 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 					if u.CacheCreationInputTokens != nil {
 						s.cacheCreationInputTokens = *u.CacheCreationInputTokens
 					}
+					if u.CacheCreation != nil {
+						s.longCacheCreationInputTokens = u.CacheCreation.Ephemeral1hInputTokens
+					}
+					if u.ServerToolUse != nil {
+						s.webSearchRequests = u.ServerToolUse.WebSearchRequests
+					}
 					if u.InputTokens != nil {
 						s.inputTokens = *u.InputTokens
 					}
@@ -692,6 +861,9 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 				// Record content block type so we can detect when it stops later.
 				contentBlockTypeByIndex[event.Index] = event.ContentBlock.Type
 				switch event.ContentBlock.Type {
+				case "text":
+					s.textBlockStart = s.message.Content.TextLen()
+					s.pendingCitations = nil
 				case "tool_use":
 					lastToolCallIndex = event.Index
 					resetNextArgumentsDelta = true
@@ -715,6 +887,18 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 					if !yield(llms.StreamStatusThinking) {
 						return
 					}
+				case "server_tool_use":
+					block := *event.ContentBlock
+					item := &content.ServerTool{ID: block.ID, Name: block.Name}
+					if s.serverToolCalls == nil {
+						s.serverToolCalls = map[string]*serverToolCall{}
+					}
+					s.currentServerTool = &serverToolCall{item: item, block: block}
+					s.serverToolCalls[block.ID] = s.currentServerTool
+					s.message.Content = append(s.message.Content, item)
+					if isCodeExecution(block.Name) {
+						s.codeExecutions++
+					}
 				case "redacted_thinking":
 					if event.ContentBlock.Data != "" {
 						thought := &content.Thought{
@@ -728,6 +912,12 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 					if !yield(llms.StreamStatusThinking) {
 						return
 					}
+				default:
+					if isServerToolResult(event.ContentBlock.Type) {
+						if !s.addServerToolResult(*event.ContentBlock, yield) {
+							return
+						}
+					}
 				}
 			case "content_block_delta":
 				switch event.Delta.Type {
@@ -738,10 +928,18 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 					if !yield(llms.StreamStatusText) {
 						return
 					}
+				case "citations_delta":
+					if event.Delta.Citation != nil {
+						s.pendingCitations = append(s.pendingCitations, event.Delta.Citation.toLLM())
+					}
 				case "input_json_delta":
 					if event.Delta.PartialJSON == "" {
 						continue
 					}
+					if contentBlockTypeByIndex[event.Index] == "server_tool_use" && s.currentServerTool != nil {
+						s.currentServerTool.input = append(s.currentServerTool.input, event.Delta.PartialJSON...)
+						continue
+					}
 					index := len(s.message.ToolCalls) - 1
 					if resetNextArgumentsDelta {
 						s.message.ToolCalls[index].Arguments = json.RawMessage(event.Delta.PartialJSON)
@@ -785,6 +983,24 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 							return
 						}
 					}
+					if blockType == "server_tool_use" {
+						if err := s.finishServerToolCall(); err != nil {
+							s.err = err
+							return
+						}
+					}
+					if blockType == "text" {
+						end := s.message.Content.TextLen()
+						for _, citation := range s.pendingCitations {
+							citation.Start, citation.End = s.textBlockStart, end
+							s.message.Content.AddCitation(citation)
+							s.lastCitation = citation
+							if !yield(llms.StreamStatusCitation) {
+								return
+							}
+						}
+						s.pendingCitations = nil
+					}
 					delete(contentBlockTypeByIndex, event.Index)
 				}
 			case "message_delta":
@@ -798,6 +1014,12 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 					if u.CacheCreationInputTokens != nil {
 						s.cacheCreationInputTokens = *u.CacheCreationInputTokens
 					}
+					if u.CacheCreation != nil {
+						s.longCacheCreationInputTokens = u.CacheCreation.Ephemeral1hInputTokens
+					}
+					if u.ServerToolUse != nil {
+						s.webSearchRequests = u.ServerToolUse.WebSearchRequests
+					}
 					if u.InputTokens != nil {
 						s.inputTokens = *u.InputTokens
 					}
@@ -806,15 +1028,12 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 					}
 				}
 				// Check stop reason
-				if event.Delta.StopReason != "" &&
-					event.Delta.StopReason != "tool_use" &&
-					event.Delta.StopReason != "end_turn" {
-					if event.Delta.StopReason == "max_tokens" {
-						s.err = fmt.Errorf("%w (stop_reason=%q)", llms.ErrOutputTruncated, event.Delta.StopReason)
-					} else {
-						s.err = fmt.Errorf("unexpected stop reason: %q", event.Delta.StopReason)
+				if reason := event.Delta.StopReason; reason != "" {
+					s.message.StopReason = stopReason(reason)
+					if err := stopReasonError(reason); err != nil {
+						s.err = err
+						return
 					}
-					return
 				}
 			case "message_stop":
 				// End of the message stream
@@ -825,7 +1044,15 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 			case "error":
 				// Handle error events
 				if event.Error != nil {
-					s.err = fmt.Errorf("API error: %s - %s", event.Error.Type, event.Error.Message)
+					// Errors sent mid-stream (e.g. "overloaded_error") have the
+					// same shape as the body of an error response, so surface them
+					// as an HTTPError too. There's no status code, but the error
+					// type is enough to tell whether a retry could help.
+					s.err = &llms.HTTPError{
+						Status:    "API error",
+						ErrorType: event.Error.Type,
+						Message:   event.Error.Message,
+					}
 					return
 				}
 			default:
@@ -891,6 +1118,17 @@ func contentFromLLM(llmContent content.Content) (contentList, error) {
 					URL:  v.URL,
 				}
 			}
+		case *content.Document:
+			src, err := documentSource(v)
+			if err != nil {
+				return nil, err
+			}
+			ci.Type = "document"
+			ci.Source = src
+			ci.Title = v.Title
+			if v.Citations {
+				ci.Citations = &citationsConfig{Enabled: true}
+			}
 		case *content.JSON:
 			ci.Type = "text"
 			ci.Text = string(v.Data)
@@ -903,6 +1141,15 @@ func contentFromLLM(llmContent content.Content) (contentList, error) {
 				ci.Thinking = v.Text
 				ci.Signature = v.Signature
 			}
+		case *content.ServerTool:
+			// Server tool calls and their results are sent back as they were
+			// received, since results carry encrypted content that the model
+			// needs to see them again. A block that never arrived in full
+			// can't be sent back.
+			if len(v.Data) == 0 {
+				continue
+			}
+			ci.raw = v.Data
 		case *content.CacheHint:
 			// Add cache control to the previous content item.
 			if i := len(cl) - 1; i >= 0 {
@@ -924,6 +1171,29 @@ func contentFromLLM(llmContent content.Content) (contentList, error) {
 	return cl, nil
 }
 
+// documentSource returns the source of a document block. Plain text is sent
+// as text, since the API only accepts base64 data for PDFs.
+func documentSource(doc *content.Document) (*source, error) {
+	mimeType, data, isDataURI := content.ParseDataURI(doc.URL)
+	if !isDataURI {
+		if strings.HasPrefix(doc.URL, "data:") {
+			return nil, fmt.Errorf("unsupported data URI format %q", doc.URL)
+		}
+		return &source{Type: "url", URL: doc.URL}, nil
+	}
+	if doc.MimeType != "" {
+		mimeType = doc.MimeType
+	}
+	if mimeType != "text/plain" {
+		return &source{Type: "base64", MediaType: mimeType, Data: data}, nil
+	}
+	text, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 in text document: %w", err)
+	}
+	return &source{Type: "text", MediaType: mimeType, Data: string(text)}, nil
+}
+
 func messageFromLLM(m llms.Message) (message, error) {
 	apiContent, err := contentFromLLM(m.Content)
 	if err != nil {
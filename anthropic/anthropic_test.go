@@ -403,6 +403,9 @@ func TestAnthropicStreamHandling(t *testing.T) {
 		require.Error(t, stream.Err(), "Stream iteration should have resulted in an error")
 		assert.Contains(t, stream.Err().Error(), errMsg, "Error message should contain the API error message")
 		assert.Contains(t, stream.Err().Error(), errType, "Error message should contain the API error type")
+		var httpErr *llms.HTTPError
+		require.ErrorAs(t, stream.Err(), &httpErr, "Error events should surface as an HTTPError")
+		assert.Equal(t, errType, httpErr.ErrorType)
 		// Note: Depending on exactly when the error is detected vs yielded, statuses might be non-empty.
 		// Let's check it *doesn't* contain statuses *after* the point the error should occur.
 		// An error event should immediately stop processing and prevent further yields.
@@ -452,6 +455,67 @@ func TestAnthropicStreamHandling(t *testing.T) {
 		// Should have yielded the text status *before* hitting the error
 		assert.Equal(t, []llms.StreamStatus{llms.StreamStatusText}, yieldedStatuses, "Should yield status for valid events before error")
 	})
+
+	t.Run("Usage Breakdown", func(t *testing.T) {
+		var streamContent strings.Builder
+		streamContent.WriteString(sseEvent(streamEvent{
+			Type: "message_start",
+			Message: &messageEvent{
+				Role: "assistant",
+				Usage: &usage{
+					InputTokens:              numPtr(5),
+					CacheCreationInputTokens: numPtr(300),
+					CacheCreation:            &cacheCreation{Ephemeral5mInputTokens: 100, Ephemeral1hInputTokens: 200},
+					OutputTokens:             numPtr(1),
+				},
+			},
+		}))
+		streamContent.WriteString(sseEvent(streamEvent{
+			Type:  "message_delta",
+			Usage: &usage{OutputTokens: numPtr(20), ServerToolUse: &serverToolUse{WebSearchRequests: 2}},
+		}))
+		streamContent.WriteString(sseEvent(streamEvent{Type: "message_stop"}))
+
+		stream := newTestAnthropicStream(context.Background(), "claude-3-haiku", streamContent.String())
+		stream.Iter()(func(status llms.StreamStatus) bool { return true })
+		require.NoError(t, stream.Err())
+
+		usage := stream.Usage()
+		assert.Equal(t, 300, usage.CacheCreationInputTokens)
+		assert.Equal(t, 200, usage.LongCacheCreationInputTokens)
+		assert.Equal(t, 20, usage.OutputTokens)
+		assert.Equal(t, 2, usage.WebSearchRequests)
+	})
+
+	t.Run("Stop Reasons", func(t *testing.T) {
+		for _, tc := range []struct {
+			reason string
+			want   llms.StopReason
+			err    error
+		}{
+			{"end_turn", llms.StopReasonEndTurn, nil},
+			{"stop_sequence", llms.StopReasonStopSequence, nil},
+			{"pause_turn", llms.StopReasonPauseTurn, nil},
+			{"max_tokens", llms.StopReasonMaxTokens, llms.ErrOutputTruncated},
+			{"refusal", llms.StopReasonRefusal, nil},
+			{"something_new", llms.StopReasonOther, llms.ErrUnexpectedStopReason},
+		} {
+			var streamContent strings.Builder
+			streamContent.WriteString(sseEvent(streamEvent{Type: "message_start", Message: &messageEvent{Role: "assistant"}}))
+			streamContent.WriteString(sseEvent(streamEvent{Type: "message_delta", Delta: delta{StopReason: tc.reason}}))
+			streamContent.WriteString(sseEvent(streamEvent{Type: "message_stop"}))
+
+			stream := newTestAnthropicStream(context.Background(), "claude-3-haiku", streamContent.String())
+			stream.Iter()(func(status llms.StreamStatus) bool { return true })
+			if tc.err == nil {
+				assert.NoError(t, stream.Err(), tc.reason)
+			} else {
+				assert.ErrorIs(t, stream.Err(), tc.err, tc.reason)
+			}
+			assert.Equal(t, tc.want, stream.StopReason(), tc.reason)
+			assert.Equal(t, tc.want, stream.Message().StopReason, tc.reason)
+		}
+	})
 }
 
 // TestAnthropicRedactedThinkingRoundTrip pins the redacted_thinking "data" blob
@@ -516,6 +580,25 @@ func TestContentFromLLMEdgeCases(t *testing.T) {
 		assert.Equal(t, jsonValue, apiContent[0].Text, "JSON content should be converted to text")
 	})
 
+	t.Run("Document Content", func(t *testing.T) {
+		llmContent := content.Content{
+			&content.Document{URL: "data:application/pdf;base64,JVBERi0=", Title: "Report", Citations: true},
+			&content.Document{URL: "https://example.com/paper.pdf"},
+			&content.Document{URL: "data:text/plain;base64,SGVsbG8=", MimeType: "text/plain"},
+		}
+		apiContent, err := contentFromLLM(llmContent)
+		require.NoError(t, err)
+		require.Len(t, apiContent, 3)
+
+		data, err := json.Marshal(apiContent)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[
+			{"type":"document","title":"Report","citations":{"enabled":true},"source":{"type":"base64","media_type":"application/pdf","data":"JVBERi0="}},
+			{"type":"document","source":{"type":"url","url":"https://example.com/paper.pdf"}},
+			{"type":"document","source":{"type":"text","media_type":"text/plain","data":"Hello"}}
+		]`, string(data))
+	})
+
 	// Add more edge cases for contentFromLLM if needed (e.g., invalid image data URI)
 }
 
@@ -777,6 +860,60 @@ func TestAnthropic_ThinkingPayload(t *testing.T) {
 	})
 }
 
+func TestAnthropicStream_Citations(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","role":"assistant"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"According to the report, "}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":"","citations":[]}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"citations_delta","citation":{"type":"page_location","cited_text":"Revenue grew 20%.","document_index":1,"document_title":"Report","start_page_number":3,"end_page_number":4}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"revenue grew 20%"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"}}`,
+		`{"type":"message_stop"}`,
+	}
+	var sse strings.Builder
+	for _, event := range events {
+		sse.WriteString("data: " + event + "\n\n")
+	}
+	stream := newTestAnthropicStream(context.Background(), "claude-sonnet-4-6", sse.String())
+
+	var citations []content.Citation
+	for status := range stream.Iter() {
+		if status == llms.StreamStatusCitation {
+			citations = append(citations, stream.Citation())
+		}
+	}
+	require.NoError(t, stream.Err())
+
+	want := content.Citation{
+		Start:         25,
+		End:           41,
+		Source:        "document",
+		DocumentIndex: 1,
+		Title:         "Report",
+		CitedText:     "Revenue grew 20%.",
+		Metadata: map[string]string{
+			"anthropic:type":              "page_location",
+			"anthropic:start_page_number": "3",
+			"anthropic:end_page_number":   "4",
+		},
+	}
+	assert.Equal(t, []content.Citation{want}, citations)
+	require.Len(t, stream.Message().Content, 1)
+	text := stream.Message().Content[0].(*content.Text)
+	assert.Equal(t, "revenue grew 20%", text.Text[want.Start:want.End])
+	assert.Equal(t, []content.Citation{want}, text.Citations)
+}
+
+func TestAnthropic_SupportsPrefill(t *testing.T) {
+	var _ llms.PrefillProvider = (*Model)(nil)
+	assert.True(t, New("key", "claude-sonnet-4-6").SupportsPrefill())
+	assert.False(t, New("key", "claude-sonnet-4-6").WithThinking(2048).SupportsPrefill())
+	assert.False(t, New("key", "claude-opus-4-7").WithAdaptiveThinking().SupportsPrefill())
+}
+
 func TestAnthropic_ToolChoice_Mapping(t *testing.T) {
 	// Build toolbox with two tools
 	weatherSchema := tools.FunctionSchema{Name: "get_weather", Description: "Weather", Parameters: tools.ValueSchema{Type: "object"}}
@@ -881,3 +1018,33 @@ func TestGenerate_UnsupportedToolGrammarReturnsStreamError(t *testing.T) {
 	require.Error(t, stream.Err())
 	assert.Contains(t, stream.Err().Error(), "unsupported tool grammar type tools.TextGrammar")
 }
+
+func TestAnthropic_CountTokens(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages/count_tokens", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"input_tokens":42}`))
+	}))
+	defer server.Close()
+
+	weatherSchema := tools.FunctionSchema{Name: "get_weather", Description: "Weather", Parameters: tools.ValueSchema{Type: "object"}}
+	toolbox := tools.Box(tools.External("Weather", &weatherSchema, func(r tools.Runner, params json.RawMessage) tools.Result {
+		return tools.SuccessFromString("ok")
+	}))
+
+	model := New("test-key", "claude-sonnet-4-6").WithEndpoint(server.URL+"/v1/messages", "Test")
+	count, err := llms.CountTokens(context.Background(), model, content.FromText("Be brief."), []llms.Message{
+		{Role: "user", Content: content.FromText("Weather in Paris?")},
+	}, toolbox)
+	require.NoError(t, err)
+	assert.Equal(t, 42, count)
+
+	// The request is the one Generate would make, without generation settings.
+	assert.Equal(t, "claude-sonnet-4-6", body["model"])
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "Be brief."}}, body["system"])
+	assert.Len(t, body["tools"], 1)
+	assert.NotContains(t, body, "max_tokens")
+	assert.NotContains(t, body, "stream")
+}
@@ -0,0 +1,334 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+var (
+	// ErrBatchRequestCanceled is the error of a batch request that was
+	// canceled before it was processed.
+	ErrBatchRequestCanceled = errors.New("anthropic: batch request canceled")
+	// ErrBatchRequestExpired is the error of a batch request that wasn't
+	// processed before the batch expired.
+	ErrBatchRequestExpired = errors.New("anthropic: batch request expired")
+)
+
+// BatchRequest is a request of a message batch, with the same inputs as
+// Model.Generate.
+type BatchRequest struct {
+	// CustomID identifies the request in the results, which may be in any
+	// order.
+	CustomID         string
+	SystemPrompt     content.Content
+	Messages         []llms.Message
+	Toolbox          *tools.Toolbox
+	JSONOutputSchema *tools.ValueSchema
+}
+
+// Batch is the state of a message batch.
+type Batch struct {
+	ID string `json:"id"`
+	// ProcessingStatus is "in_progress", "canceling" or "ended".
+	ProcessingStatus  string             `json:"processing_status"`
+	RequestCounts     BatchRequestCounts `json:"request_counts"`
+	CreatedAt         time.Time          `json:"created_at"`
+	ExpiresAt         time.Time          `json:"expires_at"`
+	EndedAt           *time.Time         `json:"ended_at"`
+	CancelInitiatedAt *time.Time         `json:"cancel_initiated_at"`
+	// ResultsURL is where the results are downloaded from once the batch has
+	// ended.
+	ResultsURL string `json:"results_url"`
+}
+
+// Ended reports whether the batch is done processing, so that its results
+// are available.
+func (b *Batch) Ended() bool {
+	return b.ProcessingStatus == "ended"
+}
+
+// BatchRequestCounts counts the requests of a batch by their state.
+type BatchRequestCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+// BatchResult is the result of a request of a message batch.
+type BatchResult struct {
+	CustomID string
+	// Type is "succeeded", "errored", "canceled" or "expired".
+	Type string
+	// Message and Usage are the response, if the request succeeded.
+	Message llms.Message
+	Usage   llms.Usage
+	// Err is why the request failed, or why the response stopped early, like
+	// the stream of Model.Generate would report it.
+	Err error
+}
+
+// Batches is a client for the Message Batches API, which processes requests
+// asynchronously at half the price. Requests are converted the same way
+// Model.Generate converts them, using the settings of the model.
+type Batches struct {
+	model        *Model
+	pollInterval time.Duration
+}
+
+// Batches returns a client for message batches that uses the model and its
+// settings. Batches aren't available on Vertex AI.
+func (m *Model) Batches() *Batches {
+	return &Batches{model: m, pollInterval: 30 * time.Second}
+}
+
+// WithPollInterval sets how often Wait checks whether a batch has ended.
+func (b *Batches) WithPollInterval(interval time.Duration) *Batches {
+	b.pollInterval = interval
+	return b
+}
+
+// Create submits a batch of requests.
+func (b *Batches) Create(ctx context.Context, requests []BatchRequest) (*Batch, error) {
+	type batchItem struct {
+		CustomID string         `json:"custom_id"`
+		Params   map[string]any `json:"params"`
+	}
+	items := make([]batchItem, 0, len(requests))
+	for _, r := range requests {
+		params, err := b.model.buildPayload(r.SystemPrompt, r.Messages, r.Toolbox, r.JSONOutputSchema)
+		if err != nil {
+			return nil, fmt.Errorf("batch request %q: %w", r.CustomID, err)
+		}
+		items = append(items, batchItem{CustomID: r.CustomID, Params: params})
+	}
+	jsonData, err := json.Marshal(map[string]any{"requests": items})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding JSON: %w", err)
+	}
+	if debugger := llms.GetDebugger(ctx); debugger != nil {
+		debugger.RawRequest(b.endpoint(), jsonData)
+	}
+	return b.send(ctx, "POST", b.endpoint(), jsonData)
+}
+
+// Get returns the current state of a batch.
+func (b *Batches) Get(ctx context.Context, id string) (*Batch, error) {
+	return b.send(ctx, "GET", b.endpoint()+"/"+url.PathEscape(id), nil)
+}
+
+// Cancel cancels the requests of a batch that haven't been processed yet.
+// The batch is "canceling" until the requests being processed are done.
+func (b *Batches) Cancel(ctx context.Context, id string) (*Batch, error) {
+	return b.send(ctx, "POST", b.endpoint()+"/"+url.PathEscape(id)+"/cancel", nil)
+}
+
+// Wait polls a batch until it has ended, or the context is done.
+func (b *Batches) Wait(ctx context.Context, id string) (*Batch, error) {
+	for {
+		batch, err := b.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if batch.Ended() {
+			return batch, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(b.pollInterval):
+		}
+	}
+}
+
+// Results downloads the results of an ended batch, yielding them as they're
+// read. An error that ends the download is yielded last, with an empty
+// result; the errors of individual requests are in their results instead.
+func (b *Batches) Results(ctx context.Context, batch *Batch) iter.Seq2[BatchResult, error] {
+	return func(yield func(BatchResult, error) bool) {
+		if b.model.vertexAI {
+			yield(BatchResult{}, errBatchesVertexAI)
+			return
+		}
+		if !batch.Ended() {
+			yield(BatchResult{}, fmt.Errorf("anthropic: batch %s hasn't ended", batch.ID))
+			return
+		}
+		resultsURL := batch.ResultsURL
+		if resultsURL == "" {
+			resultsURL = b.endpoint() + "/" + url.PathEscape(batch.ID) + "/results"
+		}
+		resp, err := b.model.do(ctx, "GET", resultsURL, nil)
+		if err != nil {
+			yield(BatchResult{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		// Each line is a JSON object, and may be very long.
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				result, parseErr := batchResultFromJSON(line)
+				if parseErr != nil {
+					yield(BatchResult{}, parseErr)
+					return
+				}
+				if !yield(result, nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(BatchResult{}, fmt.Errorf("error reading batch results: %w", err))
+				return
+			}
+		}
+	}
+}
+
+var errBatchesVertexAI = errors.New("anthropic: message batches aren't supported on Vertex AI")
+
+func (b *Batches) endpoint() string {
+	return strings.TrimSuffix(b.model.endpoint, "/") + "/batches"
+}
+
+// send makes a request that responds with a batch.
+func (b *Batches) send(ctx context.Context, method, requestURL string, body []byte) (*Batch, error) {
+	if b.model.vertexAI {
+		return nil, errBatchesVertexAI
+	}
+	resp, err := b.model.do(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var batch Batch
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return nil, fmt.Errorf("error decoding batch: %w", err)
+	}
+	return &batch, nil
+}
+
+// batchResultFromJSON parses a line of the results of a batch.
+func batchResultFromJSON(line []byte) (BatchResult, error) {
+	var raw struct {
+		CustomID string `json:"custom_id"`
+		Result   struct {
+			Type    string           `json:"type"`
+			Message *messageResponse `json:"message"`
+			Error   *struct {
+				Error errorInfo `json:"error"`
+			} `json:"error"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return BatchResult{}, fmt.Errorf("error decoding batch result: %w", err)
+	}
+	result := BatchResult{CustomID: raw.CustomID, Type: raw.Result.Type}
+	switch raw.Result.Type {
+	case "succeeded":
+		if raw.Result.Message == nil {
+			return BatchResult{}, fmt.Errorf("anthropic: batch result %q has no message", raw.CustomID)
+		}
+		result.Message, result.Usage = raw.Result.Message.toLLM()
+		if reason := raw.Result.Message.StopReason; reason != "" {
+			result.Err = stopReasonError(reason)
+		}
+	case "errored":
+		httpErr := &llms.HTTPError{Status: "API error"}
+		if raw.Result.Error != nil {
+			httpErr.ErrorType = raw.Result.Error.Error.Type
+			httpErr.Message = raw.Result.Error.Error.Message
+		}
+		result.Err = httpErr
+	case "canceled":
+		result.Err = ErrBatchRequestCanceled
+	case "expired":
+		result.Err = ErrBatchRequestExpired
+	default:
+		result.Err = fmt.Errorf("anthropic: unknown batch result type %q", raw.Result.Type)
+	}
+	return result, nil
+}
+
+// toLLM converts a complete response to a message, with the same content the
+// stream of Model.Generate would have built.
+func (r *messageResponse) toLLM() (llms.Message, llms.Usage) {
+	msg := llms.Message{ID: r.ID, Role: r.Role, StopReason: stopReason(r.StopReason)}
+	serverToolNames := map[string]string{}
+	codeExecutions := 0
+	for _, block := range r.Content {
+		switch block.Type {
+		case "text":
+			start := msg.Content.TextLen()
+			msg.Content.Append(block.Text)
+			for _, c := range block.Citations {
+				citation := c.toLLM()
+				citation.Start, citation.End = start, msg.Content.TextLen()
+				msg.Content.AddCitation(citation)
+			}
+		case "thinking":
+			msg.Content = append(msg.Content, &content.Thought{Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			if block.Data != "" {
+				msg.Content = append(msg.Content, &content.Thought{Text: "(Redacted)", Encrypted: block.Data, Summary: true})
+			}
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, llms.ToolCall{ID: block.ID, Name: block.Name, Arguments: block.Input})
+		case "server_tool_use":
+			serverToolNames[block.ID] = block.Name
+			if isCodeExecution(block.Name) {
+				codeExecutions++
+			}
+			msg.Content = append(msg.Content, &content.ServerTool{ID: block.ID, Name: block.Name, Data: block.raw})
+		default:
+			if isServerToolResult(block.Type) {
+				msg.Content = append(msg.Content, &content.ServerTool{
+					ID:     block.ToolUseID,
+					Name:   serverToolNames[block.ToolUseID],
+					Result: true,
+					Data:   block.raw,
+				})
+			}
+		}
+	}
+
+	u := llms.Usage{CodeExecutionRequests: codeExecutions}
+	if r.Usage.InputTokens != nil {
+		u.InputTokens = *r.Usage.InputTokens
+	}
+	if r.Usage.OutputTokens != nil {
+		u.OutputTokens = *r.Usage.OutputTokens
+	}
+	if r.Usage.CacheReadInputTokens != nil {
+		u.CachedInputTokens = *r.Usage.CacheReadInputTokens
+	}
+	if r.Usage.CacheCreationInputTokens != nil {
+		u.CacheCreationInputTokens = *r.Usage.CacheCreationInputTokens
+	}
+	if r.Usage.CacheCreation != nil {
+		u.LongCacheCreationInputTokens = r.Usage.CacheCreation.Ephemeral1hInputTokens
+	}
+	if r.Usage.ServerToolUse != nil {
+		u.WebSearchRequests = r.Usage.ServerToolUse.WebSearchRequests
+	}
+	return msg, u
+}
@@ -0,0 +1,154 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+func TestBatches(t *testing.T) {
+	var created map[string]any
+	var polls atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.Header.Get("X-API-Key"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/messages/batches":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			_, _ = w.Write([]byte(`{"id":"msgbatch_1","type":"message_batch","processing_status":"in_progress","request_counts":{"processing":3},"created_at":"2026-10-16T00:00:00Z","expires_at":"2026-10-17T00:00:00Z"}`))
+		case "GET /v1/messages/batches/msgbatch_1":
+			if polls.Add(1) < 2 {
+				_, _ = w.Write([]byte(`{"id":"msgbatch_1","processing_status":"in_progress","request_counts":{"processing":3}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"id":"msgbatch_1","processing_status":"ended","request_counts":{"succeeded":1,"errored":1,"expired":1},"ended_at":"2026-10-16T01:00:00Z","results_url":"` + server.URL + `/v1/messages/batches/msgbatch_1/results"}`))
+		case "GET /v1/messages/batches/msgbatch_1/results":
+			w.Header().Set("Content-Type", "application/binary")
+			_, _ = w.Write([]byte(`{"custom_id":"weather","result":{"type":"succeeded","message":{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"Let me check."},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],"stop_reason":"tool_use","usage":{"input_tokens":50,"output_tokens":20,"cache_read_input_tokens":10}}}}
+{"custom_id":"bad","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: Field required"}}}}
+{"custom_id":"late","result":{"type":"expired"}}
+`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	weatherSchema := tools.FunctionSchema{Name: "get_weather", Description: "Weather", Parameters: tools.ValueSchema{Type: "object"}}
+	toolbox := tools.Box(tools.External("Weather", &weatherSchema, func(r tools.Runner, params json.RawMessage) tools.Result {
+		return tools.SuccessFromString("ok")
+	}))
+
+	model := New("test-key", "claude-sonnet-4-6").WithEndpoint(server.URL+"/v1/messages", "Test")
+	batches := model.Batches().WithPollInterval(time.Millisecond)
+	ctx := context.Background()
+
+	batch, err := batches.Create(ctx, []BatchRequest{
+		{CustomID: "weather", SystemPrompt: content.FromText("Be brief."), Messages: []llms.Message{{Role: "user", Content: content.FromText("Weather in Paris?")}}, Toolbox: toolbox},
+		{CustomID: "bad", Messages: []llms.Message{{Role: "user", Content: content.FromText("Hi")}}},
+		{CustomID: "late", Messages: []llms.Message{{Role: "user", Content: content.FromText("Hi")}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "msgbatch_1", batch.ID)
+	assert.False(t, batch.Ended())
+	assert.Equal(t, 3, batch.RequestCounts.Processing)
+
+	// Requests are converted like Generate converts them, without streaming.
+	requests := created["requests"].([]any)
+	require.Len(t, requests, 3)
+	first := requests[0].(map[string]any)
+	assert.Equal(t, "weather", first["custom_id"])
+	params := first["params"].(map[string]any)
+	assert.Equal(t, "claude-sonnet-4-6", params["model"])
+	assert.Equal(t, float64(1024), params["max_tokens"])
+	assert.NotContains(t, params, "stream")
+	assert.Equal(t, []any{map[string]any{"type": "text", "text": "Be brief."}}, params["system"])
+	assert.Equal(t, map[string]any{"type": "auto"}, params["tool_choice"])
+
+	batch, err = batches.Wait(ctx, batch.ID)
+	require.NoError(t, err)
+	assert.True(t, batch.Ended())
+	assert.Equal(t, BatchRequestCounts{Succeeded: 1, Errored: 1, Expired: 1}, batch.RequestCounts)
+
+	var results []BatchResult
+	for result, err := range batches.Results(ctx, batch) {
+		require.NoError(t, err)
+		results = append(results, result)
+	}
+	require.Len(t, results, 3)
+
+	assert.Equal(t, "weather", results[0].CustomID)
+	assert.Equal(t, "succeeded", results[0].Type)
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "msg_1", results[0].Message.ID)
+	assert.Equal(t, llms.StopReasonToolUse, results[0].Message.StopReason)
+	assert.Equal(t, content.FromText("Let me check."), results[0].Message.Content)
+	require.Len(t, results[0].Message.ToolCalls, 1)
+	assert.Equal(t, "get_weather", results[0].Message.ToolCalls[0].Name)
+	assert.JSONEq(t, `{"city":"Paris"}`, string(results[0].Message.ToolCalls[0].Arguments))
+	assert.Equal(t, llms.Usage{InputTokens: 50, OutputTokens: 20, CachedInputTokens: 10}, results[0].Usage)
+
+	var httpErr *llms.HTTPError
+	require.ErrorAs(t, results[1].Err, &httpErr)
+	assert.Equal(t, "invalid_request_error", httpErr.ErrorType)
+	assert.Equal(t, "max_tokens: Field required", httpErr.Message)
+
+	assert.ErrorIs(t, results[2].Err, ErrBatchRequestExpired)
+}
+
+func TestBatches_CancelAndWaitContext(t *testing.T) {
+	var canceled atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/messages/batches/msgbatch_1/cancel":
+			canceled.Store(true)
+			_, _ = w.Write([]byte(`{"id":"msgbatch_1","processing_status":"canceling","cancel_initiated_at":"2026-10-16T00:30:00Z"}`))
+		case "GET /v1/messages/batches/msgbatch_1":
+			_, _ = w.Write([]byte(`{"id":"msgbatch_1","processing_status":"in_progress"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"not_found_error","message":"Not found"}}`))
+		}
+	}))
+	defer server.Close()
+
+	batches := New("test-key", "claude-sonnet-4-6").WithEndpoint(server.URL+"/v1/messages", "Test").Batches().WithPollInterval(time.Millisecond)
+
+	batch, err := batches.Cancel(context.Background(), "msgbatch_1")
+	require.NoError(t, err)
+	assert.True(t, canceled.Load())
+	assert.Equal(t, "canceling", batch.ProcessingStatus)
+	require.NotNil(t, batch.CancelInitiatedAt)
+
+	// Waiting stops when the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = batches.Wait(ctx, "msgbatch_1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// API errors are returned as HTTP errors.
+	_, err = batches.Get(context.Background(), "msgbatch_2")
+	var httpErr *llms.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+	assert.Equal(t, "not_found_error", httpErr.ErrorType)
+
+	// Results are only available once the batch has ended.
+	for _, err := range batches.Results(context.Background(), batch) {
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,255 @@
+package anthropic
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+)
+
+// ServerTool is a tool that Anthropic runs on its servers, such as web search.
+// The model calls it on its own, and both the call and its result are part of
+// the response, so there's nothing for the caller to execute.
+type ServerTool interface {
+	serverTool()
+}
+
+// WithServerTool makes a server tool available to the model, alongside the
+// tools of the toolbox. Any beta the tool needs is added to the request.
+func (m *Model) WithServerTool(tool ServerTool) *Model {
+	m.serverTools = append(m.serverTools, tool)
+	return m
+}
+
+// WebSearchTool lets the model search the web. Results are cited in the text
+// that draws on them.
+type WebSearchTool struct {
+	Type           string        `json:"type"` // Defaults to "web_search_20250305"
+	Name           string        `json:"name"` // Defaults to "web_search"
+	MaxUses        int           `json:"max_uses,omitempty"`
+	AllowedDomains []string      `json:"allowed_domains,omitempty"`
+	BlockedDomains []string      `json:"blocked_domains,omitempty"`
+	UserLocation   *UserLocation `json:"user_location,omitempty"`
+}
+
+func (WebSearchTool) serverTool() {}
+
+func (t WebSearchTool) MarshalJSON() ([]byte, error) {
+	type plain WebSearchTool
+	t.Type = cmp.Or(t.Type, "web_search_20250305")
+	t.Name = cmp.Or(t.Name, "web_search")
+	return json.Marshal(plain(t))
+}
+
+// UserLocation localizes web search results
+type UserLocation struct {
+	Type     string `json:"type"` // "approximate"
+	City     string `json:"city,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// WebFetchTool lets the model fetch the contents of web pages and PDFs whose
+// URLs appear in the conversation.
+type WebFetchTool struct {
+	Type             string   `json:"type"` // Defaults to "web_fetch_20250910"
+	Name             string   `json:"name"` // Defaults to "web_fetch"
+	MaxUses          int      `json:"max_uses,omitempty"`
+	AllowedDomains   []string `json:"allowed_domains,omitempty"`
+	BlockedDomains   []string `json:"blocked_domains,omitempty"`
+	MaxContentTokens int      `json:"max_content_tokens,omitempty"`
+	// Citations asks the model to cite the fetched documents.
+	Citations bool `json:"-"`
+}
+
+func (WebFetchTool) serverTool() {}
+
+func (t WebFetchTool) MarshalJSON() ([]byte, error) {
+	type plain WebFetchTool
+	t.Type = cmp.Or(t.Type, "web_fetch_20250910")
+	t.Name = cmp.Or(t.Name, "web_fetch")
+	out := struct {
+		plain
+		Citations *citationsConfig `json:"citations,omitempty"`
+	}{plain: plain(t)}
+	if t.Citations {
+		out.Citations = &citationsConfig{Enabled: true}
+	}
+	return json.Marshal(out)
+}
+
+// CodeExecutionTool lets the model run Bash commands and edit files in a
+// sandboxed container.
+type CodeExecutionTool struct {
+	Type string `json:"type"` // Defaults to "code_execution_20250825"
+	Name string `json:"name"` // Defaults to "code_execution"
+}
+
+func (CodeExecutionTool) serverTool() {}
+
+func (t CodeExecutionTool) MarshalJSON() ([]byte, error) {
+	type plain CodeExecutionTool
+	t.Type = cmp.Or(t.Type, "code_execution_20250825")
+	t.Name = cmp.Or(t.Name, "code_execution")
+	return json.Marshal(plain(t))
+}
+
+// RawServerTool is a ServerTool whose JSON body is provided verbatim by the
+// caller, for server tools without a dedicated type. Body must include the
+// tool's "type" and "name", and any beta it needs must be added with WithBeta.
+type RawServerTool struct {
+	Body any
+}
+
+func (RawServerTool) serverTool() {}
+
+func (t RawServerTool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Body)
+}
+
+// serverToolBeta returns the beta feature a server tool needs, if any.
+func serverToolBeta(tool ServerTool) string {
+	switch t := tool.(type) {
+	case WebFetchTool:
+		if t.Type == "" || t.Type == "web_fetch_20250910" {
+			return "web-fetch-2025-09-10"
+		}
+	case CodeExecutionTool:
+		switch t.Type {
+		case "", "code_execution_20250825":
+			return "code-execution-2025-08-25"
+		case "code_execution_20250522":
+			return "code-execution-2025-05-22"
+		}
+	}
+	return ""
+}
+
+// betas returns the beta features to send, including those the server tools
+// need.
+func (m *Model) betas() []string {
+	betas := m.betaFeatures
+	for _, tool := range m.serverTools {
+		beta := serverToolBeta(tool)
+		if beta == "" || slices.Contains(betas, beta) {
+			continue
+		}
+		betas = append(betas[:len(betas):len(betas)], beta)
+	}
+	return betas
+}
+
+// toolsPayload returns the tools array of the request: the client tools,
+// followed by the server tools.
+func (m *Model) toolsPayload(clientTools []Tool) []any {
+	toolsArr := make([]any, 0, len(clientTools)+len(m.serverTools))
+	for _, t := range clientTools {
+		toolsArr = append(toolsArr, t)
+	}
+	for _, t := range m.serverTools {
+		toolsArr = append(toolsArr, t)
+	}
+	return toolsArr
+}
+
+// searchResult is an entry of the content of a web_search_tool_result block.
+type searchResult struct {
+	Type  string `json:"type"` // "web_search_result"
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// isCodeExecution reports whether a server tool call runs code, which the
+// code execution tool does through several tools of its own.
+func isCodeExecution(name string) bool {
+	switch name {
+	case "code_execution", "bash_code_execution", "text_editor_code_execution":
+		return true
+	}
+	return false
+}
+
+// isServerToolResult reports whether a content block type is the result of a
+// server tool call, such as "web_search_tool_result".
+func isServerToolResult(blockType string) bool {
+	return strings.HasSuffix(blockType, "_tool_result") && blockType != "tool_result" && !strings.HasPrefix(blockType, "mcp_")
+}
+
+// finishServerToolCall completes the server_tool_use block being streamed, now
+// that all of its input has arrived.
+func (s *Stream) finishServerToolCall() error {
+	call := s.currentServerTool
+	s.currentServerTool = nil
+	if call == nil {
+		return nil
+	}
+	if len(call.input) > 0 {
+		call.block.Input = call.input
+	} else if len(call.block.Input) == 0 {
+		call.block.Input = json.RawMessage("{}")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(call.block.raw, &fields); err != nil {
+		return fmt.Errorf("error decoding server_tool_use block: %w", err)
+	}
+	fields["input"] = call.block.Input
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("error encoding server_tool_use block: %w", err)
+	}
+	call.item.Data = data
+	return nil
+}
+
+// dropUnfinishedServerToolCall removes the server_tool_use block being
+// streamed from the message if the stream ended before the block did, since
+// the block is incomplete and can't be sent back.
+func (s *Stream) dropUnfinishedServerToolCall() {
+	call := s.currentServerTool
+	if call == nil {
+		return
+	}
+	s.currentServerTool = nil
+	delete(s.serverToolCalls, call.item.ID)
+	s.message.Content = slices.DeleteFunc(s.message.Content, func(item content.Item) bool {
+		return item == content.Item(call.item)
+	})
+}
+
+// addServerToolResult adds the result of a server tool call to the message,
+// and surfaces web searches via StreamStatusSearch. It returns false if the
+// consumer stopped iterating.
+func (s *Stream) addServerToolResult(block contentBlock, yield func(llms.StreamStatus) bool) bool {
+	item := &content.ServerTool{ID: block.ToolUseID, Result: true, Data: block.raw}
+	call := s.serverToolCalls[block.ToolUseID]
+	if call != nil {
+		item.Name = call.item.Name
+	}
+	s.message.Content = append(s.message.Content, item)
+	if block.Type != "web_search_tool_result" {
+		return true
+	}
+	// A failed search has an error object as its content rather than a list,
+	// and is surfaced without results.
+	var results []searchResult
+	_ = json.Unmarshal(block.Content, &results)
+	search := llms.SearchActivity{Source: "web", ResultCount: len(results)}
+	if call != nil {
+		var input struct {
+			Query string `json:"query"`
+		}
+		if json.Unmarshal(call.block.Input, &input) == nil {
+			search.Query = input.Query
+		}
+	}
+	for _, result := range results {
+		search.Sources = append(search.Sources, llms.SearchSource{Title: result.Title, URL: result.URL})
+	}
+	s.lastSearch = search
+	return yield(llms.StreamStatusSearch)
+}
@@ -0,0 +1,174 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+)
+
+func TestAnthropic_ServerToolsPayload(t *testing.T) {
+	type captured struct {
+		Headers http.Header
+		Body    map[string]any
+	}
+	captureCh := make(chan captured, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		captureCh <- captured{Headers: r.Header.Clone(), Body: body}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"type\":\"message_start\",\"message\":{\"role\":\"assistant\"}}\n\n"))
+		_, _ = w.Write([]byte("data: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer ts.Close()
+
+	m := New("test-key", "claude-sonnet-4-6").
+		WithEndpoint(ts.URL, "Test").
+		WithBeta("code-execution-2025-08-25").
+		WithServerTool(WebSearchTool{MaxUses: 3, AllowedDomains: []string{"go.dev"}}).
+		WithServerTool(WebFetchTool{Citations: true}).
+		WithServerTool(CodeExecutionTool{})
+	stream := m.Generate(context.Background(), nil, nil, nil, nil)
+	stream.Iter()(func(llms.StreamStatus) bool { return true })
+	require.NoError(t, stream.Err())
+
+	cap := <-captureCh
+	assert.Equal(t, []any{
+		map[string]any{"type": "web_search_20250305", "name": "web_search", "max_uses": float64(3), "allowed_domains": []any{"go.dev"}},
+		map[string]any{"type": "web_fetch_20250910", "name": "web_fetch", "citations": map[string]any{"enabled": true}},
+		map[string]any{"type": "code_execution_20250825", "name": "code_execution"},
+	}, cap.Body["tools"])
+	_, hasToolChoice := cap.Body["tool_choice"]
+	assert.False(t, hasToolChoice)
+	// Betas the tools need are added once.
+	assert.Equal(t, []string{"code-execution-2025-08-25", "web-fetch-2025-09-10"}, cap.Headers.Values("Anthropic-Beta"))
+}
+
+func TestAnthropicStream_ServerTools(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","role":"assistant"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me look that up."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"server_tool_use","id":"srvtoolu_1","name":"web_search","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"query\": "}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"go 1.25\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"web_search_tool_result","tool_use_id":"srvtoolu_1","content":[{"type":"web_search_result","url":"https://go.dev/doc/go1.25","title":"Go 1.25 Release Notes","encrypted_content":"abc"}]}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"content_block_start","index":3,"content_block":{"type":"server_tool_use","id":"srvtoolu_2","name":"bash_code_execution","input":{}}}`,
+		`{"type":"content_block_delta","index":3,"delta":{"type":"input_json_delta","partial_json":"{\"command\":\"go version\"}"}}`,
+		`{"type":"content_block_stop","index":3}`,
+		`{"type":"content_block_start","index":4,"content_block":{"type":"bash_code_execution_tool_result","tool_use_id":"srvtoolu_2","content":{"type":"bash_code_execution_result","stdout":"go1.25","stderr":"","return_code":0,"content":[]}}}`,
+		`{"type":"content_block_stop","index":4}`,
+		`{"type":"content_block_start","index":5,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":5,"delta":{"type":"text_delta","text":"Go 1.25 is out."}}`,
+		`{"type":"content_block_stop","index":5}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":20,"server_tool_use":{"web_search_requests":1}}}`,
+		`{"type":"message_stop"}`,
+	}
+	var sse strings.Builder
+	for _, event := range events {
+		sse.WriteString("data: " + event + "\n\n")
+	}
+	stream := newTestAnthropicStream(context.Background(), "claude-sonnet-4-6", sse.String())
+
+	var searches []llms.SearchActivity
+	for status := range stream.Iter() {
+		assert.NotEqual(t, llms.StreamStatusToolCallBegin, status)
+		assert.NotEqual(t, llms.StreamStatusToolCallDelta, status)
+		if status == llms.StreamStatusSearch {
+			searches = append(searches, stream.Search())
+		}
+	}
+	require.NoError(t, stream.Err())
+
+	assert.Equal(t, []llms.SearchActivity{{
+		Source:      "web",
+		Query:       "go 1.25",
+		ResultCount: 1,
+		Sources:     []llms.SearchSource{{Title: "Go 1.25 Release Notes", URL: "https://go.dev/doc/go1.25"}},
+	}}, searches)
+	assert.Equal(t, 1, stream.Usage().WebSearchRequests)
+	assert.Equal(t, 1, stream.Usage().CodeExecutionRequests)
+
+	msg := stream.Message()
+	assert.Empty(t, msg.ToolCalls)
+	require.Len(t, msg.Content, 6)
+	assert.Equal(t, "Let me look that up.", msg.Content[0].(*content.Text).Text)
+	call := msg.Content[1].(*content.ServerTool)
+	assert.Equal(t, "srvtoolu_1", call.ID)
+	assert.Equal(t, "web_search", call.Name)
+	assert.False(t, call.Result)
+	assert.JSONEq(t, `{"type":"server_tool_use","id":"srvtoolu_1","name":"web_search","input":{"query":"go 1.25"}}`, string(call.Data))
+	result := msg.Content[2].(*content.ServerTool)
+	assert.Equal(t, "srvtoolu_1", result.ID)
+	assert.Equal(t, "web_search", result.Name)
+	assert.True(t, result.Result)
+	assert.Equal(t, "bash_code_execution", msg.Content[4].(*content.ServerTool).Name)
+	assert.Equal(t, "Go 1.25 is out.", msg.Content[5].(*content.Text).Text)
+
+	// The blocks are sent back as they were received on the next turn.
+	apiMessage, err := messageFromLLM(msg)
+	require.NoError(t, err)
+	data, err := json.Marshal(apiMessage.Content)
+	require.NoError(t, err)
+	var blocks []json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &blocks))
+	require.Len(t, blocks, 6)
+	assert.JSONEq(t, string(call.Data), string(blocks[1]))
+	assert.JSONEq(t, `{"type":"web_search_tool_result","tool_use_id":"srvtoolu_1","content":[{"type":"web_search_result","url":"https://go.dev/doc/go1.25","title":"Go 1.25 Release Notes","encrypted_content":"abc"}]}`, string(blocks[2]))
+	assert.JSONEq(t, `{"type":"bash_code_execution_tool_result","tool_use_id":"srvtoolu_2","content":{"type":"bash_code_execution_result","stdout":"go1.25","stderr":"","return_code":0,"content":[]}}`, string(blocks[4]))
+}
+
+func TestContentFromLLM_ServerToolCacheHint(t *testing.T) {
+	cl, err := contentFromLLM(content.Content{
+		&content.ServerTool{ID: "srvtoolu_1", Result: true, Data: json.RawMessage(`{"type":"web_search_tool_result","tool_use_id":"srvtoolu_1","content":[]}`)},
+		&content.CacheHint{Duration: "long"},
+	})
+	require.NoError(t, err)
+	data, err := json.Marshal(cl)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"web_search_tool_result","tool_use_id":"srvtoolu_1","content":[],"cache_control":{"type":"ephemeral","ttl":"1h"}}]`, string(data))
+}
+
+func TestAnthropicStream_UnfinishedServerToolCall(t *testing.T) {
+	// The stream is cut off in the middle of the server_tool_use block.
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","role":"assistant"}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me look that up."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"server_tool_use","id":"srvtoolu_1","name":"web_search","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"query\": "}}`,
+	}
+	var sse strings.Builder
+	for _, event := range events {
+		sse.WriteString("data: " + event + "\n\n")
+	}
+	stream := newTestAnthropicStream(context.Background(), "claude-sonnet-4-6", sse.String())
+	for range stream.Iter() {
+	}
+
+	msg := stream.Message()
+	assert.Equal(t, content.FromText("Let me look that up."), msg.Content, "The incomplete block is dropped")
+
+	// A server tool block without data, such as one stored before, is never
+	// sent back either.
+	msg.Content = append(msg.Content, &content.ServerTool{ID: "srvtoolu_1", Name: "web_search"})
+	apiMessage, err := messageFromLLM(msg)
+	require.NoError(t, err)
+	data, err := json.Marshal(apiMessage.Content)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"text","text":"Let me look that up."}]`, string(data))
+}
@@ -2,7 +2,9 @@ package anthropic
 
 import (
 	"encoding/json"
+	"strconv"
 
+	"github.com/flitsinc/go-llms/content"
 	"github.com/flitsinc/go-llms/tools"
 )
 
@@ -121,13 +123,41 @@ type contentItem struct {
 	// Source of an image or document. Contains image data (base64/URL/file) or document data.
 	Source *source `json:"source,omitempty"`
 
-	// Citations for text content.
-	Citations []citation `json:"citations,omitempty"`
+	// Citations of a text block in a response ([]citation), or whether
+	// citations are enabled for a document block in a request
+	// (*citationsConfig).
+	Citations any `json:"citations,omitempty"`
+
+	// raw is a block from a response that is sent back verbatim, such as a
+	// server_tool_use block. It replaces all other fields but CacheControl.
+	raw json.RawMessage
+}
+
+// MarshalJSON implements custom JSON marshaling for contentItem, so that raw
+// blocks are sent as they were received.
+func (ci contentItem) MarshalJSON() ([]byte, error) {
+	if ci.raw == nil {
+		type plain contentItem
+		return json.Marshal(plain(ci))
+	}
+	if ci.CacheControl == nil {
+		return ci.raw, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(ci.raw, &fields); err != nil {
+		return nil, err
+	}
+	cc, err := json.Marshal(ci.CacheControl)
+	if err != nil {
+		return nil, err
+	}
+	fields["cache_control"] = cc
+	return json.Marshal(fields)
 }
 
 // source represents the source of an image or document.
 type source struct {
-	Type      string `json:"type"`                 // "base64", "url", "file", or "content" for documents
+	Type      string `json:"type"`                 // "base64", "url", "file", or "text" and "content" for documents
 	MediaType string `json:"media_type,omitempty"` // MIME type of the image (e.g., "image/jpeg")
 	Data      string `json:"data,omitempty"`       // Base64-encoded image data
 	URL       string `json:"url,omitempty"`        // URL of the image
@@ -161,26 +191,56 @@ type messageEvent struct {
 
 // contentBlock represents the initial state of a content block
 type contentBlock struct {
-	Type  string          `json:"type"`            // Type of content block: "text", "tool_use", "thinking", "redacted_thinking"
+	Type  string          `json:"type"`            // Type of content block: "text", "tool_use", "thinking", "redacted_thinking", "server_tool_use", "web_search_tool_result", etc.
 	Text  string          `json:"text,omitempty"`  // Initial text content (typically empty)
-	ID    string          `json:"id,omitempty"`    // Unique ID for the content block (used for tool_use blocks)
-	Name  string          `json:"name,omitempty"`  // For tool_use blocks, name of the tool being called
+	ID    string          `json:"id,omitempty"`    // Unique ID for the content block (used for tool_use and server_tool_use blocks)
+	Name  string          `json:"name,omitempty"`  // For tool_use and server_tool_use blocks, name of the tool being called
 	Input json.RawMessage `json:"input,omitempty"` // Arguments passed to the tool
 	// Fields for thinking blocks
 	Thinking  string `json:"thinking,omitempty"`  // Initial thinking content (for "thinking" type)
 	Signature string `json:"signature,omitempty"` // Initial signature (for "thinking" type)
 	Data      string `json:"data,omitempty"`      // Base64-encoded data (for "redacted_thinking" type)
+	// Fields for server tool results, which arrive complete
+	ToolUseID string          `json:"tool_use_id,omitempty"` // ID of the server_tool_use block this result responds to
+	Content   json.RawMessage `json:"content,omitempty"`     // The result, e.g. a list of web search results
+	// Citations of a text block, only present in complete responses
+	Citations []citation `json:"citations,omitempty"`
+
+	// raw is the block as it was received.
+	raw json.RawMessage
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for contentBlock, keeping
+// the block as it was received so server tool blocks can be sent back as is.
+func (b *contentBlock) UnmarshalJSON(data []byte) error {
+	type plain contentBlock
+	if err := json.Unmarshal(data, (*plain)(b)); err != nil {
+		return err
+	}
+	b.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// messageResponse is a complete response of the Messages API, as found in
+// the results of a message batch.
+type messageResponse struct {
+	ID         string         `json:"id"`
+	Role       string         `json:"role"`
+	Content    []contentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      usage          `json:"usage"`
 }
 
 // delta represents incremental updates in "content_block_delta" and "message_delta" events
 type delta struct {
 	// content_block_delta
 
-	Type        string `json:"type,omitempty"`         // Type of delta: "text_delta", "input_json_delta", "thinking_delta", "signature_delta"
-	Text        string `json:"text,omitempty"`         // Text fragment for text content blocks
-	PartialJSON string `json:"partial_json,omitempty"` // For tool_use blocks, fragments of JSON for the input field
-	Thinking    string `json:"thinking,omitempty"`     // Thinking fragment for thinking content blocks
-	Signature   string `json:"signature,omitempty"`    // Used in signature_delta events to verify thinking content
+	Type        string    `json:"type,omitempty"`         // Type of delta: "text_delta", "input_json_delta", "thinking_delta", "signature_delta"
+	Text        string    `json:"text,omitempty"`         // Text fragment for text content blocks
+	PartialJSON string    `json:"partial_json,omitempty"` // For tool_use blocks, fragments of JSON for the input field
+	Thinking    string    `json:"thinking,omitempty"`     // Thinking fragment for thinking content blocks
+	Signature   string    `json:"signature,omitempty"`    // Used in signature_delta events to verify thinking content
+	Citation    *citation `json:"citation,omitempty"`     // Used in citations_delta events for text blocks
 
 	// message_delta
 
@@ -193,14 +253,58 @@ type usage struct {
 	OutputTokens             *int           `json:"output_tokens,omitempty"`
 	CacheCreationInputTokens *int           `json:"cache_creation_input_tokens,omitempty"`
 	CacheReadInputTokens     *int           `json:"cache_read_input_tokens,omitempty"`
+	CacheCreation            *cacheCreation `json:"cache_creation,omitempty"`
 	ServerToolUse            *serverToolUse `json:"server_tool_use,omitempty"`
 }
 
+// cacheCreation breaks cache writes down by TTL
+type cacheCreation struct {
+	Ephemeral5mInputTokens int `json:"ephemeral_5m_input_tokens,omitempty"`
+	Ephemeral1hInputTokens int `json:"ephemeral_1h_input_tokens,omitempty"`
+}
+
 // serverToolUse represents server tool usage statistics
 type serverToolUse struct {
 	WebSearchRequests int `json:"web_search_requests,omitempty"`
 }
 
+// toLLM converts the citation to a content.Citation without a span, since the
+// span is the text block it belongs to.
+func (c *citation) toLLM() content.Citation {
+	out := content.Citation{Source: "document", CitedText: c.CitedText}
+	if c.DocumentTitle != nil {
+		out.Title = *c.DocumentTitle
+	}
+	metadata := map[string]string{"anthropic:type": c.Type}
+	switch c.Type {
+	case "char_location":
+		out.DocumentIndex = c.DocumentIndex
+		metadata["anthropic:start_char_index"] = strconv.Itoa(c.StartCharIndex)
+		metadata["anthropic:end_char_index"] = strconv.Itoa(c.EndCharIndex)
+	case "page_location":
+		out.DocumentIndex = c.DocumentIndex
+		metadata["anthropic:start_page_number"] = strconv.Itoa(c.StartPageNumber)
+		metadata["anthropic:end_page_number"] = strconv.Itoa(c.EndPageNumber)
+	case "content_block_location":
+		out.DocumentIndex = c.DocumentIndex
+		metadata["anthropic:start_block_index"] = strconv.Itoa(c.StartBlockIndex)
+		metadata["anthropic:end_block_index"] = strconv.Itoa(c.EndBlockIndex)
+	case "web_search_result_location":
+		out.Source = "web"
+		out.URL = c.URL
+		if c.Title != nil {
+			out.Title = *c.Title
+		}
+	}
+	out.Metadata = metadata
+	return out
+}
+
+// citationsConfig enables citations for a document block
+type citationsConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
 // citation represents a source citation in a text content block
 type citation struct {
 	// Common fields for all citation types
@@ -8,13 +8,15 @@ import (
 type Type string
 
 const (
-	TypeText      Type = "text"
-	TypeImageURL  Type = "image_url"
-	TypeAudioURL  Type = "audio_url"
-	TypeVideoURL  Type = "video_url"
-	TypeJSON      Type = "json"
-	TypeThought   Type = "thought"
-	TypeCacheHint Type = "cache_hint"
+	TypeText       Type = "text"
+	TypeImageURL   Type = "image_url"
+	TypeAudioURL   Type = "audio_url"
+	TypeVideoURL   Type = "video_url"
+	TypeDocument   Type = "document"
+	TypeJSON       Type = "json"
+	TypeThought    Type = "thought"
+	TypeServerTool Type = "server_tool"
+	TypeCacheHint  Type = "cache_hint"
 )
 
 type Item interface {
@@ -23,12 +25,38 @@ type Item interface {
 
 type Text struct {
 	Text string `json:"text"`
+	// Citations attribute spans of the text to the sources the model drew on.
+	Citations []Citation `json:"citations,omitempty"`
 }
 
 func (t *Text) Type() Type {
 	return TypeText
 }
 
+// Citation attributes a span of a Text item to a source, such as a Document
+// in the request or a web page the provider searched.
+type Citation struct {
+	// Start and End are the byte offsets of the cited span in the text.
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// Source is the kind of source cited: "document", "web" or "file".
+	Source string `json:"source"`
+	// DocumentIndex is the position of the cited document among the
+	// documents of the request, counting from 0, for "document" sources.
+	DocumentIndex int `json:"document_index,omitempty"`
+	// FileID identifies the cited file, for "file" sources.
+	FileID string `json:"file_id,omitempty"`
+	// URL is the address of the cited page, for "web" sources.
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title,omitempty"`
+	// CitedText is the passage of the source that supports the span, if the
+	// provider includes it.
+	CitedText string `json:"cited_text,omitempty"`
+	// Metadata holds provider-specific details, such as the pages cited.
+	// Keys are prefixed with the provider name, e.g. "anthropic:start_page".
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
 // MetadataCarrier is implemented by content items that can carry
 // provider-specific metadata through the pipeline. Keys are prefixed
 // with the provider name, e.g. "openai:item_id".
@@ -80,6 +108,23 @@ func (vu *VideoURL) GetMetadata() map[string]string {
 	return vu.Metadata
 }
 
+// Document is a document such as a PDF, as a data URI or a URL that the
+// provider fetches itself.
+type Document struct {
+	URL string `json:"document_url"`
+	// MimeType, if omitted, will be inferred from data URIs / URL path extensions.
+	MimeType string `json:"mime_type,omitempty"`
+	// Title is shown to the model, where the provider supports it.
+	Title string `json:"title,omitempty"`
+	// Citations asks the model to cite the document in its response, where
+	// the provider supports it (Anthropic).
+	Citations bool `json:"citations,omitempty"`
+}
+
+func (d *Document) Type() Type {
+	return TypeDocument
+}
+
 type JSON struct {
 	Data json.RawMessage `json:"data"`
 }
@@ -116,6 +161,25 @@ func (t *Thought) GetMetadata() map[string]string {
 	return t.Metadata
 }
 
+// ServerTool is a call the model made to a tool that the provider runs
+// itself, such as Anthropic's web search, or the result of one. The block is
+// kept exactly as the provider sent it so that it can be sent back on later
+// turns; other providers skip it.
+type ServerTool struct {
+	// ID identifies the call, and is shared by the call and its result.
+	ID string `json:"id"`
+	// Name is the name of the tool, e.g. "web_search".
+	Name string `json:"name,omitempty"`
+	// Result is true if this is the result of the call rather than the call.
+	Result bool `json:"result,omitempty"`
+	// Data is the provider's block, verbatim.
+	Data json.RawMessage `json:"data"`
+}
+
+func (s *ServerTool) Type() Type {
+	return TypeServerTool
+}
+
 type CacheHint struct {
 	// Duration: "short", "long"
 	Duration string `json:"duration,omitempty"`
@@ -181,6 +245,29 @@ func (c *Content) Append(text string) {
 	*c = append(*c, &Text{Text: text})
 }
 
+// AddCitation attaches the citation to the last content item if it's a text
+// item, otherwise it adds a new, empty text item with the citation.
+func (c *Content) AddCitation(citation Citation) {
+	if l := len(*c); l > 0 {
+		if tc, ok := (*c)[l-1].(*Text); ok {
+			tc.Citations = append(tc.Citations, citation)
+			return
+		}
+	}
+	*c = append(*c, &Text{Citations: []Citation{citation}})
+}
+
+// TextLen returns the length in bytes of the last item if it's a text item,
+// which is where Append adds more text.
+func (c Content) TextLen() int {
+	if l := len(c); l > 0 {
+		if tc, ok := c[l-1].(*Text); ok {
+			return len(tc.Text)
+		}
+	}
+	return 0
+}
+
 // AppendThought adds the given text to the last content item if it's a thought,
 // otherwise it adds a new thought item to the end of the list.
 func (c *Content) AppendThought(text string) {
@@ -295,10 +382,14 @@ func (c *Content) UnmarshalJSON(data []byte) error {
 			item = &AudioURL{}
 		case TypeVideoURL:
 			item = &VideoURL{}
+		case TypeDocument:
+			item = &Document{}
 		case TypeJSON:
 			item = &JSON{}
 		case TypeThought:
 			item = &Thought{}
+		case TypeServerTool:
+			item = &ServerTool{}
 		case TypeCacheHint:
 			item = &CacheHint{}
 		default:
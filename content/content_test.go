@@ -164,6 +164,25 @@ func TestContentRoundTrip(t *testing.T) {
 			name:    "json content",
 			content: FromRawJSON(json.RawMessage(`{"foo":"bar"}`)),
 		},
+		{
+			name: "document",
+			content: Content{
+				&Document{URL: "data:application/pdf;base64,JVBERi0=", MimeType: "application/pdf", Title: "Report", Citations: true},
+			},
+		},
+		{
+			name: "text with citations",
+			content: Content{
+				&Text{Text: "Water is wet.", Citations: []Citation{{Start: 9, End: 12, Source: "document", DocumentIndex: 2, CitedText: "wet", Metadata: map[string]string{"anthropic:type": "char_location"}}}},
+			},
+		},
+		{
+			name: "server tool",
+			content: Content{
+				&ServerTool{ID: "srvtoolu_1", Name: "web_search", Data: json.RawMessage(`{"id":"srvtoolu_1","input":{"query":"go"},"name":"web_search","type":"server_tool_use"}`)},
+				&ServerTool{ID: "srvtoolu_1", Name: "web_search", Result: true, Data: json.RawMessage(`{"content":[],"tool_use_id":"srvtoolu_1","type":"web_search_tool_result"}`)},
+			},
+		},
 		{
 			name: "multiple text items",
 			content: Content{
@@ -247,3 +266,19 @@ func TestContentAppend(t *testing.T) {
 		assert.Equal(t, "start middle end", textItem.Text)
 	})
 }
+
+func TestContentAddCitation(t *testing.T) {
+	c := FromText("Water is wet.")
+	assert.Equal(t, 13, c.TextLen())
+	c.AddCitation(Citation{Start: 9, End: 12, Source: "web", URL: "https://example.com"})
+	c.Append(" Fire is hot.")
+	require.Len(t, c, 1)
+	textItem := c[0].(*Text)
+	assert.Equal(t, "wet", textItem.Text[textItem.Citations[0].Start:textItem.Citations[0].End])
+
+	c = Content{&ImageURL{URL: "image.png"}}
+	assert.Equal(t, 0, c.TextLen())
+	c.AddCitation(Citation{Source: "document"})
+	require.Len(t, c, 2)
+	assert.Equal(t, []Citation{{Source: "document"}}, c[1].(*Text).Citations)
+}
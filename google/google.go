@@ -9,6 +9,7 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -244,19 +245,13 @@ func (m *Model) Model() string {
 	return m.model
 }
 
-func (m *Model) Generate(
-	ctx context.Context,
+// buildPayload converts a request to the body of a generateContent request.
+func (m *Model) buildPayload(
 	systemPrompt content.Content,
 	messages []llms.Message,
 	toolbox *tools.Toolbox,
 	jsonOutputSchema *tools.ValueSchema,
-) llms.ProviderStream {
-	debugger := llms.GetDebugger(ctx)
-
-	if m.endpoint == "" {
-		return &Stream{err: fmt.Errorf("must call either WithVertexAI(…) or WithGenerativeLanguageAPI(…) first")}
-	}
-
+) (map[string]any, error) {
 	var apiMessages []message
 	var pendingFunctionMsg *message
 	var deferredAfterFunction []message
@@ -281,7 +276,7 @@ func (m *Model) Generate(
 	for _, msg := range messages {
 		convertedMsgs, err := messagesFromLLM(msg)
 		if err != nil {
-			return &Stream{err: fmt.Errorf("failed to convert message for Google: %w", err)}
+			return nil, fmt.Errorf("failed to convert message for Google: %w", err)
 		}
 		if msg.Role == "tool" {
 			if len(convertedMsgs) > 0 && convertedMsgs[0].Role == "user" {
@@ -391,7 +386,7 @@ func (m *Model) Generate(
 	if systemPrompt != nil {
 		systemParts, err := convertContent(systemPrompt)
 		if err != nil {
-			return &Stream{err: fmt.Errorf("failed to convert system prompt for Google: %w", err)}
+			return nil, fmt.Errorf("failed to convert system prompt for Google: %w", err)
 		}
 		payload["systemInstruction"] = map[string]any{
 			"parts": systemParts,
@@ -410,7 +405,7 @@ func (m *Model) Generate(
 				schema.Parameters = sanitizeSchemaForGemini(schema.Parameters)
 				declarations[i] = schema
 			default:
-				return &Stream{err: fmt.Errorf("google: unsupported tool grammar type %T", g)}
+				return nil, fmt.Errorf("google: unsupported tool grammar type %T", g)
 			}
 		}
 		payload["tools"] = map[string]any{
@@ -454,23 +449,76 @@ func (m *Model) Generate(
 		}
 	}
 
-	jsonData, err := json.Marshal(payload)
+	return payload, nil
+}
+
+// CountTokens counts the input tokens of a request with the countTokens
+// endpoint. The request is converted like Generate converts it.
+func (m *Model) CountTokens(ctx context.Context, systemPrompt content.Content, messages []llms.Message, toolbox *tools.Toolbox) (int, error) {
+	if m.endpoint == "" {
+		return 0, fmt.Errorf("must call either WithVertexAI(…) or WithGenerativeLanguageAPI(…) first")
+	}
+	payload, err := m.buildPayload(systemPrompt, messages, toolbox, nil)
 	if err != nil {
-		return &Stream{err: fmt.Errorf("error encoding JSON: %w", err)}
+		return 0, err
 	}
 
-	if debugger != nil {
-		debugger.RawRequest(m.endpoint, jsonData)
+	endpoint, err := url.Parse(m.endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	endpoint.Path = strings.Replace(endpoint.Path, ":streamGenerateContent", ":countTokens", 1)
+	query := endpoint.Query()
+	query.Del("alt")
+	endpoint.RawQuery = query.Encode()
+
+	var body map[string]any
+	if m.tokenSource != nil {
+		// Vertex AI takes the parts of the request that count as input.
+		body = map[string]any{"contents": payload["contents"]}
+		for _, key := range []string{"systemInstruction", "tools"} {
+			if v, ok := payload[key]; ok {
+				body[key] = v
+			}
+		}
+	} else {
+		// The Gemini API takes the whole request.
+		payload["model"] = "models/" + m.model
+		body = map[string]any{"generateContentRequest": payload}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", m.endpoint, bytes.NewReader(jsonData))
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding JSON: %w", err)
+	}
+	if debugger := llms.GetDebugger(ctx); debugger != nil {
+		debugger.RawRequest(endpoint.String(), jsonData)
+	}
+	resp, err := m.do(ctx, endpoint.String(), jsonData)
 	if err != nil {
-		return &Stream{err: fmt.Errorf("error creating request: %w", err)}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("error decoding token count: %w", err)
+	}
+	return result.TotalTokens, nil
+}
+
+// do sends a POST request to the API, returning an error for any response
+// but 200 OK.
+func (m *Model) do(ctx context.Context, endpoint string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 	if m.tokenSource != nil {
 		token, err := m.tokenSource.Token()
 		if err != nil {
-			return &Stream{err: fmt.Errorf("error getting token from source: %w", err)}
+			return nil, fmt.Errorf("error getting token from source: %w", err)
 		}
 		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
 	}
@@ -483,7 +531,7 @@ func (m *Model) Generate(
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return &Stream{err: fmt.Errorf("error making request: %w", err)}
+		return nil, fmt.Errorf("error making request: %w", err)
 	}
 	if resp.StatusCode != http.StatusOK {
 		defer resp.Body.Close()
@@ -493,21 +541,57 @@ func (m *Model) Generate(
 			var errResp errorResponse // Assumes this struct matches Google's { "error": { ... } } format
 			if jsonErr := json.Unmarshal(bodyBytes, &errResp); jsonErr == nil && errResp.Error.Message != "" {
 				// Successfully parsed the Google error format
-				return &Stream{err: &llms.HTTPError{
+				return nil, &llms.HTTPError{
 					StatusCode: resp.StatusCode,
 					Status:     resp.Status,
+					RetryAfter: llms.ParseRetryAfter(resp.Header),
 					ErrorType:  errResp.Error.Status,
 					Message:    errResp.Error.Message,
-				}}
+				}
 			}
 			// Body read okay, but JSON parsing failed or structure mismatch.
 			// Fall through to return status only.
 		}
 		// Default fallback: Read error, empty body, or failed/unexpected JSON parse.
-		return &Stream{err: &llms.HTTPError{
+		return nil, &llms.HTTPError{
 			StatusCode: resp.StatusCode,
 			Status:     resp.Status,
-		}}
+			RetryAfter: llms.ParseRetryAfter(resp.Header),
+		}
+	}
+	return resp, nil
+}
+
+func (m *Model) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []llms.Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) llms.ProviderStream {
+	debugger := llms.GetDebugger(ctx)
+
+	if m.endpoint == "" {
+		return &Stream{err: fmt.Errorf("must call either WithVertexAI(…) or WithGenerativeLanguageAPI(…) first")}
+	}
+
+	payload, err := m.buildPayload(systemPrompt, messages, toolbox, jsonOutputSchema)
+	if err != nil {
+		return &Stream{err: err}
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return &Stream{err: fmt.Errorf("error encoding JSON: %w", err)}
+	}
+
+	if debugger != nil {
+		debugger.RawRequest(m.endpoint, jsonData)
+	}
+
+	resp, err := m.do(ctx, m.endpoint, jsonData)
+	if err != nil {
+		return &Stream{err: err}
 	}
 	return &Stream{
 		ctx:            ctx,
@@ -534,6 +618,13 @@ type Stream struct {
 	lastImage   struct{ URL, MIME string }
 	lastAudio   struct{ URL, MIME string }
 
+	// Provider-run tool use: Google Search queries and code executions.
+	webSearchQueries, codeExecutions int
+
+	// How many grounding supports have been turned into citations so far.
+	groundingSupports int
+	lastCitation      content.Citation
+
 	// Tool call tracking for streaming function call arguments.
 	// Maps functionCall.ID to the index in message.ToolCalls.
 	toolCallsByID map[string]int
@@ -550,6 +641,8 @@ type Stream struct {
 	activeToolCallID string
 }
 
+var _ llms.StopReasoner = (*Stream)(nil)
+
 func (s *Stream) Err() error {
 	return s.err
 }
@@ -581,6 +674,11 @@ func (s *Stream) ToolCall() llms.ToolCall {
 	return s.message.ToolCalls[len(s.message.ToolCalls)-1]
 }
 
+// Citation returns the citation of the last StreamStatusCitation.
+func (s *Stream) Citation() content.Citation {
+	return s.lastCitation
+}
+
 func (s *Stream) Thought() content.Thought {
 	if s.lastThought != nil {
 		return *s.lastThought
@@ -588,16 +686,30 @@ func (s *Stream) Thought() content.Thought {
 	return content.Thought{}
 }
 
+// StopReason returns why the model stopped, once the stream is done.
+func (s *Stream) StopReason() llms.StopReason {
+	return s.message.StopReason
+}
+
 func (s *Stream) Usage() llms.Usage {
-	if s.usage == nil {
-		return llms.Usage{}
+	usage := llms.Usage{
+		WebSearchRequests:     s.webSearchQueries,
+		CodeExecutionRequests: s.codeExecutions,
 	}
-	// TODO: Report cache context tokens.
-	return llms.Usage{
-		CachedInputTokens: 0,
-		InputTokens:       s.usage.PromptTokenCount,
-		OutputTokens:      s.usage.CandidatesTokenCount,
+	if u := s.usage; u != nil {
+		// Unlike other providers, Google reports thoughts and tool use prompts
+		// separately, but bills them as output and input.
+		usage.CachedInputTokens = u.CachedContentTokenCount
+		usage.InputTokens = u.PromptTokenCount + u.ToolUsePromptTokenCount
+		usage.OutputTokens = u.CandidatesTokenCount + u.ThoughtsTokenCount
+		usage.ReasoningTokens = u.ThoughtsTokenCount
+		usage.ToolUsePromptTokens = u.ToolUsePromptTokenCount
+		usage.AudioInputTokens = tokensOf(u.PromptTokensDetails, "AUDIO") + tokensOf(u.ToolUsePromptTokensDetails, "AUDIO")
+		usage.ImageInputTokens = tokensOf(u.PromptTokensDetails, "IMAGE") + tokensOf(u.ToolUsePromptTokensDetails, "IMAGE")
+		usage.AudioOutputTokens = tokensOf(u.CandidatesTokensDetails, "AUDIO")
+		usage.ImageOutputTokens = tokensOf(u.CandidatesTokensDetails, "IMAGE")
 	}
+	return usage
 }
 
 func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
@@ -701,9 +813,21 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 			if chunk.UsageMetadata != nil {
 				s.usage = chunk.UsageMetadata
 			}
+			if f := chunk.PromptFeedback; f != nil && f.BlockReason != "" {
+				s.message.StopReason = llms.StopReasonContentFilter
+				s.err = &llms.StopReasonError{
+					Reason:         s.message.StopReason,
+					ProviderReason: f.BlockReason,
+					SafetyRatings:  safetyRatingsToLLM(f.SafetyRatings),
+				}
+				return
+			}
 			if len(chunk.Candidates) < 1 {
 				continue
 			}
+			if g := chunk.Candidates[0].GroundingMetadata; g != nil && len(g.WebSearchQueries) > 0 {
+				s.webSearchQueries = len(g.WebSearchQueries)
+			}
 			delta := chunk.Candidates[0].Content
 			if delta.Role != "" {
 				s.message.Role = delta.Role
@@ -717,6 +841,9 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 				}
 			}
 			for _, p := range delta.Parts {
+				if p.ExecutableCode != nil {
+					s.codeExecutions++
+				}
 				if p.Text != nil && *p.Text != "" {
 					if p.Thought {
 						// Note: Google only gives us summaries.
@@ -987,10 +1114,40 @@ func (s *Stream) Iter() func(yield func(llms.StreamStatus) bool) {
 						}
 						lastEventWasThinking = false
 					}
-					if chunk.Candidates[0].FinishReason == "MAX_TOKENS" {
-						s.err = fmt.Errorf("%w (finishReason=%q)", llms.ErrOutputTruncated, chunk.Candidates[0].FinishReason)
-						// Do not return here. The stream may still deliver a usage
-						// chunk that populates s.usage.
+				}
+			}
+			// Grounding comes with the text it supports, and refers to the
+			// response text by byte offsets.
+			if g := chunk.Candidates[0].GroundingMetadata; g != nil && len(g.GroundingSupports) > s.groundingSupports {
+				textLen := s.message.Content.TextLen()
+				for _, support := range g.GroundingSupports[s.groundingSupports:] {
+					for _, citation := range support.citations(g.GroundingChunks) {
+						citation.Start = min(citation.Start, textLen)
+						citation.End = min(citation.End, textLen)
+						s.message.Content.AddCitation(citation)
+						s.lastCitation = citation
+						if !yield(llms.StreamStatusCitation) {
+							return
+						}
+					}
+				}
+				s.groundingSupports = len(g.GroundingSupports)
+			}
+			// A blocked response may finish without any parts.
+			if finishReason := chunk.Candidates[0].FinishReason; finishReason != "" {
+				s.message.StopReason = stopReason(finishReason, len(s.message.ToolCalls) > 0)
+				// Do not return on errors here. The stream may still deliver a
+				// usage chunk that populates s.usage. Other reasons, such as
+				// MALFORMED_FUNCTION_CALL, are only recorded, since the response
+				// is still usable.
+				switch s.message.StopReason {
+				case llms.StopReasonMaxTokens:
+					s.err = fmt.Errorf("%w (finishReason=%q)", llms.ErrOutputTruncated, finishReason)
+				case llms.StopReasonContentFilter:
+					s.err = &llms.StopReasonError{
+						Reason:         s.message.StopReason,
+						ProviderReason: finishReason,
+						SafetyRatings:  safetyRatingsToLLM(chunk.Candidates[0].SafetyRatings),
 					}
 				}
 			}
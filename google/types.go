@@ -182,6 +182,12 @@ func convertContent(c content.Content) (parts, error) {
 			if err != nil {
 				return nil, err
 			}
+		case *content.Document:
+			var err error
+			pp, err = mediaPart(v.URL, v.MimeType)
+			if err != nil {
+				return nil, err
+			}
 		case *content.JSON:
 			text := string(v.Data)
 			pp.Text = &text
@@ -191,6 +197,9 @@ func convertContent(c content.Content) (parts, error) {
 			pp.Text = &thoughtText
 			pp.Thought = true
 			pp.ThoughtSignature = v.Signature
+		case *content.ServerTool:
+			// Another provider's server tool call, which Gemini can't replay.
+			continue
 		case *content.CacheHint:
 			// Google has implicit caching; ignore.
 			continue
@@ -361,20 +370,108 @@ func messagesFromLLM(m llms.Message) ([]message, error) {
 }
 
 type usageMetadata struct {
-	PromptTokenCount     int `json:"promptTokenCount"`
-	CandidatesTokenCount int `json:"candidatesTokenCount"`
-	TotalTokenCount      int `json:"totalTokenCount"`
+	PromptTokenCount           int                  `json:"promptTokenCount"`
+	CandidatesTokenCount       int                  `json:"candidatesTokenCount"`
+	TotalTokenCount            int                  `json:"totalTokenCount"`
+	CachedContentTokenCount    int                  `json:"cachedContentTokenCount,omitempty"`
+	ThoughtsTokenCount         int                  `json:"thoughtsTokenCount,omitempty"`
+	ToolUsePromptTokenCount    int                  `json:"toolUsePromptTokenCount,omitempty"`
+	PromptTokensDetails        []modalityTokenCount `json:"promptTokensDetails,omitempty"`
+	CandidatesTokensDetails    []modalityTokenCount `json:"candidatesTokensDetails,omitempty"`
+	ToolUsePromptTokensDetails []modalityTokenCount `json:"toolUsePromptTokensDetails,omitempty"`
+}
+
+// modalityTokenCount is the number of tokens of one modality, such as "TEXT",
+// "IMAGE", "AUDIO" or "VIDEO".
+type modalityTokenCount struct {
+	Modality   string `json:"modality"`
+	TokenCount int    `json:"tokenCount"`
+}
+
+// tokensOf returns the number of tokens of the given modality.
+func tokensOf(details []modalityTokenCount, modality string) int {
+	total := 0
+	for _, d := range details {
+		if d.Modality == modality {
+			total += d.TokenCount
+		}
+	}
+	return total
 }
 
 type streamingResponse struct {
-	Candidates    []candidate    `json:"candidates"`
-	UsageMetadata *usageMetadata `json:"usageMetadata,omitempty"`
+	Candidates     []candidate     `json:"candidates"`
+	UsageMetadata  *usageMetadata  `json:"usageMetadata,omitempty"`
+	PromptFeedback *promptFeedback `json:"promptFeedback,omitempty"`
+}
+
+// promptFeedback explains why a prompt was blocked.
+type promptFeedback struct {
+	BlockReason   string         `json:"blockReason,omitempty"`
+	SafetyRatings []safetyRating `json:"safetyRatings,omitempty"`
 }
 
 type candidate struct {
-	Content       candidateContent `json:"content"`
-	SafetyRatings []safetyRating   `json:"safetyRatings,omitempty"`
-	FinishReason  string           `json:"finishReason,omitempty"`
+	Content           candidateContent   `json:"content"`
+	SafetyRatings     []safetyRating     `json:"safetyRatings,omitempty"`
+	FinishReason      string             `json:"finishReason,omitempty"`
+	GroundingMetadata *groundingMetadata `json:"groundingMetadata,omitempty"`
+}
+
+// groundingMetadata describes how a response was grounded with Google Search.
+type groundingMetadata struct {
+	WebSearchQueries  []string           `json:"webSearchQueries,omitempty"`
+	GroundingChunks   []groundingChunk   `json:"groundingChunks,omitempty"`
+	GroundingSupports []groundingSupport `json:"groundingSupports,omitempty"`
+}
+
+// groundingChunk is a source the response was grounded in.
+type groundingChunk struct {
+	Web              *groundingSource `json:"web,omitempty"`
+	RetrievedContext *groundingSource `json:"retrievedContext,omitempty"`
+}
+
+type groundingSource struct {
+	URI   string `json:"uri,omitempty"`
+	Title string `json:"title,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+// groundingSupport ties a segment of the response text to the chunks that
+// support it.
+type groundingSupport struct {
+	Segment struct {
+		StartIndex int    `json:"startIndex,omitempty"` // In bytes
+		EndIndex   int    `json:"endIndex,omitempty"`
+		Text       string `json:"text,omitempty"`
+	} `json:"segment"`
+	GroundingChunkIndices []int `json:"groundingChunkIndices,omitempty"`
+}
+
+// citations returns a citation for every chunk supporting the segment.
+func (s groundingSupport) citations(chunks []groundingChunk) []content.Citation {
+	var citations []content.Citation
+	for _, i := range s.GroundingChunkIndices {
+		if i < 0 || i >= len(chunks) {
+			continue
+		}
+		citation := content.Citation{Start: s.Segment.StartIndex, End: s.Segment.EndIndex}
+		switch chunk := chunks[i]; {
+		case chunk.Web != nil:
+			citation.Source = "web"
+			citation.URL = chunk.Web.URI
+			citation.Title = chunk.Web.Title
+		case chunk.RetrievedContext != nil:
+			citation.Source = "file"
+			citation.URL = chunk.RetrievedContext.URI
+			citation.Title = chunk.RetrievedContext.Title
+			citation.CitedText = chunk.RetrievedContext.Text
+		default:
+			continue
+		}
+		citations = append(citations, citation)
+	}
+	return citations
 }
 
 type candidateContent struct {
@@ -388,6 +485,37 @@ type safetyRating struct {
 	ProbabilityScore float64 `json:"probabilityScore"`
 	Severity         string  `json:"severity"`
 	SeverityScore    float64 `json:"severityScore"`
+	Blocked          bool    `json:"blocked,omitempty"`
+}
+
+func safetyRatingsToLLM(ratings []safetyRating) []llms.SafetyRating {
+	if len(ratings) == 0 {
+		return nil
+	}
+	result := make([]llms.SafetyRating, len(ratings))
+	for i, r := range ratings {
+		result[i] = llms.SafetyRating{Category: r.Category, Probability: r.Probability, Blocked: r.Blocked}
+	}
+	return result
+}
+
+// stopReason normalizes a Gemini finishReason. Gemini doesn't have a separate
+// reason for tool calls.
+func stopReason(finishReason string, hasToolCalls bool) llms.StopReason {
+	switch finishReason {
+	case "STOP":
+		if hasToolCalls {
+			return llms.StopReasonToolUse
+		}
+		return llms.StopReasonEndTurn
+	case "MAX_TOKENS":
+		return llms.StopReasonMaxTokens
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII",
+		"IMAGE_SAFETY", "IMAGE_PROHIBITED_CONTENT", "IMAGE_RECITATION":
+		return llms.StopReasonContentFilter
+	default:
+		return llms.StopReasonOther
+	}
 }
 
 // applyPartialArgsJSON merges partial argument updates into an existing JSON object.
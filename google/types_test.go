@@ -389,6 +389,17 @@ func TestGoogle_ToolChoice_Config(t *testing.T) {
 	})
 }
 
+func TestConvertContent_Document(t *testing.T) {
+	p, err := convertContent(content.Content{
+		&content.Document{URL: "data:application/pdf;base64,JVBERi0=", Title: "Report"},
+		&content.Document{URL: "gs://bucket/paper.pdf"},
+	})
+	require.NoError(t, err)
+	require.Len(t, p, 2)
+	assert.Equal(t, &inlineData{MimeType: "application/pdf", Data: "JVBERi0="}, p[0].InlineData)
+	assert.Equal(t, &fileData{MimeType: "application/pdf", FileURI: "gs://bucket/paper.pdf"}, p[1].FileData)
+}
+
 func TestGenerate_MalformedMediaReturnsStreamError(t *testing.T) {
 	m := New("gemini-2.0-flash-exp").WithGeminiAPI("key")
 
@@ -425,3 +436,179 @@ func mustMarshal(v any) json.RawMessage {
 	}
 	return json.RawMessage(data)
 }
+
+func TestStream_GroundingCitations(t *testing.T) {
+	streamResp := `data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "Spain won Euro 2024."}]}}]}` + "\n" +
+		`data: {"candidates": [{"content": {"role": "model", "parts": [{"text": " Final: 2-1."}]}, "finishReason": "STOP", "groundingMetadata": {"webSearchQueries": ["euro 2024 winner"], "groundingChunks": [{"web": {"uri": "https://example.com/a", "title": "a.com"}}, {"web": {"uri": "https://example.com/b", "title": "b.com"}}], "groundingSupports": [{"segment": {"endIndex": 20, "text": "Spain won Euro 2024."}, "groundingChunkIndices": [0, 1]}, {"segment": {"startIndex": 21, "endIndex": 32, "text": "Final: 2-1."}, "groundingChunkIndices": [1]}]}}]}` + "\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(streamResp))
+	}))
+	defer server.Close()
+
+	model := New("gemini-2.5-pro").WithGeminiAPI("fake-key")
+	model.endpoint = server.URL
+	stream := model.Generate(context.Background(), nil, []llms.Message{
+		{Role: "user", Content: content.FromText("Who won Euro 2024?")},
+	}, nil, nil)
+	citer := stream.(interface{ Citation() content.Citation })
+	var citations []content.Citation
+	stream.Iter()(func(status llms.StreamStatus) bool {
+		if status == llms.StreamStatusCitation {
+			citations = append(citations, citer.Citation())
+		}
+		return true
+	})
+	require.NoError(t, stream.Err())
+
+	assert.Equal(t, []content.Citation{
+		{Start: 0, End: 20, Source: "web", URL: "https://example.com/a", Title: "a.com"},
+		{Start: 0, End: 20, Source: "web", URL: "https://example.com/b", Title: "b.com"},
+		{Start: 21, End: 32, Source: "web", URL: "https://example.com/b", Title: "b.com"},
+	}, citations)
+	text := stream.Message().Content[0].(*content.Text)
+	assert.Equal(t, "Final: 2-1.", text.Text[21:32])
+	assert.Equal(t, citations, text.Citations)
+}
+
+func TestStream_UsageBreakdown(t *testing.T) {
+	streamResp := `data: {"candidates": [{"content": {"role": "model", "parts": [{"executableCode": {"language": "PYTHON", "code": "print(1)"}}, {"text": "Done"}]}, "groundingMetadata": {"webSearchQueries": ["a", "b"]}}], "usageMetadata": {"promptTokenCount": 100, "cachedContentTokenCount": 40, "candidatesTokenCount": 20, "thoughtsTokenCount": 30, "toolUsePromptTokenCount": 10, "totalTokenCount": 160, "promptTokensDetails": [{"modality": "TEXT", "tokenCount": 60}, {"modality": "IMAGE", "tokenCount": 40}], "candidatesTokensDetails": [{"modality": "AUDIO", "tokenCount": 20}]}}` + "\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(streamResp))
+	}))
+	defer server.Close()
+
+	model := New("gemini-2.5-pro").WithGeminiAPI("fake-key")
+	model.endpoint = server.URL
+	stream := model.Generate(context.Background(), nil, []llms.Message{
+		{Role: "user", Content: content.FromText("hi")},
+	}, nil, nil)
+	stream.Iter()(func(status llms.StreamStatus) bool { return true })
+	require.NoError(t, stream.Err())
+
+	assert.Equal(t, llms.Usage{
+		CachedInputTokens:     40,
+		InputTokens:           110,
+		OutputTokens:          50,
+		ReasoningTokens:       30,
+		ImageInputTokens:      40,
+		AudioOutputTokens:     20,
+		ToolUsePromptTokens:   10,
+		WebSearchRequests:     2,
+		CodeExecutionRequests: 1,
+	}, stream.Usage())
+}
+
+func TestStream_StopReasons(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		chunk   string
+		want    llms.StopReason
+		err     error
+		ratings []llms.SafetyRating
+	}{
+		{
+			name:  "end turn",
+			chunk: `{"candidates": [{"content": {"role": "model", "parts": [{"text": "Hi"}]}, "finishReason": "STOP"}]}`,
+			want:  llms.StopReasonEndTurn,
+		},
+		{
+			name:  "tool use",
+			chunk: `{"candidates": [{"content": {"role": "model", "parts": [{"functionCall": {"id": "call_1", "name": "get_weather", "args": {}}}]}, "finishReason": "STOP"}]}`,
+			want:  llms.StopReasonToolUse,
+		},
+		{
+			name:    "safety without parts",
+			chunk:   `{"candidates": [{"content": {"role": "model"}, "finishReason": "SAFETY", "safetyRatings": [{"category": "HARM_CATEGORY_HARASSMENT", "probability": "HIGH", "blocked": true}]}]}`,
+			want:    llms.StopReasonContentFilter,
+			err:     llms.ErrContentFiltered,
+			ratings: []llms.SafetyRating{{Category: "HARM_CATEGORY_HARASSMENT", Probability: "HIGH", Blocked: true}},
+		},
+		{
+			name:    "blocked prompt",
+			chunk:   `{"promptFeedback": {"blockReason": "PROHIBITED_CONTENT", "safetyRatings": [{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "probability": "MEDIUM"}]}}`,
+			want:    llms.StopReasonContentFilter,
+			err:     llms.ErrContentFiltered,
+			ratings: []llms.SafetyRating{{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Probability: "MEDIUM"}},
+		},
+		{
+			name:  "malformed function call",
+			chunk: `{"candidates": [{"content": {"role": "model"}, "finishReason": "MALFORMED_FUNCTION_CALL"}]}`,
+			want:  llms.StopReasonOther,
+		},
+		{
+			name:  "other",
+			chunk: `{"candidates": [{"content": {"role": "model", "parts": [{"text": "Hi"}]}, "finishReason": "OTHER"}]}`,
+			want:  llms.StopReasonOther,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte("data: " + tc.chunk + "\n"))
+			}))
+			defer server.Close()
+
+			model := New("gemini-2.5-pro").WithGeminiAPI("fake-key")
+			model.endpoint = server.URL
+			stream := model.Generate(context.Background(), nil, []llms.Message{
+				{Role: "user", Content: content.FromText("hi")},
+			}, nil, nil)
+			stream.Iter()(func(status llms.StreamStatus) bool { return true })
+
+			assert.Equal(t, tc.want, stream.Message().StopReason)
+			if tc.err == nil {
+				require.NoError(t, stream.Err())
+				return
+			}
+			var stopErr *llms.StopReasonError
+			require.ErrorAs(t, stream.Err(), &stopErr)
+			assert.ErrorIs(t, stream.Err(), tc.err)
+			assert.Equal(t, tc.ratings, stopErr.SafetyRatings)
+		})
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	var path, key string
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, key = r.URL.Path, r.URL.Query().Get("key")
+		assert.Empty(t, r.URL.Query().Get("alt"))
+		body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		_, _ = w.Write([]byte(`{"totalTokens":17}`))
+	}))
+	defer server.Close()
+
+	messages := []llms.Message{{Role: "user", Content: content.FromText("hi")}}
+
+	// The Gemini API takes the whole request.
+	model := New("gemini-2.5-flash").WithGeminiAPI("fake-key")
+	model.endpoint = server.URL + "/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse&key=fake-key"
+	count, err := llms.CountTokens(context.Background(), model, content.FromText("Be brief."), messages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 17, count)
+	assert.Equal(t, "/v1beta/models/gemini-2.5-flash:countTokens", path)
+	assert.Equal(t, "fake-key", key)
+	request, ok := body["generateContentRequest"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "models/gemini-2.5-flash", request["model"])
+	assert.Contains(t, request, "contents")
+	assert.Contains(t, request, "systemInstruction")
+
+	// Vertex AI takes the input only.
+	model = New("gemini-2.5-flash").WithVertexAIAccessToken("token", "project", "us-central1")
+	model.endpoint = server.URL + "/v1/projects/project/locations/us-central1/publishers/google/models/gemini-2.5-flash:streamGenerateContent?alt=sse"
+	count, err = model.CountTokens(context.Background(), content.FromText("Be brief."), messages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 17, count)
+	assert.Equal(t, "/v1/projects/project/locations/us-central1/publishers/google/models/gemini-2.5-flash:countTokens", path)
+	assert.Contains(t, body, "contents")
+	assert.Contains(t, body, "systemInstruction")
+	assert.NotContains(t, body, "generateContentRequest")
+	assert.NotContains(t, body, "generationConfig")
+}
@@ -0,0 +1,85 @@
+package llms
+
+import (
+	"sync"
+)
+
+// AfterResponseState allows callers to inspect a completed turn and inject
+// follow-up messages into the conversation.
+type AfterResponseState interface {
+	// Turn returns the 1-based number of the turn that completed.
+	Turn() int
+	// Message returns a clone of the assistant message of the turn.
+	Message() Message
+	// Usage returns the token usage of the turn.
+	Usage() Usage
+	// ToolResults returns a clone of the messages carrying the results of
+	// the turn's tool calls, in the order they were added to the
+	// conversation.
+	ToolResults() []Message
+	// Inject adds messages, usually from the user, to the conversation after
+	// the turn, and makes the chat continue so the model can respond to them.
+	Inject(messages ...Message)
+}
+
+type afterResponseState struct {
+	mu          sync.Mutex
+	turnNumber  int
+	message     Message
+	usage       Usage
+	toolResults []Message
+	injected    []Message
+	frozen      bool
+}
+
+func newAfterResponseState(turnNumber int, result *turnResult) *afterResponseState {
+	return &afterResponseState{
+		turnNumber:  turnNumber,
+		message:     cloneMessage(result.message),
+		usage:       result.usage,
+		toolResults: cloneMessages(result.toolMessages),
+	}
+}
+
+func (s *afterResponseState) Turn() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.turnNumber
+}
+
+func (s *afterResponseState) Message() Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cloneMessage(s.message)
+}
+
+func (s *afterResponseState) Usage() Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage
+}
+
+func (s *afterResponseState) ToolResults() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cloneMessages(s.toolResults)
+}
+
+func (s *afterResponseState) Inject(messages ...Message) {
+	if len(messages) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frozen {
+		return
+	}
+	s.injected = append(s.injected, cloneMessages(messages)...)
+}
+
+func (s *afterResponseState) freeze() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frozen = true
+	return cloneMessages(s.injected)
+}
@@ -0,0 +1,108 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+func TestAfterResponseInspectsTurns(t *testing.T) {
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool)
+	var turns []int
+	var toolResults [][]Message
+	llm.AfterResponse = func(ctx context.Context, state AfterResponseState) error {
+		turns = append(turns, state.Turn())
+		toolResults = append(toolResults, state.ToolResults())
+		assert.Equal(t, "assistant", state.Message().Role)
+		assert.Equal(t, Usage{CachedInputTokens: 10, InputTokens: 20, OutputTokens: 30}, state.Usage())
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Use the tool")
+	require.NoError(t, llm.Err())
+	assert.Equal(t, []int{1, 2}, turns)
+	require.Len(t, toolResults[0], 1)
+	assert.Equal(t, "test_tool-id-0", toolResults[0][0].ToolCallID)
+	assert.Empty(t, toolResults[1])
+}
+
+func TestAfterResponseInject(t *testing.T) {
+	llm := New(&mockProvider{})
+	llm.AfterResponse = func(ctx context.Context, state AfterResponseState) error {
+		if state.Turn() == 1 {
+			state.Inject(Message{Role: "user", Content: content.FromText("Are you sure?")})
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Hello")
+	require.NoError(t, llm.Err())
+	require.Len(t, llm.Messages(), 4, "The injected message should get its own response")
+	assert.Equal(t, "Are you sure?", textOf(t, llm.Messages()[2]))
+	assert.Equal(t, "assistant", llm.Messages()[3].Role)
+}
+
+func TestAfterResponseVeto(t *testing.T) {
+	errVeto := errors.New("not allowed")
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool)
+	llm.AfterResponse = func(ctx context.Context, state AfterResponseState) error {
+		return errVeto
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Use the tool")
+	assert.ErrorIs(t, llm.Err(), errVeto)
+	assert.Len(t, llm.Messages(), 3, "The vetoed turn stays in the conversation, but no more turns run")
+}
+
+func TestAfterToolCallRewritesResult(t *testing.T) {
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool)
+	llm.AfterToolCall = func(ctx context.Context, toolCall ToolCall, result tools.Result) (tools.Result, error) {
+		assert.Equal(t, "test_tool", toolCall.Name)
+		require.NoError(t, result.Error())
+		return tools.SuccessFromString("[redacted]"), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	updates := runTestChat(ctx, t, llm, "Use the tool")
+	require.NoError(t, llm.Err())
+
+	var done *ToolDoneUpdate
+	for _, update := range updates {
+		if u, ok := update.(ToolDoneUpdate); ok {
+			done = &u
+		}
+	}
+	require.NotNil(t, done)
+	assert.Equal(t, llm.Messages()[2].Content, done.Result.Content())
+	assert.JSONEq(t, `{"output":"[redacted]"}`, string(llm.Messages()[2].Content[0].(*content.JSON).Data))
+}
+
+func TestAfterToolCallVeto(t *testing.T) {
+	errVeto := errors.New("tool output leaked a secret")
+	for _, parallel := range []int{0, 2} {
+		llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool).WithParallelToolCalls(parallel)
+		llm.AfterToolCall = func(ctx context.Context, toolCall ToolCall, result tools.Result) (tools.Result, error) {
+			return nil, errVeto
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		runTestChat(ctx, t, llm, "Use the tool")
+		cancel()
+		assert.ErrorIs(t, llm.Err(), errVeto, "parallel %d", parallel)
+		assert.Len(t, llm.Messages(), 1, "parallel %d", parallel)
+	}
+}
@@ -0,0 +1,272 @@
+package llms
+
+import (
+	"context"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// Agent is a template for LLMs that share a provider, tools, system prompt and
+// hooks, such as the conversations of a chat server. Unlike an LLM, an Agent
+// is safe for concurrent use: each session gets its own LLM, created from the
+// template when the session is first used, and calls within a session are
+// serialized.
+//
+// Configure the Agent before the first call to Session; its fields and
+// settings must not change afterwards. The hooks are shared by all sessions,
+// so they must be safe for concurrent use.
+type Agent struct {
+	provider          Provider
+	toolbox           *tools.Toolbox
+	maxTurns          int
+	retry             RetryPolicy
+	parallelToolCalls int
+	budget            *Budget
+	pricing           CostCalculator
+	maxContinuations  int
+	idleTimeout       time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+
+	// SystemPrompt is the SystemPrompt of every session's LLM.
+	SystemPrompt func() content.Content
+	// TrackTTFT is the TrackTTFT of every session's LLM.
+	TrackTTFT func(context.Context, time.Duration)
+	// TrackUsage is the TrackUsage of every session's LLM.
+	TrackUsage func(ctx context.Context, usage Usage, success bool)
+	// RequiresApproval is the RequiresApproval of every session's LLM.
+	RequiresApproval func(ctx context.Context, toolCall ToolCall, tool tools.Tool) bool
+	// BeforeResponse is the BeforeResponse of every session's LLM.
+	BeforeResponse func(ctx context.Context, state BeforeResponseState) error
+	// AfterResponse is the AfterResponse of every session's LLM.
+	AfterResponse func(ctx context.Context, state AfterResponseState) error
+	// AfterToolCall is the AfterToolCall of every session's LLM.
+	AfterToolCall func(ctx context.Context, toolCall ToolCall, result tools.Result) (tools.Result, error)
+
+	// Setup, if set, is called with each new session's LLM after it was
+	// created from the template, to configure anything else, such as
+	// restoring the session from a ConversationStore. It doesn't hold up
+	// other sessions, but it must not call Session with its own session ID.
+	Setup func(sessionID string, llm *LLM)
+}
+
+// NewAgent creates an Agent whose sessions use the given provider and tools.
+func NewAgent(provider Provider, allTools ...tools.Tool) *Agent {
+	var toolbox *tools.Toolbox
+	if len(allTools) > 0 {
+		toolbox = tools.Box(allTools...)
+	}
+	return &Agent{
+		provider: provider,
+		toolbox:  toolbox,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Toolbox returns the toolbox that every session's toolbox is copied from, or
+// nil if no tools were provided. Tools added to it after a session was
+// created aren't available to that session.
+func (a *Agent) Toolbox() *tools.Toolbox { return a.toolbox }
+
+// WithMaxTurns sets the maximum number of turns of every session.
+func (a *Agent) WithMaxTurns(maxTurns int) *Agent {
+	a.maxTurns = maxTurns
+	return a
+}
+
+// WithRetry sets the retry policy of every session (see LLM.WithRetry).
+func (a *Agent) WithRetry(policy RetryPolicy) *Agent {
+	a.retry = policy
+	return a
+}
+
+// WithParallelToolCalls makes every session run tool calls in parallel (see
+// LLM.WithParallelToolCalls).
+func (a *Agent) WithParallelToolCalls(maxConcurrency int) *Agent {
+	a.parallelToolCalls = maxConcurrency
+	return a
+}
+
+// WithBudget gives every session its own budget (see LLM.WithBudget).
+func (a *Agent) WithBudget(budget Budget) *Agent {
+	a.budget = &budget
+	return a
+}
+
+// WithPricing makes every session track the cost of its usage (see
+// LLM.WithPricing).
+func (a *Agent) WithPricing(prices CostCalculator) *Agent {
+	a.pricing = prices
+	return a
+}
+
+// WithContinuation makes every session continue responses that were cut off
+// (see LLM.WithContinuation).
+func (a *Agent) WithContinuation(maxContinuations int) *Agent {
+	a.maxContinuations = maxContinuations
+	return a
+}
+
+// WithMaxConcurrency limits how many requests all sessions together can have
+// in flight to the provider at once (see LimitConcurrency).
+func (a *Agent) WithMaxConcurrency(maxConcurrency int) *Agent {
+	a.provider = LimitConcurrency(a.provider, maxConcurrency)
+	return a
+}
+
+// WithIdleTimeout makes the Agent forget sessions that haven't been used for
+// the given duration, so that a later call to Session with the same ID starts
+// over. Sessions are evicted lazily, whenever Session is called, and never
+// while they are in use. Save sessions to a ConversationStore first if they
+// need to outlive this.
+func (a *Agent) WithIdleTimeout(idleTimeout time.Duration) *Agent {
+	a.idleTimeout = idleTimeout
+	return a
+}
+
+// Session returns the session with the given ID, creating it if it doesn't
+// exist. Call it for each request rather than holding on to the Session,
+// since idle sessions may be evicted.
+func (a *Agent) Session(id string) *Session {
+	a.mu.Lock()
+	now := time.Now()
+	a.evictIdleLocked(now)
+	session, ok := a.sessions[id]
+	if !ok {
+		session = &Session{id: id, agent: a}
+		a.sessions[id] = session
+	}
+	session.lastUsed = now
+	a.mu.Unlock()
+	// The LLM is created outside the lock, since Setup may do I/O. Other
+	// callers of the same new session wait for it here.
+	session.setup.Do(func() { session.llm = a.newLLM(id) })
+	return session
+}
+
+// EndSession forgets the session with the given ID. A call that is still
+// running in it finishes normally.
+func (a *Agent) EndSession(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, id)
+}
+
+// Sessions returns the number of sessions the Agent currently holds.
+func (a *Agent) Sessions() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.sessions)
+}
+
+func (a *Agent) evictIdleLocked(now time.Time) {
+	if a.idleTimeout <= 0 {
+		return
+	}
+	for id, session := range a.sessions {
+		if session.busy == 0 && now.Sub(session.lastUsed) > a.idleTimeout {
+			delete(a.sessions, id)
+		}
+	}
+}
+
+func (a *Agent) newLLM(sessionID string) *LLM {
+	llm := New(a.provider).WithMaxTurns(a.maxTurns).WithRetry(a.retry).WithParallelToolCalls(a.parallelToolCalls).WithPricing(a.pricing).WithContinuation(a.maxContinuations)
+	if a.budget != nil {
+		llm.WithBudget(*a.budget)
+	}
+	if a.toolbox != nil {
+		// Each session gets its own toolbox, so that tools added to one
+		// session or a tool choice set in it don't leak into the others.
+		llm.toolbox = tools.Box(a.toolbox.All()...)
+		llm.toolbox.Choice = a.toolbox.Choice
+		llm.toolbox.Timeout = a.toolbox.Timeout
+	}
+	llm.SystemPrompt = a.SystemPrompt
+	llm.TrackTTFT = a.TrackTTFT
+	llm.TrackUsage = a.TrackUsage
+	llm.RequiresApproval = a.RequiresApproval
+	llm.BeforeResponse = a.BeforeResponse
+	llm.AfterResponse = a.AfterResponse
+	llm.AfterToolCall = a.AfterToolCall
+	if a.Setup != nil {
+		a.Setup(sessionID, llm)
+	}
+	return llm
+}
+
+// Session is a conversation of an Agent. Its methods are safe for concurrent
+// use; calls wait for the previous call in the same session to finish.
+type Session struct {
+	id    string
+	agent *Agent
+
+	// setup creates the LLM the first time the session is returned.
+	setup sync.Once
+	// mu serializes use of the LLM.
+	mu  sync.Mutex
+	llm *LLM
+
+	// Guarded by agent.mu.
+	busy     int
+	lastUsed time.Time
+}
+
+// ID returns the session's ID.
+func (s *Session) ID() string { return s.id }
+
+// Do calls fn with the session's LLM, which fn may use freely until it
+// returns, for example to take a Snapshot or Fork it. Other calls in the same
+// session wait until then.
+func (s *Session) Do(fn func(llm *LLM) error) error {
+	s.acquire()
+	defer s.release()
+	return fn(s.llm)
+}
+
+// Generate sends a message in the session and waits for the response (see
+// LLM.Generate).
+func (s *Session) Generate(ctx context.Context, message content.Content) (Response, error) {
+	var response Response
+	err := s.Do(func(llm *LLM) error {
+		var err error
+		response, err = llm.Generate(ctx, message)
+		return err
+	})
+	return response, err
+}
+
+// Stream sends a message in the session and returns an iterator over the
+// updates (see LLM.StreamContent). The session is held while the iterator is
+// being ranged over.
+func (s *Session) Stream(ctx context.Context, message content.Content) iter.Seq2[Update, error] {
+	return func(yield func(Update, error) bool) {
+		s.acquire()
+		defer s.release()
+		for update, err := range s.llm.StreamContent(ctx, message) {
+			if !yield(update, err) {
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) acquire() {
+	s.agent.mu.Lock()
+	s.busy++
+	s.agent.mu.Unlock()
+	s.mu.Lock()
+}
+
+func (s *Session) release() {
+	s.mu.Unlock()
+	s.agent.mu.Lock()
+	s.busy--
+	s.lastUsed = time.Now()
+	s.agent.mu.Unlock()
+}
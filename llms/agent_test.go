@@ -0,0 +1,199 @@
+package llms
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// concurrentProvider is a mockProvider that can be shared between goroutines,
+// and whose streams take a while, recording how many were in flight at once.
+type concurrentProvider struct {
+	mockProvider
+	mu                    sync.Mutex
+	inFlight, maxInFlight atomic.Int32
+}
+
+func (p *concurrentProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	p.mu.Lock()
+	stream := p.mockProvider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+	p.mu.Unlock()
+	n := p.inFlight.Add(1)
+	for {
+		current := p.maxInFlight.Load()
+		if n <= current || p.maxInFlight.CompareAndSwap(current, n) {
+			break
+		}
+	}
+	return &slowStream{ProviderStream: stream, done: func() { p.inFlight.Add(-1) }}
+}
+
+type slowStream struct {
+	ProviderStream
+	done func()
+}
+
+func (s *slowStream) Iter() func(func(StreamStatus) bool) {
+	return func(yield func(StreamStatus) bool) {
+		defer s.done()
+		time.Sleep(20 * time.Millisecond)
+		s.ProviderStream.Iter()(yield)
+	}
+}
+
+func TestAgentSessions(t *testing.T) {
+	provider := &concurrentProvider{mockProvider: mockProvider{toolCallsToMake: []string{"test_tool"}}}
+	agent := NewAgent(provider, testTool).WithMaxTurns(5).WithMaxConcurrency(2)
+	var tracked atomic.Int32
+	agent.TrackUsage = func(context.Context, Usage, bool) { tracked.Add(1) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range 12 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := agent.Session(fmt.Sprintf("session-%d", i%3))
+			_, err := session.Generate(ctx, content.FromText("Hello"))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, agent.Sessions())
+	assert.LessOrEqual(t, provider.maxInFlight.Load(), int32(2))
+	// The mock only calls the tool in the first chat of a conversation, so
+	// each session took five turns.
+	assert.Equal(t, int32(3*5), tracked.Load(), "Every turn of every session is tracked")
+
+	// Each session kept its own conversation: one chat with a tool call
+	// (user, assistant, tool, assistant) and three without.
+	for i := range 3 {
+		require.NoError(t, agent.Session(fmt.Sprintf("session-%d", i)).Do(func(llm *LLM) error {
+			assert.Len(t, llm.Messages(), 4+3*2)
+			return nil
+		}))
+	}
+}
+
+func TestAgentSessionToolboxesAreSeparate(t *testing.T) {
+	agent := NewAgent(&mockProvider{}, testTool)
+	extra := tools.Func("Extra", "Only in one session", "extra", func(r tools.Runner, p TestToolParams) tools.Result {
+		return tools.SuccessFromString("extra")
+	})
+
+	require.NoError(t, agent.Session("a").Do(func(llm *LLM) error {
+		llm.AddTool(extra)
+		return nil
+	}))
+	require.NoError(t, agent.Session("b").Do(func(llm *LLM) error {
+		assert.Nil(t, llm.Toolbox().Get("extra"))
+		assert.NotNil(t, llm.Toolbox().Get("test_tool"))
+		return nil
+	}))
+	assert.Nil(t, agent.Toolbox().Get("extra"))
+}
+
+func TestAgentIdleEviction(t *testing.T) {
+	var created []string
+	agent := NewAgent(&mockProvider{}).WithIdleTimeout(20 * time.Millisecond)
+	agent.Setup = func(sessionID string, llm *LLM) { created = append(created, sessionID) }
+
+	agent.Session("a")
+	time.Sleep(30 * time.Millisecond)
+	agent.Session("b")
+	assert.Equal(t, 1, agent.Sessions(), "Session a should have been evicted")
+	agent.Session("a")
+	assert.Equal(t, []string{"a", "b", "a"}, created)
+
+	// A session in use is never evicted.
+	session := agent.Session("busy")
+	require.NoError(t, session.Do(func(llm *LLM) error {
+		time.Sleep(30 * time.Millisecond)
+		agent.Session("c")
+		return nil
+	}))
+	agent.EndSession("c")
+	assert.Equal(t, 1, agent.Sessions())
+	assert.Same(t, session, agent.Session("busy"))
+}
+
+func TestAgentSetupRunsOutsideTheLock(t *testing.T) {
+	agent := NewAgent(&mockProvider{})
+	unblock := make(chan struct{})
+	agent.Setup = func(sessionID string, llm *LLM) {
+		switch sessionID {
+		case "slow":
+			<-unblock
+		case "child":
+			// Setup can use the agent, for example to copy another session.
+			require.NoError(t, agent.Session("parent").Do(func(parent *LLM) error {
+				return llm.Restore(parent.Snapshot())
+			}))
+			agent.EndSession("stale")
+			assert.Equal(t, 3, agent.Sessions())
+		}
+	}
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		agent.Session("slow")
+	}()
+	require.Eventually(t, func() bool { return agent.Sessions() == 1 }, time.Second, time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agent.Session("stale")
+		_, err := agent.Session("parent").Generate(context.Background(), content.FromText("Hello"))
+		assert.NoError(t, err)
+		require.NoError(t, agent.Session("child").Do(func(llm *LLM) error {
+			assert.Len(t, llm.Messages(), 2)
+			return nil
+		}))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("A slow Setup blocked other sessions")
+	}
+
+	close(unblock)
+	<-slowDone
+	assert.Equal(t, 3, agent.Sessions())
+}
+
+func TestLimitConcurrencyReleasesFailedRequests(t *testing.T) {
+	provider := LimitConcurrency(&errorMockProvider{errorMessage: "boom"}, 1)
+	for range 3 {
+		require.Error(t, provider.Generate(context.Background(), nil, nil, nil, nil).Err())
+	}
+	assert.Equal(t, 0, provider.InFlight())
+
+	// A request waiting for a slot gives up when its context is done.
+	blocked := LimitConcurrency(&mockProvider{}, 1)
+	stream := blocked.Generate(context.Background(), nil, nil, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, blocked.Generate(ctx, nil, nil, nil, nil).Err(), context.DeadlineExceeded)
+	for range stream.Iter() {
+	}
+	assert.Equal(t, 0, blocked.InFlight())
+}
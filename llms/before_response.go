@@ -122,6 +122,18 @@ func cloneMessage(m Message) Message {
 	return clone
 }
 
+func cloneCitations(citations []content.Citation) []content.Citation {
+	if citations == nil {
+		return nil
+	}
+	out := make([]content.Citation, len(citations))
+	for i, c := range citations {
+		out[i] = c
+		out[i].Metadata = cloneMetadata(c.Metadata)
+	}
+	return out
+}
+
 func cloneContent(c content.Content) content.Content {
 	if len(c) == 0 {
 		return nil
@@ -130,7 +142,7 @@ func cloneContent(c content.Content) content.Content {
 	for _, item := range c {
 		switch v := item.(type) {
 		case *content.Text:
-			out = append(out, &content.Text{Text: v.Text})
+			out = append(out, &content.Text{Text: v.Text, Citations: cloneCitations(v.Citations)})
 		case *content.ImageURL:
 			out = append(out, &content.ImageURL{
 				URL:      v.URL,
@@ -149,6 +161,9 @@ func cloneContent(c content.Content) content.Content {
 				MimeType: v.MimeType,
 				Metadata: cloneMetadata(v.Metadata),
 			})
+		case *content.Document:
+			doc := *v
+			out = append(out, &doc)
 		case *content.JSON:
 			out = append(out, &content.JSON{Data: append([]byte(nil), v.Data...)})
 		case *content.Thought:
@@ -160,6 +175,13 @@ func cloneContent(c content.Content) content.Content {
 				Metadata:  cloneMetadata(v.Metadata),
 				Summary:   v.Summary,
 			})
+		case *content.ServerTool:
+			out = append(out, &content.ServerTool{
+				ID:     v.ID,
+				Name:   v.Name,
+				Result: v.Result,
+				Data:   append([]byte(nil), v.Data...),
+			})
 		case *content.CacheHint:
 			out = append(out, &content.CacheHint{Duration: v.Duration})
 		default:
@@ -0,0 +1,95 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// ErrBudgetExceeded is wrapped by the BudgetExceededError a chat ends with
+// when the LLM has used up its Budget.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget caps what an LLM may use over its lifetime, as counted by its
+// TotalUsage. A zero limit means no limit.
+type Budget struct {
+	MaxInputTokens       int
+	MaxOutputTokens      int
+	MaxCachedInputTokens int
+	// MaxCost caps the total cost in dollars, as priced by the LLM's pricing
+	// (see LLM.WithPricing). Requests to models it doesn't know count as free.
+	MaxCost float64
+	// WrapUp gives the model one more turn, without tools, when the budget
+	// runs out in the middle of a chat, so that it can answer with what it
+	// has so far rather than stopping abruptly.
+	WrapUp bool
+}
+
+// BudgetExceededError is the error a chat ends with when the LLM's Budget is
+// used up. It wraps ErrBudgetExceeded.
+type BudgetExceededError struct {
+	// Limit is the limit that was reached: "input_tokens", "output_tokens",
+	// "cached_input_tokens" or "cost".
+	Limit string
+	// Usage is the LLM's TotalUsage at the time.
+	Usage  Usage
+	Budget Budget
+}
+
+func (e *BudgetExceededError) Error() string {
+	switch e.Limit {
+	case "input_tokens":
+		return fmt.Sprintf("%v: used %d input tokens of %d", ErrBudgetExceeded, e.Usage.InputTokens, e.Budget.MaxInputTokens)
+	case "output_tokens":
+		return fmt.Sprintf("%v: used %d output tokens of %d", ErrBudgetExceeded, e.Usage.OutputTokens, e.Budget.MaxOutputTokens)
+	case "cached_input_tokens":
+		return fmt.Sprintf("%v: used %d cached input tokens of %d", ErrBudgetExceeded, e.Usage.CachedInputTokens, e.Budget.MaxCachedInputTokens)
+	default:
+		return fmt.Sprintf("%v: spent $%.4f of $%.4f", ErrBudgetExceeded, e.Usage.Cost, e.Budget.MaxCost)
+	}
+}
+
+func (e *BudgetExceededError) Unwrap() error { return ErrBudgetExceeded }
+
+// WithBudget makes the LLM stop, rather than start another turn, once its
+// total usage reaches any of the budget's limits. The chat then ends with a
+// *BudgetExceededError, after a final turn without tools if WrapUp is set.
+func (l *LLM) WithBudget(budget Budget) *LLM {
+	l.budget = &budget
+	return l
+}
+
+// checkBudget returns a *BudgetExceededError if the budget is used up.
+func (l *LLM) checkBudget() error {
+	b := l.budget
+	if b == nil {
+		return nil
+	}
+	limit := ""
+	switch {
+	case b.MaxInputTokens > 0 && l.TotalUsage.InputTokens >= b.MaxInputTokens:
+		limit = "input_tokens"
+	case b.MaxOutputTokens > 0 && l.TotalUsage.OutputTokens >= b.MaxOutputTokens:
+		limit = "output_tokens"
+	case b.MaxCachedInputTokens > 0 && l.TotalUsage.CachedInputTokens >= b.MaxCachedInputTokens:
+		limit = "cached_input_tokens"
+	case b.MaxCost > 0 && l.TotalUsage.Cost >= b.MaxCost:
+		limit = "cost"
+	default:
+		return nil
+	}
+	return &BudgetExceededError{Limit: limit, Usage: l.TotalUsage, Budget: *b}
+}
+
+// wrapUp runs a final turn in which the model may not call any tools.
+func (l *LLM) wrapUp(ctx context.Context, emit func(Update)) error {
+	if l.toolbox != nil {
+		previous := l.toolbox.Choice
+		l.toolbox.Choice = tools.AllowOnly()
+		defer func() { l.toolbox.Choice = previous }()
+	}
+	_, err := l.turn(ctx, emit)
+	return err
+}
@@ -0,0 +1,99 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// choiceRecordingProvider records the tool choice of every request.
+type choiceRecordingProvider struct {
+	*mockProvider
+	choices []tools.ChoiceMode
+}
+
+func (p *choiceRecordingProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) ProviderStream {
+	var mode tools.ChoiceMode
+	if toolbox != nil {
+		mode = toolbox.Choice.Mode
+	}
+	p.choices = append(p.choices, mode)
+	return p.mockProvider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+}
+
+func TestBudgetStopsOnTokenLimit(t *testing.T) {
+	// Every mock request uses 20 input and 30 output tokens.
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool).
+		WithBudget(Budget{MaxOutputTokens: 30})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Use the tool")
+
+	var budgetErr *BudgetExceededError
+	require.ErrorAs(t, llm.Err(), &budgetErr)
+	assert.ErrorIs(t, llm.Err(), ErrBudgetExceeded)
+	assert.Equal(t, "output_tokens", budgetErr.Limit)
+	assert.Equal(t, 30, budgetErr.Usage.OutputTokens)
+	assert.Len(t, llm.Messages(), 3, "The tool result is kept but no turn responds to it")
+
+	// A new chat doesn't start at all once the budget is used up.
+	runTestChat(ctx, t, llm, "Hello again")
+	assert.ErrorIs(t, llm.Err(), ErrBudgetExceeded)
+	assert.Equal(t, 30, llm.TotalUsage.OutputTokens)
+}
+
+func TestBudgetStopsOnCost(t *testing.T) {
+	prices := PriceTable{"test-model": {Input: 1000, CachedInput: 100, Output: 2000}}
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool).
+		WithPricing(prices).
+		WithBudget(Budget{MaxCost: 0.05})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Use the tool")
+
+	// 20 input, 10 cached and 30 output tokens.
+	assert.InDelta(t, 0.081, llm.TotalUsage.Cost, 1e-9)
+	var budgetErr *BudgetExceededError
+	require.ErrorAs(t, llm.Err(), &budgetErr)
+	assert.Equal(t, "cost", budgetErr.Limit)
+	assert.InDelta(t, 0.081, budgetErr.Usage.Cost, 1e-9)
+	assert.Contains(t, budgetErr.Error(), "spent $0.0810 of $0.0500")
+}
+
+func TestBudgetWrapUp(t *testing.T) {
+	provider := &choiceRecordingProvider{mockProvider: &mockProvider{toolCallsToMake: []string{"test_tool"}}}
+	llm := New(provider, testTool).WithBudget(Budget{MaxInputTokens: 10, WrapUp: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Use the tool")
+
+	assert.ErrorIs(t, llm.Err(), ErrBudgetExceeded)
+	require.Len(t, llm.Messages(), 4)
+	assert.Equal(t, "I've processed the results from the tool.", textOf(t, llm.Messages()[3]))
+	assert.Equal(t, []tools.ChoiceMode{"", tools.ChoiceAllowOnly}, provider.choices)
+	assert.Equal(t, tools.ChoiceMode(""), llm.toolbox.Choice.Mode, "The tool choice should be restored")
+}
+
+func TestBudgetUnlimited(t *testing.T) {
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool).
+		WithPricing(PriceTable{}).
+		WithBudget(Budget{MaxOutputTokens: 1000})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Use the tool")
+	require.NoError(t, llm.Err())
+	assert.Len(t, llm.Messages(), 4)
+	assert.Zero(t, llm.TotalUsage.Cost, "Models without a price count as free")
+	assert.False(t, errors.Is(llm.Err(), ErrBudgetExceeded))
+}
@@ -0,0 +1,317 @@
+package llms
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/flitsinc/go-llms/content"
+)
+
+const defaultCompactionPrompt = `You summarize conversations between a user and an AI assistant so that the assistant can continue the conversation without the original messages.
+
+Write a concise summary that preserves:
+- The user's goals, requests and constraints, including exact names, paths, identifiers and numbers.
+- Decisions that were made and why.
+- What the assistant did, including tools it called and the essential parts of their results.
+- Anything that is still unfinished or was promised for later.
+
+Leave out pleasantries and anything that won't matter for the rest of the conversation. Write only the summary.`
+
+// compactionSummaryPrefix introduces the summary in the compacted conversation.
+const compactionSummaryPrefix = "For context, this is a summary of the earlier part of our conversation:\n\n"
+
+// Compactor keeps a conversation within a token budget by replacing its older
+// messages with a summary written by a (possibly cheaper) secondary provider.
+// Only the outbound messages of a request are compacted; the LLM's own history
+// keeps every message. The summary is reused for as long as the conversation
+// fits with it, and when it no longer does, the summary is updated with just
+// the messages it has to cover from then on, so it isn't written from scratch
+// on every turn. The usage of the summaries counts towards the usage of the
+// LLM that's compacted.
+//
+// A conversation is only ever cut right before a user or assistant message, so
+// an assistant's tool calls are never separated from their results.
+//
+// Use it as a BeforeResponse hook, or with LLM.WithCompactor to have it run on
+// every turn and also compact (and retry once) whenever the provider rejects a
+// request as too large:
+//
+//	llm.WithCompactor(llms.NewCompactor(cheapProvider, 150_000))
+//
+// A Compactor is safe for concurrent use.
+type Compactor struct {
+	provider   Provider
+	maxTokens  int
+	keepTokens int
+	prompt     string
+
+	mu sync.Mutex
+	// limit starts out as maxTokens, but is lowered whenever a provider
+	// rejects a request that was estimated to fit.
+	limit int
+	// summary is the latest summary, of the messages before summaryCut,
+	// which hash to summaryKey.
+	summary    string
+	summaryCut int
+	summaryKey [sha256.Size]byte
+}
+
+// NewCompactor returns a Compactor that summarizes older messages with the
+// given provider once a conversation is estimated (see EstimateTokens) to
+// exceed maxTokens. By default, the most recent half of that budget is kept
+// verbatim.
+func NewCompactor(provider Provider, maxTokens int) *Compactor {
+	return &Compactor{
+		provider:   provider,
+		maxTokens:  maxTokens,
+		keepTokens: maxTokens / 2,
+		prompt:     defaultCompactionPrompt,
+		limit:      maxTokens,
+	}
+}
+
+// WithKeepTokens sets roughly how many tokens of the most recent messages are
+// kept verbatim when compacting. At least the latest message is always kept.
+func (c *Compactor) WithKeepTokens(keepTokens int) *Compactor {
+	c.keepTokens = keepTokens
+	return c
+}
+
+// WithPrompt replaces the system prompt used to write summaries.
+func (c *Compactor) WithPrompt(prompt string) *Compactor {
+	c.prompt = prompt
+	return c
+}
+
+// BeforeResponse compacts the outbound messages if they are estimated to
+// exceed the token budget. It can be used as LLM.BeforeResponse directly, or
+// called from a BeforeResponse hook that does more.
+func (c *Compactor) BeforeResponse(ctx context.Context, state BeforeResponseState) error {
+	return c.compactState(ctx, state, false)
+}
+
+// Compact returns the messages with all but the most recent ones replaced by a
+// summary, regardless of whether they exceed the token budget. The messages
+// are returned unchanged if there is nowhere to cut them.
+func (c *Compactor) Compact(ctx context.Context, messages []Message) ([]Message, error) {
+	return c.compact(ctx, messages, c.keepTokens)
+}
+
+// compactState compacts the state's messages if they exceed the budget. With
+// force, the provider has just rejected them as too large, so they are
+// compacted anyway and the budget is lowered for next time.
+func (c *Compactor) compactState(ctx context.Context, state BeforeResponseState, force bool) error {
+	messages := state.Messages()
+	estimate := EstimateTokens(messages)
+
+	c.mu.Lock()
+	if force {
+		c.limit = min(c.limit, estimate*3/4)
+	}
+	limit := c.limit
+	c.mu.Unlock()
+
+	if estimate <= limit {
+		return nil
+	}
+	if !force {
+		// Keep using the latest summary while the conversation fits with it.
+		if cut, summary, ok := c.latestSummary(messages); ok {
+			if compacted := withSummary(messages, cut, summary); EstimateTokens(compacted) <= limit {
+				state.Replace(compacted...)
+				return nil
+			}
+		}
+	}
+	compacted, err := c.compact(ctx, messages, min(c.keepTokens, limit/2))
+	if err != nil {
+		return err
+	}
+	state.Replace(compacted...)
+	return nil
+}
+
+func (c *Compactor) compact(ctx context.Context, messages []Message, keepTokens int) ([]Message, error) {
+	cut := compactionCut(messages, keepTokens)
+	if cut <= 0 {
+		return messages, nil
+	}
+	summary, err := c.summarize(ctx, messages, cut)
+	if err != nil {
+		return nil, fmt.Errorf("compacting conversation: %w", err)
+	}
+	return withSummary(messages, cut, summary), nil
+}
+
+// withSummary returns the messages from cut on, preceded by the summary of
+// the messages before it.
+func withSummary(messages []Message, cut int, summary string) []Message {
+	summaryText := &content.Text{Text: compactionSummaryPrefix + summary}
+	kept := cloneMessages(messages[cut:])
+	if kept[0].Role == "user" {
+		// Merge the summary into the user message, since not every provider
+		// accepts two user messages in a row.
+		kept[0].Content = append(content.Content{summaryText}, kept[0].Content...)
+		return kept
+	}
+	return append([]Message{{Role: "user", Content: content.Content{summaryText}}}, kept...)
+}
+
+// compactionCut returns the index of the first message to keep: the earliest
+// user or assistant message after which the messages fit in keepTokens, or the
+// latest such message if none do. It returns -1 if there is no such message
+// after the first one.
+func compactionCut(messages []Message, keepTokens int) int {
+	cut := -1
+	kept := 0
+	for i := len(messages) - 1; i > 0; i-- {
+		kept += estimateMessageTokens(messages[i])
+		if cut != -1 && kept > keepTokens {
+			break
+		}
+		// Tool results always follow the assistant message that called the
+		// tools, so cutting before a user or assistant message never
+		// separates the two.
+		if role := messages[i].Role; role == "user" || role == "assistant" {
+			cut = i
+		}
+	}
+	return cut
+}
+
+// latestSummary returns the latest summary and where it cuts the messages, if
+// it summarizes the same messages as they start with now.
+func (c *Compactor) latestSummary(messages []Message) (cut int, summary string, ok bool) {
+	c.mu.Lock()
+	cut, summary, key := c.summaryCut, c.summary, c.summaryKey
+	c.mu.Unlock()
+	if summary == "" || cut >= len(messages) {
+		return 0, "", false
+	}
+	if hash, err := hashMessages(messages[:cut]); err != nil || hash != key {
+		return 0, "", false
+	}
+	return cut, summary, true
+}
+
+// summarize returns a summary of the messages before cut. If the latest
+// summary covers some of them, only it and the messages after it are
+// summarized.
+func (c *Compactor) summarize(ctx context.Context, messages []Message, cut int) (string, error) {
+	key, err := hashMessages(messages[:cut])
+	if err != nil {
+		return "", err
+	}
+	previousCut, previous, ok := c.latestSummary(messages)
+	if ok && previousCut == cut {
+		return previous, nil
+	}
+	var transcript string
+	if ok && previousCut < cut {
+		transcript = renderTranscript(previous, messages[previousCut:cut])
+	} else {
+		transcript = renderTranscript("", messages[:cut])
+	}
+
+	request := []Message{{Role: "user", Content: content.FromText(transcript)}}
+	stream := c.provider.Generate(ctx, content.FromText(c.prompt), request, nil, nil)
+	if err := stream.Err(); err != nil {
+		return "", err
+	}
+	for range stream.Iter() {
+	}
+	reportUsage(ctx, c.provider, stream, stream.Err() == nil)
+	if err := stream.Err(); err != nil {
+		return "", err
+	}
+
+	var summary strings.Builder
+	for _, item := range stream.Message().Content {
+		if text, ok := item.(*content.Text); ok {
+			summary.WriteString(text.Text)
+		}
+	}
+	if strings.TrimSpace(summary.String()) == "" {
+		return "", errors.New("summary is empty")
+	}
+
+	c.mu.Lock()
+	c.summary, c.summaryCut, c.summaryKey = summary.String(), cut, key
+	c.mu.Unlock()
+	return summary.String(), nil
+}
+
+func hashMessages(messages []Message) ([sha256.Size]byte, error) {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// renderTranscript turns messages into plain text for the summarizer, which
+// sees them as a document rather than as a conversation of its own. If there
+// is a summary of the messages before them, it's included so that the new
+// summary covers both.
+func renderTranscript(previousSummary string, messages []Message) string {
+	var b strings.Builder
+	if previousSummary == "" {
+		b.WriteString("Summarize this conversation:\n\n")
+	} else {
+		b.WriteString("Summarize this conversation. It continues from an earlier part that is summarized here, which your summary must also cover:\n\n<summary>\n")
+		b.WriteString(previousSummary)
+		b.WriteString("\n</summary>\n\n")
+	}
+	b.WriteString("<conversation>\n")
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			b.WriteString("User:\n")
+		case "assistant":
+			b.WriteString("Assistant:\n")
+		case "tool":
+			fmt.Fprintf(&b, "Result of tool %s:\n", msg.ToolCallName)
+		default:
+			fmt.Fprintf(&b, "%s:\n", msg.Role)
+		}
+		for _, item := range msg.Content {
+			switch v := item.(type) {
+			case *content.Text:
+				b.WriteString(v.Text)
+			case *content.JSON:
+				b.Write(v.Data)
+			case *content.ImageURL:
+				b.WriteString("[image]")
+			case *content.AudioURL:
+				b.WriteString("[audio]")
+			case *content.VideoURL:
+				b.WriteString("[video]")
+			case *content.Document:
+				if v.Title != "" {
+					fmt.Fprintf(&b, "[document: %s]", v.Title)
+				} else {
+					b.WriteString("[document]")
+				}
+			case *content.ServerTool:
+				if v.Result {
+					continue
+				}
+				fmt.Fprintf(&b, "[used server tool %s]", v.Name)
+			default:
+				continue
+			}
+			b.WriteString("\n")
+		}
+		for _, toolCall := range msg.ToolCalls {
+			fmt.Fprintf(&b, "[called tool %s with %s]\n", toolCall.Name, toolCall.Arguments)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("</conversation>")
+	return b.String()
+}
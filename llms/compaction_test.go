@@ -0,0 +1,225 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// summaryProvider counts how often it's asked for a summary, which is always
+// "This is a test message." since it never sees tool results.
+type summaryProvider struct {
+	mockProvider
+	calls int
+}
+
+func (p *summaryProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	p.calls++
+	return p.mockProvider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+}
+
+// contextWindowProvider rejects requests that are estimated to take up more
+// than limit tokens, like a model with a small context window.
+type contextWindowProvider struct {
+	mockProvider
+	limit    int
+	rejected int
+}
+
+func (p *contextWindowProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	if EstimateTokens(messages) > p.limit {
+		p.rejected++
+		return &errorMockStream{err: &HTTPError{StatusCode: 400, Status: "400", ErrorType: "invalid_request_error", Message: "prompt is too long"}}
+	}
+	return p.mockProvider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+}
+
+// longConversation returns n exchanges of a user message and an assistant
+// message calling a tool, followed by the tool's result, each about 100 tokens.
+func longConversation(n int) []Message {
+	text := strings.Repeat("word ", 80)
+	var messages []Message
+	for i := range n {
+		id := "call_" + string(rune('a'+i))
+		messages = append(messages,
+			Message{Role: "user", Content: content.FromText(text)},
+			Message{Role: "assistant", Content: content.FromText(text), ToolCalls: []ToolCall{{ID: id, Name: "test_tool", Arguments: json.RawMessage(`{}`)}}},
+			Message{Role: "tool", ToolCallID: id, ToolCallName: "test_tool", Content: content.FromText(text)},
+		)
+	}
+	return messages
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(nil))
+	assert.Equal(t, 4+3, EstimateTokens([]Message{{Role: "user", Content: content.FromText("Hello there")}}))
+	assert.Equal(t, 4+estimatedMediaTokens, EstimateTokens([]Message{{Role: "user", Content: content.Content{&content.ImageURL{URL: "https://example.com/a.png"}}}}))
+}
+
+// countingProvider counts tokens as one per message.
+type countingProvider struct {
+	mockProvider
+}
+
+func (p *countingProvider) CountTokens(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox) (int, error) {
+	return len(messages), nil
+}
+
+func TestCountTokens(t *testing.T) {
+	messages := []Message{{Role: "user", Content: content.FromText("Hello there")}}
+	toolbox := tools.Box(testTool)
+
+	// Providers that can't count fall back to an estimate, which includes the
+	// system prompt and the tools.
+	estimate, err := CountTokens(context.Background(), &mockProvider{}, content.FromText("Be nice"), messages, toolbox)
+	require.NoError(t, err)
+	assert.Equal(t, EstimateRequestTokens(content.FromText("Be nice"), messages, toolbox), estimate)
+	assert.Greater(t, estimate, EstimateTokens(messages)+4+2)
+
+	// Wrappers count with the provider they wrap.
+	for _, provider := range []Provider{
+		&countingProvider{},
+		LimitConcurrency(&countingProvider{}, 1),
+		NewFallback(&countingProvider{}, &mockProvider{}),
+	} {
+		count, err := CountTokens(context.Background(), provider, nil, messages, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count, "%T", provider)
+	}
+}
+
+func TestCompactionCutKeepsToolResultsWithTheirCalls(t *testing.T) {
+	messages := longConversation(5)
+	for keep := 0; keep < EstimateTokens(messages); keep += 50 {
+		cut := compactionCut(messages, keep)
+		require.Positive(t, cut, "keepTokens %d", keep)
+		assert.NotEqual(t, "tool", messages[cut].Role, "keepTokens %d", keep)
+	}
+	assert.Equal(t, -1, compactionCut(messages[:1], 0), "The only message can't be cut")
+}
+
+func TestCompactorBeforeResponse(t *testing.T) {
+	summarizer := &summaryProvider{}
+	compactor := NewCompactor(summarizer, 1000).WithKeepTokens(400)
+	messages := longConversation(5)
+
+	state := newBeforeResponseState(1, nil, messages)
+	require.NoError(t, compactor.BeforeResponse(context.Background(), state))
+	compacted := state.Messages()
+	require.Less(t, len(compacted), len(messages))
+	assert.LessOrEqual(t, EstimateTokens(compacted), 1000)
+	assert.Equal(t, "user", compacted[0].Role)
+	assert.True(t, strings.HasPrefix(textOf(t, compacted[0]), compactionSummaryPrefix+"This is a test message."))
+	assert.Equal(t, messages[len(messages)-1], compacted[len(compacted)-1], "Recent messages are kept verbatim")
+	assert.Equal(t, 1, summarizer.calls)
+
+	// The same messages are compacted again on the next turn, using the
+	// cached summary.
+	state = newBeforeResponseState(2, nil, append(cloneMessages(messages), Message{Role: "assistant", Content: content.FromText("Done")}))
+	require.NoError(t, compactor.BeforeResponse(context.Background(), state))
+	assert.Equal(t, 1, summarizer.calls)
+
+	// Conversations that fit are left alone.
+	state = newBeforeResponseState(1, nil, messages[:3])
+	require.NoError(t, compactor.BeforeResponse(context.Background(), state))
+	assert.Equal(t, messages[:3], state.Messages())
+}
+
+func TestCompactorUpdatesSummary(t *testing.T) {
+	summarizer := &summaryProvider{}
+	compactor := NewCompactor(summarizer, 1000).WithKeepTokens(400)
+	messages := longConversation(10)
+
+	state := newBeforeResponseState(1, nil, messages)
+	require.NoError(t, compactor.BeforeResponse(context.Background(), state))
+	require.Equal(t, 1, summarizer.calls)
+	firstCut, _, ok := compactor.latestSummary(messages)
+	require.True(t, ok)
+
+	// Once the conversation no longer fits with the summary, the summary is
+	// updated with only the messages it has to cover from then on.
+	messages = append(messages, longConversation(3)...)
+	state = newBeforeResponseState(2, nil, messages)
+	require.NoError(t, compactor.BeforeResponse(context.Background(), state))
+	require.Equal(t, 2, summarizer.calls)
+	assert.LessOrEqual(t, EstimateTokens(state.Messages()), 1000)
+
+	secondCut, _, ok := compactor.latestSummary(messages)
+	require.True(t, ok)
+	transcript := textOf(t, summarizer.messages[0])
+	assert.Contains(t, transcript, "<summary>\nThis is a test message.\n</summary>")
+	assert.Equal(t, secondCut-firstCut, strings.Count(transcript, "User:\n")+strings.Count(transcript, "Assistant:\n")+strings.Count(transcript, "Result of tool"),
+		"Only the messages after the previous cut are summarized")
+}
+
+func TestCompactionUsageCountsTowardsLLM(t *testing.T) {
+	llm := New(&mockProvider{}).WithCompactor(NewCompactor(&summaryProvider{}, 1000))
+	llm.lastSentMessages = longConversation(5)
+	var tracked []Usage
+	llm.TrackUsage = func(ctx context.Context, usage Usage, success bool) {
+		assert.True(t, success)
+		tracked = append(tracked, usage)
+	}
+
+	response, err := llm.Generate(context.Background(), content.FromText("Next"))
+	require.NoError(t, err)
+	require.Len(t, tracked, 2, "The summary and the turn")
+	assert.Equal(t, 40, llm.TotalUsage.InputTokens)
+	assert.Equal(t, tracked, response.Usage)
+}
+
+func TestCompactorKeepsHistoryIntact(t *testing.T) {
+	provider := &mockProvider{}
+	llm := New(provider).WithCompactor(NewCompactor(&summaryProvider{}, 1000).WithKeepTokens(200))
+	llm.lastSentMessages = longConversation(5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Next")
+	require.NoError(t, llm.Err())
+
+	assert.Less(t, len(provider.messages), 10, "The provider should see a compacted conversation")
+	assert.Len(t, llm.Messages(), 17, "The LLM keeps every message")
+}
+
+func TestCompactionRetriesRequestTooLarge(t *testing.T) {
+	summarizer := &summaryProvider{}
+	// The estimate says the conversation fits, but the provider disagrees.
+	provider := &contextWindowProvider{limit: 800}
+	llm := New(provider).WithCompactor(NewCompactor(summarizer, 10_000))
+	llm.lastSentMessages = longConversation(5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Next")
+	require.NoError(t, llm.Err())
+	assert.Equal(t, 1, provider.rejected)
+	assert.Equal(t, 1, summarizer.calls)
+	assert.Len(t, llm.Messages(), 17)
+
+	// Without a compactor, the error is returned.
+	llm = New(&contextWindowProvider{limit: 800})
+	llm.lastSentMessages = longConversation(5)
+	runTestChat(ctx, t, llm, "Next")
+	assert.True(t, isRequestTooLarge(llm.Err()))
+}
@@ -0,0 +1,142 @@
+package llms
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/flitsinc/go-llms/content"
+)
+
+// ContinuePrompt is sent as a user message to ask the model to continue a
+// partial response, for providers that don't support prefill.
+var ContinuePrompt = "Your response above is incomplete. Continue it exactly where it stops, without repeating anything or adding any preamble."
+
+// WithContinuation makes the LLM continue responses that were cut off at the
+// output token limit, up to maxContinuations times per turn, instead of
+// failing with ErrOutputTruncated. The continuation is streamed like the rest
+// of the response, and its text is joined with what came before into a single
+// assistant message. Providers that support prefill (see PrefillProvider)
+// continue the partial message directly; others are asked to with a
+// ContinuePrompt message, which doesn't become part of the conversation.
+//
+// Responses that were cut off in the middle of a tool call are not continued.
+func (l *LLM) WithContinuation(maxContinuations int) *LLM {
+	l.maxContinuations = maxContinuations
+	return l
+}
+
+// PrefillProvider is implemented by providers that can continue a trailing
+// assistant message rather than starting a new one.
+type PrefillProvider interface {
+	Provider
+	// SupportsPrefill reports whether the provider can currently continue a
+	// trailing assistant message, which may depend on its configuration.
+	SupportsPrefill() bool
+}
+
+func supportsPrefill(provider Provider) bool {
+	p, ok := provider.(PrefillProvider)
+	return ok && p.SupportsPrefill()
+}
+
+// truncatedError is returned by attemptTurn for a response that was cut off
+// and can be continued.
+type truncatedError struct {
+	message Message
+	err     error
+}
+
+func (e *truncatedError) Error() string { return e.err.Error() }
+func (e *truncatedError) Unwrap() error { return e.err }
+
+// continuationMessages returns the messages to send to continue the partial
+// assistant message.
+func (l *LLM) continuationMessages(messages []Message, partial Message) []Message {
+	messages = slices.Clip(messages)
+	if supportsPrefill(l.provider) {
+		// Providers reject prefill that ends in whitespace.
+		prefill := partial
+		prefill.Content = trimTrailingSpace(partial.Content)
+		if len(prefill.Content) == 0 {
+			return messages
+		}
+		return append(messages, prefill)
+	}
+	return append(messages, partial, Message{Role: "user", Content: content.FromText(ContinuePrompt)})
+}
+
+// mergeContinuation joins a partial assistant message and its continuation.
+// Like the text updates of the continuation, its text doesn't start with
+// whitespace if the partial message's text ends with some (see
+// trimsLeadingSpace).
+func mergeContinuation(partial, continuation Message) Message {
+	merged := cloneMessage(partial)
+	trim := trimsLeadingSpace(&partial)
+	for _, item := range continuation.Content {
+		if text, ok := item.(*content.Text); ok {
+			t := text.Text
+			if trim {
+				t = strings.TrimLeftFunc(t, unicode.IsSpace)
+				trim = t == ""
+			}
+			// Citations move along with the text they cite.
+			shift := merged.Content.TextLen() - (len(text.Text) - len(t))
+			merged.Content.Append(t)
+			for _, citation := range text.Citations {
+				citation.Start = max(citation.Start+shift, 0)
+				citation.End = max(citation.End+shift, 0)
+				merged.Content.AddCitation(citation)
+			}
+			continue
+		}
+		merged.Content = append(merged.Content, item)
+	}
+	merged.ToolCalls = append(merged.ToolCalls, continuation.ToolCalls...)
+	merged.StopReason = continuation.StopReason
+	for k, v := range continuation.Metadata {
+		if merged.Metadata == nil {
+			merged.Metadata = make(map[string]string)
+		}
+		merged.Metadata[k] = v
+	}
+	return merged
+}
+
+// trimsLeadingSpace reports whether the continuation of the partial message
+// leaves out the whitespace it starts with, because the partial message
+// already ends with some. Prefill can't end in whitespace, so models tend to
+// repeat it.
+func trimsLeadingSpace(partial *Message) bool {
+	if partial == nil {
+		return false
+	}
+	last := lastText(partial.Content)
+	return strings.TrimRightFunc(last, unicode.IsSpace) != last
+}
+
+// trimTrailingSpace returns a copy of the content without whitespace at the end
+// of its last text.
+func trimTrailingSpace(c content.Content) content.Content {
+	trimmed := slices.Clone(c)
+	if l := len(trimmed); l > 0 {
+		if text, ok := trimmed[l-1].(*content.Text); ok {
+			if t := strings.TrimRightFunc(text.Text, unicode.IsSpace); t != "" {
+				trimmed[l-1] = &content.Text{Text: t}
+			} else {
+				trimmed = trimmed[:l-1]
+			}
+		}
+	}
+	return trimmed
+}
+
+// lastText returns the text of the last item, if it's text.
+func lastText(c content.Content) string {
+	if l := len(c); l > 0 {
+		if text, ok := c[l-1].(*content.Text); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
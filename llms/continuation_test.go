@@ -0,0 +1,147 @@
+package llms
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// truncatingProvider responds with the given texts in turn, cutting off every
+// response but the last one at the output token limit.
+type truncatingProvider struct {
+	mockProvider
+	texts    []string
+	prefill  bool
+	requests [][]Message
+}
+
+func (p *truncatingProvider) SupportsPrefill() bool { return p.prefill }
+
+func (p *truncatingProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) ProviderStream {
+	calls := len(p.requests)
+	p.requests = append(p.requests, messages)
+	stream := &truncatingStream{mockStream: &mockStream{provider: &p.mockProvider, textToGenerate: p.texts[min(calls, len(p.texts)-1)]}}
+	stream.truncated = calls < len(p.texts)-1
+	return stream
+}
+
+// truncatingStream fails with ErrOutputTruncated once it has been iterated,
+// if truncated is set.
+type truncatingStream struct {
+	*mockStream
+	truncated bool
+	done      bool
+}
+
+func (s *truncatingStream) Iter() func(func(StreamStatus) bool) {
+	return func(yield func(StreamStatus) bool) {
+		s.mockStream.Iter()(yield)
+		s.done = true
+	}
+}
+
+func (s *truncatingStream) Err() error {
+	if s.truncated && s.done {
+		return fmt.Errorf("%w (stop_reason=%q)", ErrOutputTruncated, "max_tokens")
+	}
+	return nil
+}
+
+func (s *truncatingStream) StopReason() StopReason {
+	if s.truncated {
+		return StopReasonMaxTokens
+	}
+	return StopReasonEndTurn
+}
+
+func TestContinuationWithPrefill(t *testing.T) {
+	provider := &truncatingProvider{texts: []string{"The quick brown ", "fox jumps", " over the lazy dog."}, prefill: true}
+	llm := New(provider).WithContinuation(2)
+
+	var text string
+	for update := range llm.Chat("Write a pangram") {
+		if u, ok := update.(TextUpdate); ok {
+			text += u.Text
+		}
+	}
+	require.NoError(t, llm.Err())
+	assert.Equal(t, "The quick brown fox jumps over the lazy dog.", text)
+
+	require.Len(t, llm.Messages(), 2)
+	message := llm.Messages()[1]
+	assert.Equal(t, content.FromText("The quick brown fox jumps over the lazy dog."), message.Content)
+	assert.Equal(t, StopReasonEndTurn, message.StopReason)
+	assert.Equal(t, 3*30, llm.TotalUsage.OutputTokens)
+
+	// The partial response is sent as prefill, without trailing whitespace.
+	require.Len(t, provider.requests, 3)
+	require.Len(t, provider.requests[1], 2)
+	assert.Equal(t, "assistant", provider.requests[1][1].Role)
+	assert.Equal(t, content.FromText("The quick brown"), provider.requests[1][1].Content)
+	assert.Equal(t, content.FromText("The quick brown fox jumps"), provider.requests[2][1].Content)
+}
+
+func TestContinuationStreamMatchesHistory(t *testing.T) {
+	// The model repeats the space that was trimmed off the prefill.
+	provider := &truncatingProvider{texts: []string{"The quick brown ", "  fox."}, prefill: true}
+	llm := New(provider).WithContinuation(1)
+
+	var text string
+	for update := range llm.Chat("Write a pangram") {
+		if u, ok := update.(TextUpdate); ok {
+			text += u.Text
+		}
+	}
+	require.NoError(t, llm.Err())
+	assert.Equal(t, "The quick brown fox.", text)
+	assert.Equal(t, content.FromText(text), llm.Messages()[1].Content)
+}
+
+func TestContinuationWithoutPrefill(t *testing.T) {
+	provider := &truncatingProvider{texts: []string{"The quick brown", " fox."}}
+	llm := New(provider).WithContinuation(1)
+
+	runTestChat(context.Background(), t, llm, "Write a pangram")
+	require.NoError(t, llm.Err())
+	require.Len(t, llm.Messages(), 2, "The continue prompt isn't part of the conversation")
+	assert.Equal(t, content.FromText("The quick brown fox."), llm.Messages()[1].Content)
+
+	require.Len(t, provider.requests, 2)
+	require.Len(t, provider.requests[1], 3)
+	assert.Equal(t, content.FromText("The quick brown"), provider.requests[1][1].Content)
+	assert.Equal(t, "user", provider.requests[1][2].Role)
+	assert.Equal(t, content.FromText(ContinuePrompt), provider.requests[1][2].Content)
+}
+
+func TestContinuationLimit(t *testing.T) {
+	provider := &truncatingProvider{texts: []string{"One", " two", " three"}, prefill: true}
+	llm := New(provider).WithContinuation(1)
+
+	runTestChat(context.Background(), t, llm, "Count")
+	assert.ErrorIs(t, llm.Err(), ErrOutputTruncated)
+	assert.Len(t, provider.requests, 2)
+	assert.Len(t, llm.Messages(), 1)
+
+	// Without continuation, the first truncation fails the chat.
+	provider = &truncatingProvider{texts: []string{"One", " two"}, prefill: true}
+	llm = New(provider)
+	runTestChat(context.Background(), t, llm, "Count")
+	assert.ErrorIs(t, llm.Err(), ErrOutputTruncated)
+	assert.Len(t, provider.requests, 1)
+}
+
+func TestSupportsPrefillThroughWrappers(t *testing.T) {
+	prefill := &truncatingProvider{prefill: true}
+	noPrefill := &truncatingProvider{}
+	assert.True(t, supportsPrefill(LimitConcurrency(prefill, 1)))
+	assert.False(t, supportsPrefill(LimitConcurrency(noPrefill, 1)))
+	assert.True(t, supportsPrefill(NewFallback(prefill, LimitConcurrency(prefill, 1))))
+	assert.False(t, supportsPrefill(NewFallback(prefill, noPrefill)))
+	assert.False(t, supportsPrefill(&mockProvider{}))
+}
@@ -0,0 +1,128 @@
+package llms
+
+import "context"
+
+// CostCalculator prices the usage of a single request, in dollars. See the
+// pricing package for one that knows the prices of common models.
+type CostCalculator interface {
+	// Cost returns the cost of the usage of a request to the given model, or
+	// false if the model's price isn't known.
+	Cost(company, model string, usage Usage) (float64, bool)
+}
+
+// Price is what a model charges, in dollars per million tokens. Tokens with a
+// zero price are free.
+type Price struct {
+	Input              float64 `json:"input"`
+	CachedInput        float64 `json:"cached_input,omitempty"`
+	CacheCreationInput float64 `json:"cache_creation_input,omitempty"`
+	// LongCacheCreationInput is the price of writes to a long-lived (1 hour)
+	// cache. CacheCreationInput applies to them if it's zero.
+	LongCacheCreationInput float64 `json:"long_cache_creation_input,omitempty"`
+	Output                 float64 `json:"output"`
+
+	// InputIncludesCached is set for providers whose InputTokens include the
+	// CachedInputTokens, like OpenAI and Google. Anthropic reports cache
+	// reads and writes separately from InputTokens.
+	InputIncludesCached bool `json:"input_includes_cached,omitempty"`
+
+	// LongContext, if set, is the price of requests whose prompt is longer
+	// than LongContextThreshold tokens, counting cache reads and writes.
+	LongContextThreshold int    `json:"long_context_threshold,omitempty"`
+	LongContext          *Price `json:"long_context,omitempty"`
+}
+
+// Cost returns the cost of the usage of a single request at this price.
+func (p Price) Cost(usage Usage) float64 {
+	if p.LongContext != nil && p.promptTokens(usage) > p.LongContextThreshold {
+		long := *p.LongContext
+		long.InputIncludesCached = p.InputIncludesCached
+		long.LongContext = nil
+		return long.Cost(usage)
+	}
+	input := usage.InputTokens
+	if p.InputIncludesCached {
+		input -= usage.CachedInputTokens
+	}
+	longCacheCreationInput := p.LongCacheCreationInput
+	if longCacheCreationInput == 0 {
+		longCacheCreationInput = p.CacheCreationInput
+	}
+	shortCacheCreation := usage.CacheCreationInputTokens - usage.LongCacheCreationInputTokens
+	total := float64(input)*p.Input +
+		float64(usage.CachedInputTokens)*p.CachedInput +
+		float64(shortCacheCreation)*p.CacheCreationInput +
+		float64(usage.LongCacheCreationInputTokens)*longCacheCreationInput +
+		float64(usage.OutputTokens)*p.Output
+	return total / 1_000_000
+}
+
+func (p Price) promptTokens(usage Usage) int {
+	if p.InputIncludesCached {
+		return usage.InputTokens + usage.CacheCreationInputTokens
+	}
+	return usage.InputTokens + usage.CachedInputTokens + usage.CacheCreationInputTokens
+}
+
+// PriceTable is a CostCalculator with a fixed price per model name.
+type PriceTable map[string]Price
+
+func (t PriceTable) Cost(company, model string, usage Usage) (float64, bool) {
+	price, ok := t[model]
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(usage), true
+}
+
+// WithPricing makes the LLM fill in the Cost of the usage of each request,
+// which adds up in TotalUsage and is passed to TrackUsage.
+func (l *LLM) WithPricing(prices CostCalculator) *LLM {
+	l.pricing = prices
+	return l
+}
+
+// priceUsage fills in the cost of the usage of a request to the provider.
+func (l *LLM) priceUsage(provider Provider, stream ProviderStream, usage Usage) Usage {
+	if l.pricing == nil {
+		return usage
+	}
+	company, model := provider.Company(), provider.Model()
+	// Wrapping providers such as FallbackProvider report the provider that
+	// actually answered on the stream.
+	if s, ok := stream.(interface{ Company() string }); ok {
+		company = s.Company()
+	}
+	if s, ok := stream.(interface{ Model() string }); ok {
+		model = s.Model()
+	}
+	if cost, ok := l.pricing.Cost(company, model, usage); ok {
+		usage.Cost = cost
+	}
+	return usage
+}
+
+// addUsage adds the priced usage of a request to TotalUsage, and reports it to
+// TrackUsage.
+func (l *LLM) addUsage(ctx context.Context, usage Usage, success bool) {
+	l.TotalUsage.Add(usage)
+	if l.usageSink != nil {
+		l.usageSink(usage)
+	}
+	if l.TrackUsage != nil {
+		l.TrackUsage(ctx, usage, success)
+	}
+}
+
+// usageReporterContextKey carries the function that requests made on behalf
+// of an LLM through another provider, such as the summaries of a Compactor,
+// report their usage to, so that it counts towards the LLM's usage and budget.
+var usageReporterContextKey = &contextKey{"usage-reporter"}
+
+// reportUsage reports the usage of a request made to provider on behalf of
+// the LLM whose context ctx is, if any.
+func reportUsage(ctx context.Context, provider Provider, stream ProviderStream, success bool) {
+	if report, ok := ctx.Value(usageReporterContextKey).(func(Provider, ProviderStream, bool)); ok {
+		report(provider, stream, success)
+	}
+}
@@ -0,0 +1,66 @@
+package llms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriceCost(t *testing.T) {
+	price := Price{Input: 1, CachedInput: 0.5, CacheCreationInput: 2, LongCacheCreationInput: 3, Output: 4}
+	usage := Usage{InputTokens: 1e6, CachedInputTokens: 1e6, CacheCreationInputTokens: 2e6, LongCacheCreationInputTokens: 1e6, OutputTokens: 1e6}
+	assert.InDelta(t, 1+0.5+2+3+4, price.Cost(usage), 1e-9)
+
+	price.LongCacheCreationInput = 0
+	assert.InDelta(t, 1+0.5+2+2+4, price.Cost(usage), 1e-9, "Long cache writes cost the same as short ones without a price of their own")
+
+	price = Price{Input: 1, CachedInput: 0.5, Output: 4, InputIncludesCached: true}
+	assert.InDelta(t, 0.5+0.25+4, price.Cost(Usage{InputTokens: 1e6, CachedInputTokens: 5e5, OutputTokens: 1e6}), 1e-9)
+
+	price.LongContextThreshold = 1e6
+	price.LongContext = &Price{Input: 10, CachedInput: 5, Output: 40}
+	assert.InDelta(t, 0.5+0.25+4, price.Cost(Usage{InputTokens: 1e6, CachedInputTokens: 5e5, OutputTokens: 1e6}), 1e-9)
+	assert.InDelta(t, 5+5+40, price.Cost(Usage{InputTokens: 1e6 + 5e5, CachedInputTokens: 1e6, OutputTokens: 1e6}), 1e-9)
+}
+
+func TestWithPricingTracksCost(t *testing.T) {
+	var costs []float64
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool).
+		WithPricing(PriceTable{"test-model": {Input: 1000, Output: 1000}})
+	llm.TrackUsage = func(ctx context.Context, usage Usage, success bool) {
+		costs = append(costs, usage.Cost)
+	}
+	var afterResponseCosts []float64
+	llm.AfterResponse = func(ctx context.Context, state AfterResponseState) error {
+		afterResponseCosts = append(afterResponseCosts, state.Usage().Cost)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Use the tool")
+	require.NoError(t, llm.Err())
+	// 20 input and 30 output tokens per request.
+	assert.InDeltaSlice(t, []float64{0.05, 0.05}, costs, 1e-9)
+	assert.Equal(t, costs, afterResponseCosts, "AfterResponse sees the same cost")
+	assert.InDelta(t, 0.1, llm.TotalUsage.Cost, 1e-9)
+}
+
+func TestUsageAdd(t *testing.T) {
+	usage := Usage{InputTokens: 10, OutputTokens: 5, ReasoningTokens: 2, WebSearchRequests: 1, Cost: 0.5}
+	usage.Add(Usage{
+		CachedInputTokens: 1, CacheCreationInputTokens: 2, LongCacheCreationInputTokens: 1,
+		InputTokens: 10, OutputTokens: 5, ReasoningTokens: 3,
+		AudioInputTokens: 4, ImageInputTokens: 5, AudioOutputTokens: 6, ImageOutputTokens: 7,
+		ToolUsePromptTokens: 8, WebSearchRequests: 2, CodeExecutionRequests: 3, Cost: 0.25,
+	})
+	assert.Equal(t, Usage{
+		CachedInputTokens: 1, CacheCreationInputTokens: 2, LongCacheCreationInputTokens: 1,
+		InputTokens: 20, OutputTokens: 10, ReasoningTokens: 5,
+		AudioInputTokens: 4, ImageInputTokens: 5, AudioOutputTokens: 6, ImageOutputTokens: 7,
+		ToolUsePromptTokens: 8, WebSearchRequests: 3, CodeExecutionRequests: 3, Cost: 0.75,
+	}, usage)
+}
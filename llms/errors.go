@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ErrOutputTruncated is returned when a model's output is cut short because it
@@ -20,6 +23,7 @@ type HTTPError struct {
 	ErrorType  string            // Provider-specific error type (e.g., "rate_limit_error")
 	Message    string            // Human-readable error message
 	Metadata   HTTPErrorMetadata // Optional upstream-provider diagnostics
+	RetryAfter time.Duration     // How long the provider asked us to wait before retrying, if it said
 }
 
 // HTTPErrorMetadata contains upstream-provider diagnostics returned through a gateway.
@@ -66,3 +70,67 @@ func isRequestTooLargeMessage(msg string) bool {
 	return strings.Contains(msg, "prompt is too long") ||
 		strings.Contains(msg, "maximum context length")
 }
+
+// IsTransient reports whether the error is likely to go away if the same
+// request is made again later: rate limits, overloaded or unavailable servers,
+// timeouts and other 5xx responses.
+//
+// Status codes are checked first. Errors reported in the middle of a stream
+// have no status code of their own, so the provider's error type is checked
+// as well (e.g. Anthropic's "overloaded_error" SSE event, or Google's
+// "RESOURCE_EXHAUSTED").
+func (e *HTTPError) IsTransient() bool {
+	if isTransientStatusCode(e.StatusCode) || isTransientStatusCode(e.Metadata.RawErrorStatusCode) {
+		return true
+	}
+	return isTransientErrorType(e.ErrorType) || isTransientErrorType(e.Metadata.RawErrorType)
+}
+
+func isTransientStatusCode(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case 529: // Anthropic's "overloaded"
+		return true
+	}
+	return code >= 500 && code != http.StatusNotImplemented && code != http.StatusHTTPVersionNotSupported
+}
+
+func isTransientErrorType(errorType string) bool {
+	switch errorType {
+	case "overloaded_error", "rate_limit_error", "api_error", // Anthropic
+		"RESOURCE_EXHAUSTED", "UNAVAILABLE", "INTERNAL", "DEADLINE_EXCEEDED", // Google
+		"server_error", "rate_limit_exceeded": // OpenAI
+		return true
+	}
+	return false
+}
+
+// ParseRetryAfter returns how long the provider asked clients to wait before
+// retrying, based on the response headers. It understands the standard
+// Retry-After header (in seconds or as an HTTP date) as well as the
+// millisecond-precision retry-after-ms header sent by OpenAI. It returns 0 if
+// there is no usable hint.
+func ParseRetryAfter(header http.Header) time.Duration {
+	if ms := header.Get("Retry-After-Ms"); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil && n > 0 {
+			return time.Duration(n * float64(time.Millisecond))
+		}
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -1,7 +1,9 @@
 package llms
 
 import (
+	"net/http"
 	"testing"
+	"time"
 )
 
 func TestIsRequestTooLarge(t *testing.T) {
@@ -113,3 +115,61 @@ func TestIsRequestTooLarge(t *testing.T) {
 		})
 	}
 }
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  HTTPError
+		want bool
+	}{
+		{name: "429", err: HTTPError{StatusCode: 429}, want: true},
+		{name: "Anthropic 529 overloaded", err: HTTPError{StatusCode: 529}, want: true},
+		{name: "503", err: HTTPError{StatusCode: 503}, want: true},
+		{name: "500", err: HTTPError{StatusCode: 500}, want: true},
+		{name: "501 not implemented", err: HTTPError{StatusCode: 501}, want: false},
+		{name: "400", err: HTTPError{StatusCode: 400, ErrorType: "invalid_request_error"}, want: false},
+		{name: "401", err: HTTPError{StatusCode: 401}, want: false},
+		{name: "mid-stream overloaded_error", err: HTTPError{ErrorType: "overloaded_error"}, want: true},
+		{name: "Google RESOURCE_EXHAUSTED", err: HTTPError{ErrorType: "RESOURCE_EXHAUSTED"}, want: true},
+		{
+			name: "upstream 503 via gateway",
+			err:  HTTPError{StatusCode: 400, Metadata: HTTPErrorMetadata{RawErrorStatusCode: 503}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.IsTransient(); got != tt.want {
+				t.Errorf("IsTransient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "missing", header: http.Header{}, want: 0},
+		{name: "seconds", header: http.Header{"Retry-After": {"3"}}, want: 3 * time.Second},
+		{name: "milliseconds", header: http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"1"}}, want: 250 * time.Millisecond},
+		{name: "garbage", header: http.Header{"Retry-After": {"soon"}}, want: 0},
+		{name: "date in the past", header: http.Header{"Retry-After": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRetryAfter(tt.header); got != tt.want {
+				t.Errorf("ParseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	future := http.Header{"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}
+	if got := ParseRetryAfter(future); got <= 0 || got > time.Minute {
+		t.Errorf("ParseRetryAfter(date) = %v, want within a minute", got)
+	}
+}
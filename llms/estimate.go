@@ -0,0 +1,102 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+const (
+	// estimatedCharsPerToken is the usual rule of thumb for English text and
+	// code with the tokenizers of current models.
+	estimatedCharsPerToken = 4
+	// estimatedMediaTokens is what an image, audio clip, video or document
+	// counts as. Real costs vary wildly with resolution, duration and page
+	// count; this is in the range of a typical screenshot.
+	estimatedMediaTokens = 1000
+	// estimatedMessageOverheadTokens covers role markers and other framing.
+	estimatedMessageOverheadTokens = 4
+)
+
+// EstimateTokens returns a rough estimate of how many input tokens the
+// messages take up, without calling any API. It's meant for decisions such as
+// when to compact a conversation, not for billing: expect it to be off by 20%
+// or more depending on the language and the model's tokenizer.
+func EstimateTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += estimateMessageTokens(msg)
+	}
+	return total
+}
+
+// TokenCounter is implemented by providers that can count the input tokens of
+// a request, as Generate would send it, without running the request.
+type TokenCounter interface {
+	CountTokens(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox) (int, error)
+}
+
+// CountTokens counts the input tokens of a request with the provider if it's
+// a TokenCounter, and estimates them with EstimateRequestTokens otherwise.
+func CountTokens(ctx context.Context, provider Provider, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox) (int, error) {
+	if counter, ok := provider.(TokenCounter); ok {
+		return counter.CountTokens(ctx, systemPrompt, messages, toolbox)
+	}
+	return EstimateRequestTokens(systemPrompt, messages, toolbox), nil
+}
+
+// EstimateRequestTokens is like EstimateTokens, but also counts the system
+// prompt and the definitions of the tools in the toolbox.
+func EstimateRequestTokens(systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox) int {
+	total := EstimateTokens(messages)
+	if systemPrompt != nil {
+		total += estimatedMessageOverheadTokens + EstimateContentTokens(systemPrompt)
+	}
+	if toolbox != nil {
+		for _, tool := range toolbox.All() {
+			if g, ok := tool.Grammar().(tools.JSONGrammar); ok {
+				if data, err := json.Marshal(g.Schema()); err == nil {
+					total += estimateTextTokens(len(data))
+					continue
+				}
+			}
+			total += estimateTextTokens(len(tool.FuncName()) + len(tool.Description()))
+		}
+	}
+	return total
+}
+
+func estimateMessageTokens(msg Message) int {
+	tokens := estimatedMessageOverheadTokens + EstimateContentTokens(msg.Content)
+	for _, toolCall := range msg.ToolCalls {
+		tokens += estimateTextTokens(len(toolCall.Name) + len(toolCall.Arguments))
+	}
+	return tokens
+}
+
+// EstimateContentTokens is like EstimateTokens for a single piece of content.
+func EstimateContentTokens(c content.Content) int {
+	tokens := 0
+	for _, item := range c {
+		switch v := item.(type) {
+		case *content.Text:
+			tokens += estimateTextTokens(len(v.Text))
+		case *content.JSON:
+			tokens += estimateTextTokens(len(v.Data))
+		case *content.Thought:
+			// Encrypted reasoning is sent back as is, and counts as input.
+			tokens += estimateTextTokens(len(v.Text) + len(v.Encrypted))
+		case *content.ServerTool:
+			tokens += estimateTextTokens(len(v.Data))
+		case *content.ImageURL, *content.AudioURL, *content.VideoURL, *content.Document:
+			tokens += estimatedMediaTokens
+		}
+	}
+	return tokens
+}
+
+func estimateTextTokens(chars int) int {
+	return (chars + estimatedCharsPerToken - 1) / estimatedCharsPerToken
+}
@@ -0,0 +1,195 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// fallbackProviderMetadataKey records which provider produced an assistant
+// message, as "company/model", so provider-specific content in it can be
+// withheld from the others.
+const fallbackProviderMetadataKey = "fallback:provider"
+
+// ShouldFallback is the default policy of a FallbackProvider. It falls through
+// to the next provider on rate limits, overloaded or failing servers, and
+// requests that are too large for the model.
+func ShouldFallback(err error) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	return httpErr.IsTransient() || httpErr.IsRequestTooLarge()
+}
+
+// FallbackProvider is a Provider that tries an ordered list of providers,
+// moving on to the next one when a request fails with an error that matches
+// its policy (ShouldFallback by default).
+//
+// Each provider translates the conversation on its own, so messages are passed
+// along as they are with one exception: thoughts from an assistant message
+// another provider produced are dropped, since their signatures are only
+// meaningful to the provider that issued them. Tool call IDs are preserved.
+//
+// The stream returned by Generate reports the provider that actually answered
+// through its Company() and Model() methods. The FallbackProvider's own
+// Company() and Model() also report the provider that answered most recently,
+// so a TrackUsage callback that asks the provider attributes the turn to the
+// right one.
+type FallbackProvider struct {
+	providers []Provider
+	policy    func(error) bool
+
+	mu       sync.Mutex
+	answered Provider
+}
+
+// NewFallback creates a provider that falls through the given providers in
+// order. It panics if no providers are given.
+func NewFallback(providers ...Provider) *FallbackProvider {
+	if len(providers) == 0 {
+		panic("NewFallback requires at least one provider")
+	}
+	return &FallbackProvider{
+		providers: providers,
+		policy:    ShouldFallback,
+	}
+}
+
+// WithPolicy sets the function that decides whether an error from one
+// provider should be retried with the next one.
+func (f *FallbackProvider) WithPolicy(policy func(error) bool) *FallbackProvider {
+	f.policy = policy
+	return f
+}
+
+// Providers returns the providers in the order they are tried.
+func (f *FallbackProvider) Providers() []Provider {
+	return f.providers
+}
+
+func (f *FallbackProvider) current() Provider {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.answered != nil {
+		return f.answered
+	}
+	return f.providers[0]
+}
+
+func (f *FallbackProvider) Company() string { return f.current().Company() }
+
+func (f *FallbackProvider) Model() string { return f.current().Model() }
+
+// SupportsPrefill reports whether every provider supports prefill, since any of
+// them may end up answering.
+func (f *FallbackProvider) SupportsPrefill() bool {
+	for _, p := range f.providers {
+		if !supportsPrefill(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// CountTokens counts with the first provider, which is the one that's tried
+// first.
+func (f *FallbackProvider) CountTokens(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox) (int, error) {
+	p := f.providers[0]
+	return CountTokens(ctx, p, systemPrompt, messagesForProvider(p, messages), toolbox)
+}
+
+func (f *FallbackProvider) SetHTTPClient(client *http.Client) {
+	for _, p := range f.providers {
+		p.SetHTTPClient(client)
+	}
+}
+
+func (f *FallbackProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	var stream ProviderStream
+	for i, p := range f.providers {
+		stream = p.Generate(ctx, systemPrompt, messagesForProvider(p, messages), toolbox, jsonOutputSchema)
+		err := stream.Err()
+		if err == nil {
+			f.mu.Lock()
+			f.answered = p
+			f.mu.Unlock()
+			return &fallbackStream{wrappedStream{ProviderStream: stream, provider: p}}
+		}
+		if i == len(f.providers)-1 || ctx.Err() != nil || !f.policy(err) {
+			break
+		}
+	}
+	return stream
+}
+
+func providerKey(p Provider) string {
+	return p.Company() + "/" + p.Model()
+}
+
+// messagesForProvider drops the thoughts of assistant messages that a
+// different provider produced. Messages are only copied when something in
+// them has to change.
+func messagesForProvider(p Provider, messages []Message) []Message {
+	key := providerKey(p)
+	var result []Message
+	for i, msg := range messages {
+		origin, ok := msg.Metadata[fallbackProviderMetadataKey]
+		if !ok || origin == key || !hasThoughts(msg.Content) {
+			if result != nil {
+				result = append(result, msg)
+			}
+			continue
+		}
+		if result == nil {
+			result = append(make([]Message, 0, len(messages)), messages[:i]...)
+		}
+		filtered := make(content.Content, 0, len(msg.Content))
+		for _, item := range msg.Content {
+			if _, isThought := item.(*content.Thought); !isThought {
+				filtered = append(filtered, item)
+			}
+		}
+		msg.Content = filtered
+		result = append(result, msg)
+	}
+	if result == nil {
+		return messages
+	}
+	return result
+}
+
+func hasThoughts(c content.Content) bool {
+	for _, item := range c {
+		if _, ok := item.(*content.Thought); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackStream wraps the stream of the provider that answered.
+type fallbackStream struct {
+	wrappedStream
+}
+
+func (s *fallbackStream) Message() Message {
+	msg := s.ProviderStream.Message()
+	metadata := make(map[string]string, len(msg.Metadata)+1)
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	metadata[fallbackProviderMetadataKey] = providerKey(s.provider)
+	msg.Metadata = metadata
+	return msg
+}
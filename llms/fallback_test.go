@@ -0,0 +1,141 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// namedProvider is a mockProvider with its own identity that can be made to
+// fail every request.
+type namedProvider struct {
+	mockProvider
+	company, model string
+	err            error
+	calls          int
+}
+
+func (p *namedProvider) Company() string { return p.company }
+func (p *namedProvider) Model() string   { return p.model }
+
+func (p *namedProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	p.calls++
+	if p.err != nil {
+		p.messages = messages
+		return &errorMockStream{err: p.err}
+	}
+	return p.mockProvider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+}
+
+func TestFallbackFallsThroughOnPolicyErrors(t *testing.T) {
+	first := &namedProvider{company: "A", model: "a-1", err: &HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429"}}
+	second := &namedProvider{company: "B", model: "b-1", err: &HTTPError{StatusCode: http.StatusBadRequest, Message: "prompt is too long: 300000 tokens"}}
+	third := &namedProvider{company: "C", model: "c-1"}
+	fallback := NewFallback(first, second, third)
+
+	llm := New(fallback)
+	var trackedModel string
+	llm.TrackUsage = func(context.Context, Usage, bool) { trackedModel = fallback.Model() }
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Hello")
+
+	require.NoError(t, llm.Err())
+	assert.Equal(t, 1, first.calls)
+	assert.Equal(t, 1, second.calls)
+	assert.Equal(t, 1, third.calls)
+	assert.Equal(t, "C", fallback.Company())
+	assert.Equal(t, "c-1", trackedModel)
+
+	reply := llm.lastSentMessages[len(llm.lastSentMessages)-1]
+	assert.Equal(t, "C/c-1", reply.Metadata[fallbackProviderMetadataKey])
+}
+
+func TestFallbackStopsOnOtherErrors(t *testing.T) {
+	httpErr := &HTTPError{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"}
+	first := &namedProvider{company: "A", model: "a-1", err: httpErr}
+	second := &namedProvider{company: "B", model: "b-1"}
+	fallback := NewFallback(first, second)
+
+	stream := fallback.Generate(context.Background(), nil, nil, nil, nil)
+	require.ErrorIs(t, stream.Err(), httpErr)
+	assert.Equal(t, 0, second.calls)
+	assert.Equal(t, "A", fallback.Company(), "Nothing answered yet, so the first provider is reported")
+
+	fallback.WithPolicy(func(error) bool { return true })
+	stream = fallback.Generate(context.Background(), nil, nil, nil, nil)
+	require.NoError(t, stream.Err())
+	identified, ok := stream.(interface {
+		Company() string
+		Model() string
+	})
+	require.True(t, ok, "The stream should say which provider answered")
+	assert.Equal(t, "B", identified.Company())
+	assert.Equal(t, "b-1", identified.Model())
+}
+
+func TestFallbackReturnsLastError(t *testing.T) {
+	lastErr := &HTTPError{StatusCode: http.StatusServiceUnavailable, Status: "503"}
+	fallback := NewFallback(
+		&namedProvider{company: "A", model: "a-1", err: &HTTPError{StatusCode: http.StatusServiceUnavailable}},
+		&namedProvider{company: "B", model: "b-1", err: lastErr},
+	)
+	stream := fallback.Generate(context.Background(), nil, nil, nil, nil)
+	assert.ErrorIs(t, stream.Err(), lastErr)
+}
+
+func TestFallbackDropsForeignThoughts(t *testing.T) {
+	signed := &content.Thought{Text: "Hmm", Signature: "sig-from-a"}
+	messages := []Message{
+		{Role: "user", Content: content.FromText("Hi")},
+		{
+			Role:      "assistant",
+			Content:   content.Content{signed, &content.Text{Text: "Calling a tool"}},
+			ToolCalls: []ToolCall{{ID: "call_1", Name: "test_tool", Arguments: []byte(`{}`)}},
+			Metadata:  map[string]string{fallbackProviderMetadataKey: "A/a-1"},
+		},
+		{Role: "tool", ToolCallID: "call_1", Content: content.FromText("done")},
+	}
+
+	first := &namedProvider{company: "A", model: "a-1", err: &HTTPError{StatusCode: 529}}
+	second := &namedProvider{company: "B", model: "b-1"}
+	stream := NewFallback(first, second).Generate(context.Background(), nil, messages, nil, nil)
+	require.NoError(t, stream.Err())
+
+	// The provider that produced the thought gets it back.
+	assert.Equal(t, messages, first.messages)
+
+	// The other one doesn't, but everything else is intact.
+	require.Len(t, second.messages, 3)
+	assistant := second.messages[1]
+	assert.Equal(t, content.Content{&content.Text{Text: "Calling a tool"}}, assistant.Content)
+	assert.Equal(t, "call_1", assistant.ToolCalls[0].ID)
+	assert.Equal(t, "call_1", second.messages[2].ToolCallID)
+
+	// The caller's history is left alone.
+	assert.Len(t, messages[1].Content, 2)
+}
+
+func TestShouldFallback(t *testing.T) {
+	assert.True(t, ShouldFallback(&HTTPError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, ShouldFallback(&HTTPError{ErrorType: "overloaded_error"}))
+	assert.True(t, ShouldFallback(&HTTPError{StatusCode: http.StatusBadGateway}))
+	assert.True(t, ShouldFallback(&HTTPError{StatusCode: http.StatusRequestEntityTooLarge}))
+	assert.False(t, ShouldFallback(&HTTPError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, ShouldFallback(errors.New("boom")))
+}
@@ -0,0 +1,96 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoUserMessage is returned when rewinding or regenerating a conversation
+// that doesn't have enough user messages to go back to.
+var ErrNoUserMessage = errors.New("not enough user messages in the conversation")
+
+// Fork returns an independent copy of the LLM, including a deep copy of the
+// conversation so far, that can continue the conversation in a different
+// direction without affecting this one. The provider and toolbox are shared
+// rather than copied, so tools added to either LLM are visible to both. It must
+// not be called while a chat is in progress.
+func (l *LLM) Fork() *LLM {
+	fork := *l
+	fork.lastSentMessages = cloneMessages(l.lastSentMessages)
+	fork.runningToolCalls = &runningToolCalls{}
+	return &fork
+}
+
+// Messages returns the conversation so far. The returned slice must not be
+// modified.
+func (l *LLM) Messages() []Message {
+	return l.lastSentMessages
+}
+
+// Rewind removes the last n user messages from the conversation, along with
+// everything that came after each of them, so the conversation continues as if
+// they had never been sent. For example, to see what would have happened had
+// the user said something else:
+//
+//	alt := llm.Fork()
+//	if err := alt.Rewind(1); err != nil { ... }
+//	updates := alt.ChatUsingContent(ctx, content.FromText("Something else"))
+//
+// Since a tool result always follows the assistant message that called the
+// tool, cutting before a user message never separates the two. It must not be
+// called while a chat is in progress.
+func (l *LLM) Rewind(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	index, err := l.nthLastUserMessage(n)
+	if err != nil {
+		return err
+	}
+	l.truncate(index)
+	return nil
+}
+
+// Regenerate discards the response to the last user message, including any
+// tool calls and their results, and asks the model to respond to it again. It
+// returns a channel of updates just like ChatUsingMessages.
+func (l *LLM) Regenerate(ctx context.Context) <-chan Update {
+	index, err := l.nthLastUserMessage(1)
+	if err != nil {
+		l.err = err
+		updateChan := make(chan Update)
+		close(updateChan)
+		return updateChan
+	}
+	l.truncate(index + 1)
+	return l.ChatUsingMessages(ctx, l.lastSentMessages)
+}
+
+// truncate removes the messages from index on. Each turn added one assistant
+// message, so the turns that produced the removed ones no longer count towards
+// the maximum.
+func (l *LLM) truncate(index int) {
+	for _, message := range l.lastSentMessages[index:] {
+		if message.Role == "assistant" && l.turns > 0 {
+			l.turns--
+		}
+	}
+	l.lastSentMessages = l.lastSentMessages[:index:index]
+}
+
+// nthLastUserMessage returns the index of the n-th user message counting back
+// from the end of the conversation.
+func (l *LLM) nthLastUserMessage(n int) (int, error) {
+	seen := 0
+	for i := len(l.lastSentMessages) - 1; i >= 0; i-- {
+		if l.lastSentMessages[i].Role != "user" {
+			continue
+		}
+		seen++
+		if seen == n {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: wanted %d, found %d", ErrNoUserMessage, n, seen)
+}
@@ -0,0 +1,164 @@
+package llms
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+func textOf(t *testing.T, msg Message) string {
+	t.Helper()
+	require.NotEmpty(t, msg.Content)
+	text, ok := msg.Content[0].(*content.Text)
+	require.True(t, ok, "First content item should be text")
+	return text.Text
+}
+
+func TestFork(t *testing.T) {
+	provider := &mockProvider{toolCallsToMake: []string{"test_tool"}}
+	llm := New(provider, testTool).WithMaxTurns(10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "First")
+	require.NoError(t, llm.Err())
+	require.Len(t, llm.Messages(), 4)
+
+	fork := llm.Fork()
+	assert.Equal(t, llm.Messages(), fork.Messages())
+	assert.Same(t, llm.Toolbox(), fork.Toolbox())
+	assert.Equal(t, llm.TotalUsage, fork.TotalUsage)
+
+	// Changes to the fork's history don't leak into the original.
+	fork.lastSentMessages[0].Content[0].(*content.Text).Text = "Changed"
+	assert.Equal(t, "First", textOf(t, llm.Messages()[0]))
+
+	runTestChat(ctx, t, fork, "Second")
+	require.NoError(t, fork.Err())
+	assert.Len(t, fork.Messages(), 6)
+	assert.Len(t, llm.Messages(), 4)
+}
+
+type nopDebugger struct{}
+
+func (nopDebugger) RawRequest(string, []byte) {}
+func (nopDebugger) RawEvent([]byte)           {}
+
+func TestForkCopiesEverything(t *testing.T) {
+	llm := New(&mockProvider{}, testTool).
+		WithMaxTurns(10).
+		WithRetry(DefaultRetryPolicy).
+		WithParallelToolCalls(2).
+		WithCompactor(NewCompactor(&mockProvider{}, 1000)).
+		WithBudget(Budget{MaxCost: 1}).
+		WithPricing(PriceTable{"test-model": {Input: 1}}).
+		WithContinuation(1).
+		WithDebugger(nopDebugger{})
+	llm.SystemPrompt = func() content.Content { return content.FromText("Be brief") }
+	llm.TrackTTFT = func(context.Context, time.Duration) {}
+	llm.TrackUsage = func(context.Context, Usage, bool) {}
+	llm.RequiresApproval = func(context.Context, ToolCall, tools.Tool) bool { return false }
+	llm.BeforeResponse = func(context.Context, BeforeResponseState) error { return nil }
+	llm.AfterResponse = func(context.Context, AfterResponseState) error { return nil }
+	llm.AfterToolCall = func(_ context.Context, _ ToolCall, result tools.Result) (tools.Result, error) { return result, nil }
+	runTestChat(context.Background(), t, llm, "First")
+	require.NoError(t, llm.Err())
+
+	// Every setting carries over, so a field added to LLM later can't be
+	// forgotten. Only the state of a running chat stays behind.
+	fork := reflect.ValueOf(llm.Fork()).Elem()
+	original := reflect.ValueOf(llm).Elem()
+	for i := range original.NumField() {
+		name := original.Type().Field(i).Name
+		switch name {
+		case "prefill", "err", "usageSink", "JSONOutputSchema":
+			continue
+		}
+		assert.False(t, fork.Field(i).IsZero(), "Fork dropped %s", name)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "First")  // user, assistant (tool call), tool, assistant
+	runTestChat(ctx, t, llm, "Second") // user, assistant
+	require.NoError(t, llm.Err())
+	require.Len(t, llm.Messages(), 6)
+
+	require.NoError(t, llm.Rewind(0))
+	assert.Len(t, llm.Messages(), 6)
+
+	require.NoError(t, llm.Rewind(1))
+	require.Len(t, llm.Messages(), 4)
+	assert.Equal(t, "assistant", llm.Messages()[3].Role)
+
+	require.ErrorIs(t, llm.Rewind(2), ErrNoUserMessage)
+	assert.Len(t, llm.Messages(), 4, "A failed rewind leaves the conversation alone")
+
+	runTestChat(ctx, t, llm, "Instead")
+	require.NoError(t, llm.Err())
+	require.Len(t, llm.Messages(), 6)
+	assert.Equal(t, "Instead", textOf(t, llm.Messages()[4]))
+
+	require.NoError(t, llm.Rewind(2))
+	assert.Empty(t, llm.Messages())
+}
+
+func TestRewindGivesBackTurns(t *testing.T) {
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool).WithMaxTurns(3)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "First")  // Two turns.
+	runTestChat(ctx, t, llm, "Second") // One turn.
+	require.NoError(t, llm.Err())
+	assert.Equal(t, 3, llm.turns)
+
+	require.NoError(t, llm.Rewind(1))
+	assert.Equal(t, 2, llm.turns)
+	runTestChat(ctx, t, llm, "Instead")
+	require.NoError(t, llm.Err(), "The rewound turn no longer counts")
+
+	for range llm.Regenerate(ctx) {
+	}
+	require.NoError(t, llm.Err(), "Neither does the regenerated one")
+	assert.Equal(t, 3, llm.turns)
+}
+
+func TestRegenerate(t *testing.T) {
+	provider := &mockProvider{toolCallsToMake: []string{"test_tool"}}
+	llm := New(provider, testTool)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Question")
+	require.NoError(t, llm.Err())
+	require.Len(t, llm.Messages(), 4)
+
+	var updates []Update
+	for update := range llm.Regenerate(ctx) {
+		updates = append(updates, update)
+	}
+	require.NoError(t, llm.Err())
+	assert.NotEmpty(t, updates)
+
+	// The old response was replaced rather than added to, and since the
+	// model made the tool call again, the new one has the same shape.
+	require.Len(t, llm.Messages(), 4)
+	assert.Equal(t, "Question", textOf(t, llm.Messages()[0]))
+	assert.Equal(t, "test_tool-id-0", llm.Messages()[2].ToolCallID)
+}
+
+func TestRegenerateWithoutUserMessage(t *testing.T) {
+	llm := New(&mockProvider{})
+	for range llm.Regenerate(context.Background()) {
+	}
+	assert.ErrorIs(t, llm.Err(), ErrNoUserMessage)
+}
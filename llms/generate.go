@@ -0,0 +1,120 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// Response is the outcome of a call to Generate.
+type Response struct {
+	// Message is the last message from the assistant, which is the final
+	// answer unless the chat ended with an error.
+	Message Message
+	// Text is the text of Message.
+	Text string
+	// Thoughts holds the reasoning of every assistant message, in order.
+	Thoughts []content.Thought
+	// ToolCalls holds every tool call the assistant made, in order, along
+	// with its result.
+	ToolCalls []ToolCallResult
+	// Messages holds all messages that were added to the conversation,
+	// starting with the user message.
+	Messages []Message
+	// Usage holds the usage of each request made to the provider, including
+	// attempts that failed and were retried, and of each summary written by
+	// a Compactor.
+	Usage []Usage
+	// TotalUsage is the sum of Usage.
+	TotalUsage Usage
+	// StopReason is why the model stopped. It's empty if the chat ended with
+	// an error that isn't about how the response stopped.
+	StopReason StopReason
+}
+
+// ToolCallResult is a tool call made by the assistant and the result the tool
+// returned for it.
+type ToolCallResult struct {
+	ToolCall ToolCall
+	Result   tools.Result
+}
+
+// Generate sends a message to the LLM and waits for the final response,
+// running tools as needed, like ChatUsingContent does. If the chat fails, the
+// error is returned along with whatever was generated before it did.
+//
+// Any ToolApprovalRequestUpdate has to be answered for the chat to continue;
+// use GenerateWithUpdates when tools may require approval.
+func (l *LLM) Generate(ctx context.Context, message content.Content, opts ...ChatOption) (Response, error) {
+	return l.GenerateWithUpdates(ctx, message, nil, opts...)
+}
+
+// GenerateWithUpdates is like Generate, but also calls onUpdate with each
+// update as it comes in, for example to stream text to the user while still
+// getting the complete response at the end. The chat waits for onUpdate to
+// return.
+func (l *LLM) GenerateWithUpdates(ctx context.Context, message content.Content, onUpdate func(Update), opts ...ChatOption) (Response, error) {
+	start := len(l.lastSentMessages)
+
+	var usage []Usage
+	l.usageSink = func(u Usage) { usage = append(usage, u) }
+	defer func() { l.usageSink = nil }()
+
+	results := make(map[string]tools.Result)
+	for update := range l.ChatUsingContent(ctx, message, opts...) {
+		if done, ok := update.(ToolDoneUpdate); ok {
+			results[done.ToolCallID] = done.Result
+		}
+		if onUpdate != nil {
+			onUpdate(update)
+		}
+	}
+
+	response := newResponse(l.lastSentMessages[min(start, len(l.lastSentMessages)):], results, usage)
+	err := l.Err()
+	var stopErr *StopReasonError
+	switch {
+	case err == nil:
+		response.StopReason = response.Message.StopReason
+		if response.StopReason == "" {
+			response.StopReason = StopReasonEndTurn
+		}
+	case errors.Is(err, ErrOutputTruncated):
+		response.StopReason = StopReasonMaxTokens
+	case errors.As(err, &stopErr):
+		response.StopReason = stopErr.Reason
+	}
+	return response, err
+}
+
+func newResponse(messages []Message, results map[string]tools.Result, usage []Usage) Response {
+	response := Response{Messages: messages, Usage: usage}
+	for _, u := range usage {
+		response.TotalUsage.Add(u)
+	}
+	for _, msg := range messages {
+		if msg.Role != "assistant" {
+			continue
+		}
+		response.Message = msg
+		for _, item := range msg.Content {
+			if thought, ok := item.(*content.Thought); ok {
+				response.Thoughts = append(response.Thoughts, *thought)
+			}
+		}
+		for _, toolCall := range msg.ToolCalls {
+			response.ToolCalls = append(response.ToolCalls, ToolCallResult{ToolCall: toolCall, Result: results[toolCall.ID]})
+		}
+	}
+	var text strings.Builder
+	for _, item := range response.Message.Content {
+		if t, ok := item.(*content.Text); ok {
+			text.WriteString(t.Text)
+		}
+	}
+	response.Text = text.String()
+	return response
+}
@@ -0,0 +1,71 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+)
+
+func TestGenerate(t *testing.T) {
+	provider := &mockProvider{toolCallsToMake: []string{"test_tool"}}
+	llm := New(provider, testTool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := llm.Generate(ctx, content.FromText("Use the tool"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "I've processed the results from the tool.", response.Text)
+	assert.Equal(t, "assistant", response.Message.Role)
+	assert.Equal(t, StopReasonEndTurn, response.StopReason)
+	require.Len(t, response.Messages, 4)
+	assert.Equal(t, "user", response.Messages[0].Role)
+
+	require.Len(t, response.ToolCalls, 1)
+	assert.Equal(t, "test_tool", response.ToolCalls[0].ToolCall.Name)
+	require.NotNil(t, response.ToolCalls[0].Result)
+	assert.NoError(t, response.ToolCalls[0].Result.Error())
+
+	perTurn := Usage{CachedInputTokens: 10, InputTokens: 20, OutputTokens: 30}
+	assert.Equal(t, []Usage{perTurn, perTurn}, response.Usage)
+	assert.Equal(t, Usage{CachedInputTokens: 20, InputTokens: 40, OutputTokens: 60}, response.TotalUsage)
+
+	// A second call only reports what it added.
+	response, err = llm.Generate(ctx, content.FromText("Again"))
+	require.NoError(t, err)
+	assert.Len(t, response.Messages, 2)
+	assert.Empty(t, response.ToolCalls)
+	assert.Len(t, response.Usage, 1)
+}
+
+func TestGenerateWithUpdates(t *testing.T) {
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool)
+	var types []UpdateType
+	response, err := llm.GenerateWithUpdates(context.Background(), content.FromText("Hi"), func(update Update) {
+		types = append(types, update.Type())
+	})
+	require.NoError(t, err)
+	assert.Contains(t, types, UpdateTypeText)
+	assert.Contains(t, types, UpdateTypeToolDone)
+	assert.Len(t, response.ToolCalls, 1)
+}
+
+func TestGenerateError(t *testing.T) {
+	llm := New(&errorMockProvider{errorMessage: "boom"})
+	response, err := llm.Generate(context.Background(), content.FromText("Hi"))
+	require.Error(t, err)
+	assert.Empty(t, response.StopReason)
+	assert.Empty(t, response.Text)
+
+	llm = New(&flakyProvider{failures: 1, err: fmt.Errorf("%w (stop_reason=%q)", ErrOutputTruncated, "max_tokens")})
+	response, err = llm.Generate(context.Background(), content.FromText("Hi"))
+	require.True(t, errors.Is(err, ErrOutputTruncated))
+	assert.Equal(t, StopReasonMaxTokens, response.StopReason)
+}
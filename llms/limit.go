@@ -0,0 +1,97 @@
+package llms
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// LimitedProvider is a Provider that allows at most a fixed number of
+// requests to the wrapped provider at once, across all the LLMs that use it.
+// A request holds its slot from Generate until its stream has been iterated
+// to the end (or until Generate fails), and requests over the limit wait for a
+// slot or for their context to be done.
+type LimitedProvider struct {
+	Provider
+	slots chan struct{}
+}
+
+// LimitConcurrency wraps a provider so that at most maxConcurrency requests
+// to it are in flight at once. It panics if maxConcurrency isn't positive.
+func LimitConcurrency(provider Provider, maxConcurrency int) *LimitedProvider {
+	if maxConcurrency <= 0 {
+		panic("LimitConcurrency requires a positive maxConcurrency")
+	}
+	return &LimitedProvider{
+		Provider: provider,
+		slots:    make(chan struct{}, maxConcurrency),
+	}
+}
+
+// InFlight returns how many requests currently hold a slot.
+func (p *LimitedProvider) InFlight() int {
+	return len(p.slots)
+}
+
+func (p *LimitedProvider) SupportsPrefill() bool {
+	return supportsPrefill(p.Provider)
+}
+
+// CountTokens counts with the wrapped provider, without taking a slot.
+func (p *LimitedProvider) CountTokens(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox) (int, error) {
+	return CountTokens(ctx, p.Provider, systemPrompt, messages, toolbox)
+}
+
+func (p *LimitedProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return &errorStream{err: ctx.Err()}
+	}
+	var once sync.Once
+	release := func() { once.Do(func() { <-p.slots }) }
+
+	stream := p.Provider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+	if stream.Err() != nil {
+		release()
+		return stream
+	}
+	return &limitedStream{wrappedStream: wrappedStream{ProviderStream: stream, provider: p.Provider}, release: release}
+}
+
+// limitedStream gives its slot back once it has been iterated.
+type limitedStream struct {
+	wrappedStream
+	release func()
+}
+
+func (s *limitedStream) Iter() func(func(StreamStatus) bool) {
+	iter := s.ProviderStream.Iter()
+	return func(yield func(StreamStatus) bool) {
+		defer s.release()
+		iter(yield)
+	}
+}
+
+// errorStream is a ProviderStream that failed before it started.
+type errorStream struct {
+	err error
+}
+
+func (s *errorStream) Err() error                          { return s.err }
+func (s *errorStream) Iter() func(func(StreamStatus) bool) { return func(func(StreamStatus) bool) {} }
+func (s *errorStream) Message() Message                    { return Message{} }
+func (s *errorStream) Text() string                        { return "" }
+func (s *errorStream) Audio() (string, string)             { return "", "" }
+func (s *errorStream) Image() (string, string)             { return "", "" }
+func (s *errorStream) Thought() content.Thought            { return content.Thought{} }
+func (s *errorStream) ToolCall() ToolCall                  { return ToolCall{} }
+func (s *errorStream) Usage() Usage                        { return Usage{} }
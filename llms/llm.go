@@ -1,12 +1,16 @@
 package llms
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"slices"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/flitsinc/go-llms/content"
 	"github.com/flitsinc/go-llms/tools"
@@ -15,12 +19,27 @@ import (
 var (
 	ErrMaxTurnsReached            = errors.New("max turns reached")
 	ErrToolsAndJSONOutputConflict = errors.New("cannot specify both tools and a JSON output schema")
+	// ErrToolCallCanceled is the cause of the cancellation of a tool call that
+	// was canceled with LLM.CancelToolCall.
+	ErrToolCallCanceled = errors.New("tool call canceled")
+	// ErrToolCallDenied is carried by the result of a tool call that the
+	// application denied in response to a ToolApprovalRequestUpdate.
+	ErrToolCallDenied = errors.New("tool call denied by user")
+	// ErrInvalidToolCallEdit is carried by the result of a tool call whose
+	// arguments the application replaced with invalid JSON in response to a
+	// ToolApprovalRequestUpdate. The call doesn't run.
+	ErrInvalidToolCallEdit = errors.New("edited tool call arguments aren't valid JSON")
 	// ErrIncompleteToolCall is returned when the provider ended the stream
 	// while a tool call was still in progress, which leaves that call with no
 	// result to answer it. Retrying the turn is usually the right response.
 	ErrIncompleteToolCall = errors.New("provider ended the stream mid tool call")
 )
 
+func isRequestTooLarge(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.IsRequestTooLarge()
+}
+
 func cloneMetadata(src map[string]string) map[string]string {
 	if len(src) == 0 {
 		return nil
@@ -40,11 +59,29 @@ type LLM struct {
 	toolbox  *tools.Toolbox
 	debugger Debugger
 
-	turns, maxTurns  int
-	lastSentMessages []Message
+	turns, maxTurns   int
+	lastSentMessages  []Message
+	retry             RetryPolicy
+	parallelToolCalls int
+	compactor         *Compactor
+	budget            *Budget
+	pricing           CostCalculator
+	maxContinuations  int
+
+	// prefill is the text the response to the current chat's message starts
+	// with, until the first turn takes it.
+	prefill string
 
 	err error // Last error encountered during operation
 
+	// usageSink, if set, receives the usage of each request of the current
+	// chat, for GenerateWithUpdates.
+	usageSink func(Usage)
+
+	// Cancels the context of each tool call that is currently running, so that
+	// it can be canceled from another goroutine.
+	runningToolCalls *runningToolCalls
+
 	// SystemPrompt should return the system prompt for the LLM. It's a function
 	// to allow the system prompt to dynamically change throughout a single
 	// conversation.
@@ -66,10 +103,36 @@ type LLM struct {
 	// information after each LLM turn completes.
 	TrackUsage func(ctx context.Context, usage Usage, success bool)
 
+	// RequiresApproval, if set, is called for each tool call once its
+	// arguments are final, before the tool runs. If it returns true, a
+	// ToolApprovalRequestUpdate is sent on the update channel and the chat
+	// waits until the application approves, denies or edits the call through
+	// the update. A denied call doesn't run; the model receives an error
+	// result wrapping ErrToolCallDenied instead, so it can adapt. Calls to
+	// tools that don't exist never need approval, since nothing would run.
+	RequiresApproval func(ctx context.Context, toolCall ToolCall, tool tools.Tool) bool
+
 	// BeforeResponse, if set, is called synchronously before each provider
 	// request. It may mutate outbound messages through the provided state.
 	// Returning an error aborts the request and ends the chat.
 	BeforeResponse func(ctx context.Context, state BeforeResponseState) error
+
+	// AfterResponse, if set, is called synchronously after each turn, once
+	// the assistant's message and the results of its tool calls are part of
+	// the conversation. Messages it injects through the provided state are
+	// added to the conversation too, and make the chat continue with another
+	// turn even if the model didn't call any tools. Returning an error ends
+	// the chat with that error.
+	AfterResponse func(ctx context.Context, state AfterResponseState) error
+
+	// AfterToolCall, if set, is called with the result of each tool call
+	// before it's reported in a ToolDoneUpdate and sent back to the model,
+	// including calls that were denied or named a tool that doesn't exist. It
+	// returns the result to use instead, which may be the same one. Returning
+	// an error ends the chat with that error. With parallel tool calls, it's
+	// called from the goroutines running the calls, so it must be safe for
+	// concurrent use.
+	AfterToolCall func(ctx context.Context, toolCall ToolCall, result tools.Result) (tools.Result, error)
 }
 
 // Toolbox returns the toolbox associated with this LLM, or nil if no tools
@@ -86,24 +149,25 @@ func New(provider Provider, allTools ...tools.Tool) *LLM {
 		toolbox = tools.Box(allTools...)
 	}
 	return &LLM{
-		provider: provider,
-		toolbox:  toolbox,
+		provider:         provider,
+		toolbox:          toolbox,
+		runningToolCalls: &runningToolCalls{},
 	}
 }
 
 // Chat sends a text message to the LLM and immediately returns a channel over
 // which updates will come in. The LLM will use the tools available and keep
 // generating more messages until it's done using tools.
-func (l *LLM) Chat(message string) <-chan Update {
-	return l.ChatWithContext(context.Background(), message)
+func (l *LLM) Chat(message string, opts ...ChatOption) <-chan Update {
+	return l.ChatWithContext(context.Background(), message, opts...)
 }
 
 // ChatWithContext sends a text message to the LLM and immediately returns a
 // channel over which updates will come in. The LLM will use the tools available
 // and keep generating more messages until it's done using tools. The provided
 // context can be used to pass values to tools, set deadlines, cancel, etc.
-func (l *LLM) ChatWithContext(ctx context.Context, message string) <-chan Update {
-	return l.ChatUsingContent(ctx, content.FromText(message))
+func (l *LLM) ChatWithContext(ctx context.Context, message string, opts ...ChatOption) <-chan Update {
+	return l.ChatUsingContent(ctx, content.FromText(message), opts...)
 }
 
 // ChatUsingContent sends a message (which can contain images) to the LLM and
@@ -111,11 +175,11 @@ func (l *LLM) ChatWithContext(ctx context.Context, message string) <-chan Update
 // use the tools available and keep generating more messages until it's done
 // using tools. The provided context can be used to pass values to tools, set
 // deadlines, cancel, etc.
-func (l *LLM) ChatUsingContent(ctx context.Context, message content.Content) <-chan Update {
+func (l *LLM) ChatUsingContent(ctx context.Context, message content.Content, opts ...ChatOption) <-chan Update {
 	return l.ChatUsingMessages(ctx, append(l.lastSentMessages, Message{
 		Role:    "user",
 		Content: message,
-	}))
+	}), opts...)
 }
 
 // ChatUsingMessages sends a message history to the LLM and immediately returns
@@ -123,10 +187,8 @@ func (l *LLM) ChatUsingContent(ctx context.Context, message content.Content) <-c
 // available and keep generating more messages until it's done using tools. The
 // provided context can be used to pass values to tools, set deadlines, cancel,
 // etc.
-func (l *LLM) ChatUsingMessages(ctx context.Context, messages []Message) <-chan Update {
-	l.lastSentMessages = messages
-	// Reset error state for new chat
-	l.err = nil
+func (l *LLM) ChatUsingMessages(ctx context.Context, messages []Message, opts ...ChatOption) <-chan Update {
+	l.startChat(messages, opts)
 
 	updateChan := make(chan Update)
 
@@ -146,33 +208,47 @@ func (l *LLM) ChatUsingMessages(ctx context.Context, messages []Message) <-chan
 				l.err = fmt.Errorf("LLM panic: %v", rec)
 			}
 		}()
-		for {
-			select {
-			case <-ctx.Done():
-				l.err = ctx.Err()
-				if l.err == nil {
-					l.err = context.Canceled
-				}
-				// Exit goroutine, defer close(updateChan) will run.
-				return
-			default:
-				shouldContinue, err := l.turn(ctx, updateChan)
-				if err != nil {
-					l.err = err
-					// Exit goroutine on error, defer close(updateChan) will run.
-					return
-				}
-				if !shouldContinue {
-					// Normal completion (e.g., no tool calls), exit goroutine.
-					return
-				}
-			}
+		if err := l.run(ctx, func(update Update) { updateChan <- update }); err != nil {
+			l.err = err
 		}
 	}()
 
 	return updateChan
 }
 
+// run runs turns until the model is done using tools, the context is
+// canceled, or a turn fails. Updates are passed to emit, which is only called
+// from the goroutine running run (even with parallel tool calls), and never
+// after run returns.
+func (l *LLM) run(ctx context.Context, emit func(Update)) error {
+	for first := true; ; first = false {
+		select {
+		case <-ctx.Done():
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return context.Canceled
+		default:
+			if err := l.checkBudget(); err != nil {
+				if !first && l.budget.WrapUp {
+					if wrapUpErr := l.wrapUp(ctx, emit); wrapUpErr != nil {
+						return wrapUpErr
+					}
+				}
+				return err
+			}
+			shouldContinue, err := l.turn(ctx, emit)
+			if err != nil {
+				return err
+			}
+			if !shouldContinue {
+				// Normal completion (e.g., no tool calls).
+				return nil
+			}
+		}
+	}
+}
+
 // AddExternalTools adds one or more external tools to the LLM's toolbox. Unlike
 // regular tools, external tools are usually forwarded to some other code
 // (sometimes over the network) and handled there, before a result is produced.
@@ -222,11 +298,87 @@ func (l *LLM) WithDebugger(d Debugger) *LLM {
 // WithMaxTurns sets the maximum number of turns the LLM will make. This is
 // useful to prevent infinite loops or excessive usage. A value of 0 means no
 // limit. A value of 1 means the LLM will only ever do one API call, and so on.
+// Turns whose responses Rewind or Regenerate remove no longer count.
 func (l *LLM) WithMaxTurns(maxTurns int) *LLM {
 	l.maxTurns = maxTurns
 	return l
 }
 
+// WithRetry sets the policy used to retry turns that fail with a transient
+// provider error, such as a rate limit or an overloaded server. Use
+// DefaultRetryPolicy for sensible defaults. Retries are disabled by default.
+func (l *LLM) WithRetry(policy RetryPolicy) *LLM {
+	l.retry = policy
+	return l
+}
+
+// WithParallelToolCalls makes the LLM run the tool calls of a turn in the
+// background as soon as each one is ready, at most maxConcurrency at a time,
+// while the rest of the response is still streaming in. All tool calls finish
+// before the next turn starts, and their results are sent back to the model in
+// the order the model made the calls. A value of 0 (the default) runs tool
+// calls one at a time, in the stream loop.
+//
+// ToolStatusUpdate and ToolDoneUpdate for a call always come after its
+// ToolStartUpdate (and ToolArgumentFinalizationUpdate, if any), but with this
+// enabled they may interleave with the updates of other calls and with the
+// text that follows. Tools must be safe to run concurrently.
+func (l *LLM) WithParallelToolCalls(maxConcurrency int) *LLM {
+	l.parallelToolCalls = maxConcurrency
+	return l
+}
+
+// WithCompactor makes the LLM compact the conversation it sends whenever it
+// grows past the compactor's token budget, and whenever the provider rejects a
+// request as too large (see HTTPError.IsRequestTooLarge), in which case the
+// request is compacted and retried once. The compactor runs after
+// BeforeResponse.
+func (l *LLM) WithCompactor(c *Compactor) *LLM {
+	l.compactor = c
+	return l
+}
+
+// CancelToolCall cancels the context of the running tool call with the given
+// ID, if there is one, and reports whether it found it. The tool call ends with
+// an error result wrapping ErrToolCallCanceled, which is sent back to the model
+// like any other result; the rest of the chat carries on. Unlike the rest of
+// LLM, this method is safe to call from any goroutine.
+func (l *LLM) CancelToolCall(toolCallID string) bool {
+	return l.runningToolCalls.cancel(toolCallID)
+}
+
+// runningToolCalls holds the cancel functions of the tool calls that are
+// currently running, by ID.
+type runningToolCalls struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelCauseFunc
+}
+
+func (r *runningToolCalls) add(toolCallID string, cancel context.CancelCauseFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancels == nil {
+		r.cancels = make(map[string]context.CancelCauseFunc)
+	}
+	r.cancels[toolCallID] = cancel
+}
+
+func (r *runningToolCalls) remove(toolCallID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cancels, toolCallID)
+}
+
+func (r *runningToolCalls) cancel(toolCallID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancel, ok := r.cancels[toolCallID]
+	if ok {
+		cancel(ErrToolCallCanceled)
+	}
+	return ok
+}
+
 // Err returns the last error encountered during LLM operation. This is useful
 // for checking errors after a Chat loop completes. Returns nil if no error
 // occurred.
@@ -234,18 +386,68 @@ func (l *LLM) Err() error {
 	return l.err
 }
 
-func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error) {
+func (l *LLM) turn(ctx context.Context, emit func(Update)) (bool, error) {
 	if l.maxTurns > 0 && l.turns >= l.maxTurns {
 		return false, ErrMaxTurnsReached
 	}
 	l.turns++
 
+	forceCompaction := false
+	// The partial response being continued, either because it was cut off or
+	// because the chat was prefilled.
+	continued := l.takePrefill(emit)
+	continuations := 0
+	for attempt := 1; ; attempt++ {
+		result, emitted, err := l.attemptTurn(ctx, emit, forceCompaction, continued)
+		var truncated *truncatedError
+		if errors.As(err, &truncated) && continuations < l.maxContinuations {
+			// Continue the response rather than failing the turn. This doesn't
+			// count as an attempt of the retry policy either.
+			continuations++
+			continued = &truncated.message
+			attempt--
+			continue
+		}
+		if err != nil && !emitted && l.compactor != nil && !forceCompaction && isRequestTooLarge(err) {
+			// Compact more aggressively than the estimate suggested and try
+			// again. This doesn't count as an attempt of the retry policy.
+			forceCompaction = true
+			attempt--
+			continue
+		}
+		if err == nil {
+			return l.afterResponse(ctx, result)
+		}
+		if emitted || !l.retry.shouldRetry(attempt, err) {
+			return false, err
+		}
+		delay := l.retry.backoff(attempt, err)
+		emit(RetryUpdate{Attempt: attempt + 1, MaxAttempts: l.retry.MaxAttempts, Delay: delay, Err: err})
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attemptTurn makes a single provider request for the current turn and
+// processes its stream. Besides the result of the turn, it reports whether
+// anything that becomes part of the conversation was emitted, since
+// a turn can't be retried once the consumer has seen some of it. Message
+// starts, thinking and searches don't count (see RetryUpdate).
+// With forceCompaction, the compactor compacts the conversation even if it
+// seems to fit. With continued, the request continues that partial response
+// and the result includes it.
+func (l *LLM) attemptTurn(ctx context.Context, emit func(Update), forceCompaction bool, continued *Message) (result *turnResult, emitted bool, err error) {
 	turnStart := time.Now()
 
 	// Check for conflicting configuration: Tools and JSONOutputSchema
 	hasTools := l.toolbox != nil && len(l.toolbox.All()) > 0
 	if l.JSONOutputSchema != nil && hasTools {
-		return false, ErrToolsAndJSONOutputConflict
+		return nil, emitted, ErrToolsAndJSONOutputConflict
 	}
 
 	var systemPrompt content.Content
@@ -256,30 +458,27 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 	// This will hold results from tool calls, to be sent back to the LLM.
 	var toolMessages []Message
 
-	systemPrompt, outboundMessages, err := l.prepareBeforeResponse(ctx, systemPrompt, l.lastSentMessages)
+	systemPrompt, outboundMessages, err := l.prepareBeforeResponse(ctx, systemPrompt, l.lastSentMessages, forceCompaction)
 	if err != nil {
-		return false, err
+		return nil, emitted, err
+	}
+	if continued != nil {
+		outboundMessages = l.continuationMessages(outboundMessages, *continued)
 	}
 	if l.debugger != nil && GetDebugger(ctx) == nil {
 		ctx = WithDebugger(ctx, l.debugger)
 	}
 	stream := l.provider.Generate(ctx, systemPrompt, outboundMessages, l.toolbox, l.JSONOutputSchema)
 	if err := stream.Err(); err != nil {
-		return false, fmt.Errorf("LLM returned error response: %w", err)
+		return nil, emitted, fmt.Errorf("LLM returned error response: %w", err)
 	}
 
 	trackTTFT := l.TrackTTFT
 	shouldReportTTFT := trackTTFT != nil
 
 	var success bool
-	// Report usage if tracking is enabled.
-	trackUsage := l.TrackUsage
 	defer func() {
-		usage := stream.Usage()
-		l.TotalUsage.Add(usage)
-		if trackUsage != nil {
-			trackUsage(ctx, usage, success)
-		}
+		l.addUsage(ctx, l.priceUsage(l.provider, stream, stream.Usage()), success)
 	}()
 
 	// Tracks how many bytes of the tool call arguments we sent so far in
@@ -291,7 +490,44 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 	// StreamStatusToolCallReady can still be finished below.
 	var begunUnknownToolCalls []ToolCall
 
+	// Arguments the application replaced when approving a tool call, which
+	// the assistant message must reflect too.
+	var editedArguments map[string]json.RawMessage
+
+	// Responses with a JSON schema are also sent as partial objects, whenever
+	// a text delta changes what they decode to.
+	var partialObject *PartialJSON
+	var lastPartialJSON json.RawMessage
+
+	// The text of a continuation is streamed the way mergeContinuation
+	// joins it to the partial response.
+	trimLeadingSpace := trimsLeadingSpace(continued)
+
+	if l.JSONOutputSchema != nil {
+		partialObject = &PartialJSON{}
+		if continued != nil {
+			for _, item := range continued.Content {
+				if text, ok := item.(*content.Text); ok {
+					partialObject.Write(text.Text)
+				}
+			}
+		}
+	}
+
+	// With parallel tool calls, the calls run in the background. However the
+	// turn ends, they must all finish before it does, since their updates are
+	// forwarded by this goroutine, and emit can't be called once the chat is
+	// over.
+	var toolCalls *toolCallGroup
+	if l.parallelToolCalls > 0 {
+		toolCalls = newToolCallGroup(l.parallelToolCalls)
+		defer toolCalls.wait(emit)
+	}
+
 	for status := range stream.Iter() {
+		if toolCalls != nil {
+			toolCalls.relay(emit)
+		}
 		// For now assume the first event we get on the stream is the first token.
 		if shouldReportTTFT {
 			shouldReportTTFT = false
@@ -303,21 +539,42 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 		select {
 		case <-ctx.Done():
 			// Propagate cancellation error immediately
-			return false, ctx.Err()
+			return nil, emitted, ctx.Err()
 		default:
 			// Context OK, process status
 		}
 		switch status {
 		case StreamStatusMessageStart:
 			msg := stream.Message()
-			updateChan <- MessageStartUpdate{MessageID: msg.ID}
+			emit(MessageStartUpdate{MessageID: msg.ID})
 
 		case StreamStatusText:
-			updateChan <- TextUpdate{stream.Text()}
+			text := stream.Text()
+			if trimLeadingSpace {
+				text = strings.TrimLeftFunc(text, unicode.IsSpace)
+				if text == "" {
+					continue
+				}
+				trimLeadingSpace = false
+			}
+			emitted = true
+			emit(TextUpdate{text})
+			if partialObject == nil {
+				continue
+			}
+			partialObject.Write(text)
+			if data, ok := partialObject.JSON(); ok && !bytes.Equal(data, lastPartialJSON) {
+				lastPartialJSON = data
+				var object any
+				if err := json.Unmarshal(data, &object); err == nil {
+					emit(PartialObjectUpdate{Object: object, JSON: data})
+				}
+			}
 
 		case StreamStatusImage:
 			url, mime := stream.Image()
 			update := ImageUpdate{URL: url, MimeType: mime}
+			emitted = true
 			// Propagate provider-specific metadata from the content item.
 			msg := stream.Message()
 			if len(msg.Content) > 0 {
@@ -325,37 +582,44 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 					update.Metadata = mc.GetMetadata()
 				}
 			}
-			updateChan <- update
+			emit(update)
 
 		case StreamStatusAudio:
 			url, mime := stream.Audio()
 			update := AudioUpdate{URL: url, MimeType: mime}
+			emitted = true
 			msg := stream.Message()
 			if len(msg.Content) > 0 {
 				if mc, ok := msg.Content[len(msg.Content)-1].(content.MetadataCarrier); ok {
 					update.Metadata = mc.GetMetadata()
 				}
 			}
-			updateChan <- update
+			emit(update)
 
 		case StreamStatusThinking:
-			updateChan <- ThinkingUpdate{stream.Thought()}
+			emit(ThinkingUpdate{stream.Thought()})
 
 		case StreamStatusThinkingDone:
-			updateChan <- ThinkingDoneUpdate{}
+			emit(ThinkingDoneUpdate{})
 
 		case StreamStatusSearch:
 			// Provider-run search (e.g. xAI web_search / x_search) is informational: it runs
 			// server-side, so there is nothing to execute. Only providers that surface it
 			// implement Search(), so this is an optional capability rather than an interface method.
 			if searcher, ok := stream.(interface{ Search() SearchActivity }); ok {
-				updateChan <- SearchUpdate{searcher.Search()}
+				emit(SearchUpdate{searcher.Search()})
+			}
+
+		case StreamStatusCitation:
+			// Like search, citations are an optional capability of the stream.
+			if citer, ok := stream.(interface{ Citation() content.Citation }); ok {
+				emit(CitationUpdate{citer.Citation()})
 			}
 
 		case StreamStatusToolCallBegin:
 			toolCall := stream.ToolCall()
 			if toolCall.ID == "" {
-				return false, fmt.Errorf("missing tool call ID for tool %q", toolCall.Name)
+				return nil, emitted, fmt.Errorf("missing tool call ID for tool %q", toolCall.Name)
 			}
 			tool := l.toolbox.Get(toolCall.Name)
 			if tool == nil {
@@ -370,25 +634,28 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 				begunUnknownToolCalls = append(begunUnknownToolCalls, toolCall)
 			}
 			toolCallDeltaSentBytes = 0
-			updateChan <- ToolStartUpdate{ToolCallID: toolCall.ID, Tool: tool}
+			emitted = true
+			emit(ToolStartUpdate{ToolCallID: toolCall.ID, Tool: tool})
 
 		case StreamStatusToolCallDelta:
 			toolCall := stream.ToolCall()
 			if argLen := len(toolCall.Arguments); argLen > toolCallDeltaSentBytes {
 				// Only send the new part of the arguments.
-				updateChan <- ToolDeltaUpdate{toolCall.ID, toolCall.Arguments[toolCallDeltaSentBytes:]}
+				emit(ToolDeltaUpdate{toolCall.ID, toolCall.Arguments[toolCallDeltaSentBytes:]})
 				toolCallDeltaSentBytes = argLen
 			}
 
 		case StreamStatusToolCallReady:
-			// TODO: We want to support parallel tool calls, which means results
-			// would need to be collected later (and maybe out of order).
 			toolCall := stream.ToolCall()
+			tool := l.toolbox.Get(toolCall.Name)
+			if tool == nil {
+				tool = tools.Unknown(toolCall.Name)
+			}
 			// Usually there shouldn't be any more changes to arguments but we
 			// have to make sure all arguments are sent before we run the tool.
 			if argLen := len(toolCall.Arguments); argLen > toolCallDeltaSentBytes {
 				// Only send the new part of the arguments.
-				updateChan <- ToolDeltaUpdate{toolCall.ID, toolCall.Arguments[toolCallDeltaSentBytes:]}
+				emit(ToolDeltaUpdate{toolCall.ID, toolCall.Arguments[toolCallDeltaSentBytes:]})
 				toolCallDeltaSentBytes = argLen
 			}
 			var finalArguments json.RawMessage
@@ -403,23 +670,93 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 				if finalArguments != nil {
 					update.Arguments = append(json.RawMessage{}, finalArguments...)
 				}
-				updateChan <- update
+				emit(update)
+			}
+			if l.RequiresApproval != nil && !tools.IsUnknown(tool) && l.RequiresApproval(ctx, toolCall, tool) {
+				decision, err := l.awaitApproval(ctx, toolCall, tool, emit)
+				if err != nil {
+					return nil, emitted, err
+				}
+				if decision.denied {
+					denial := tools.Error(decision.err())
+					if toolCalls != nil {
+						// Results are kept in the order of the calls, so the
+						// denial takes its place among the running calls.
+						toolCalls.start(toolCall, func() (Message, error) {
+							return l.finishToolCall(ctx, toolCall, tool, denial, toolCalls.emit)
+						})
+						continue
+					}
+					toolMessage, err := l.finishToolCall(ctx, toolCall, tool, denial, emit)
+					if err != nil {
+						return nil, emitted, err
+					}
+					toolMessages = append(toolMessages, toolMessage)
+					continue
+				}
+				if decision.arguments != nil {
+					toolCall.Arguments = decision.arguments
+					if editedArguments == nil {
+						editedArguments = make(map[string]json.RawMessage)
+					}
+					editedArguments[toolCall.ID] = decision.arguments
+				}
+			}
+			if toolCalls != nil {
+				toolCalls.start(toolCall, func() (Message, error) {
+					return l.runToolCall(ctx, l.toolbox, toolCall, toolCalls.emit)
+				})
+				continue
+			}
+			toolMessage, err := l.runToolCall(ctx, l.toolbox, toolCall, emit)
+			if err != nil {
+				return nil, emitted, err
 			}
-			toolMessage := l.runToolCall(ctx, l.toolbox, toolCall, updateChan)
 			toolMessages = append(toolMessages, toolMessage)
 		}
 	}
+	if toolCalls != nil {
+		parallelMessages, err := toolCalls.wait(emit)
+		if err != nil {
+			return nil, emitted, err
+		}
+		toolMessages = append(toolMessages, parallelMessages...)
+	}
 	// Check stream error after iterating
 	if streamErr := stream.Err(); streamErr != nil {
-		return false, fmt.Errorf("error iterating stream: %w", streamErr)
+		err := fmt.Errorf("error iterating stream: %w", streamErr)
+		if l.maxContinuations > 0 && errors.Is(streamErr, ErrOutputTruncated) && len(toolMessages) == 0 {
+			// Responses cut off during a tool call can't be continued, since
+			// providers only continue text.
+			if partial := stream.Message(); len(partial.ToolCalls) == 0 {
+				if continued != nil {
+					partial = mergeContinuation(*continued, partial)
+				}
+				return nil, emitted, &truncatedError{message: partial, err: err}
+			}
+		}
+		return nil, emitted, err
 	}
 	// Also check if the context was cancelled *during* stream iteration,
 	// even if the iterator itself didn't return an error.
 	if ctx.Err() != nil {
-		return false, ctx.Err()
+		return nil, emitted, ctx.Err()
 	}
 
 	message := stream.Message()
+	if message.StopReason == "" {
+		if s, ok := stream.(StopReasoner); ok {
+			message.StopReason = s.StopReason()
+		}
+	}
+	if continued != nil {
+		message = mergeContinuation(*continued, message)
+	}
+	for i, toolCall := range message.ToolCalls {
+		if arguments, ok := editedArguments[toolCall.ID]; ok {
+			message.ToolCalls[i].Arguments = arguments
+		}
+	}
 
 	// A tool call that began but never reached StreamStatusToolCallReady (a
 	// provider truncating the stream, say) leaves the assistant message with a
@@ -430,7 +767,7 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 	// finished this way, since running one needs its arguments.
 	for _, toolCall := range begunUnknownToolCalls {
 		if ctx.Err() != nil {
-			return false, ctx.Err()
+			return nil, emitted, ctx.Err()
 		}
 		if slices.ContainsFunc(toolMessages, func(m Message) bool { return m.ToolCallID == toolCall.ID }) {
 			continue
@@ -447,12 +784,16 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 				message.ToolCalls[i].Arguments = json.RawMessage(`{}`)
 			}
 		}
-		toolMessages = append(toolMessages, l.runToolCall(ctx, l.toolbox, toolCall, updateChan))
+		toolMessage, err := l.runToolCall(ctx, l.toolbox, toolCall, emit)
+		if err != nil {
+			return nil, emitted, err
+		}
+		toolMessages = append(toolMessages, toolMessage)
 		// runToolCall drops its ToolDoneUpdate if the context went away while it
 		// ran, so check again rather than recording a turn whose result the
 		// consumer never saw.
 		if ctx.Err() != nil {
-			return false, ctx.Err()
+			return nil, emitted, ctx.Err()
 		}
 	}
 
@@ -464,7 +805,7 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 	// arguments the stream never delivered.
 	for _, toolCall := range message.ToolCalls {
 		if !slices.ContainsFunc(toolMessages, func(m Message) bool { return m.ToolCallID == toolCall.ID }) {
-			return false, fmt.Errorf("%w: %q (%s)", ErrIncompleteToolCall, toolCall.ID, toolCall.Name)
+			return nil, emitted, fmt.Errorf("%w: %q (%s)", ErrIncompleteToolCall, toolCall.ID, toolCall.Name)
 		}
 	}
 
@@ -486,11 +827,40 @@ func (l *LLM) turn(ctx context.Context, updateChan chan<- Update) (bool, error)
 	// unsuccessful to TrackUsage.
 	success = true
 
-	// Return true if there were tool calls, since the LLM should look at the results.
-	return len(toolMessages) > 0, nil
+	// The usage is priced like the usage reported above, so every hook sees
+	// the same numbers.
+	return &turnResult{message: message, toolMessages: toolMessages, usage: l.priceUsage(l.provider, stream, stream.Usage())}, emitted, nil
+}
+
+// turnResult is what a successful turn added to the conversation.
+type turnResult struct {
+	message      Message
+	toolMessages []Message
+	usage        Usage
+}
+
+// afterResponse runs the AfterResponse hook for a completed turn and reports
+// whether the chat should continue with another turn.
+func (l *LLM) afterResponse(ctx context.Context, result *turnResult) (bool, error) {
+	// Continue if there were tool calls, since the LLM should look at the
+	// results, or if the provider paused the turn and expects it to be
+	// continued.
+	shouldContinue := len(result.toolMessages) > 0 || result.message.StopReason == StopReasonPauseTurn
+	if l.AfterResponse == nil {
+		return shouldContinue, nil
+	}
+	state := newAfterResponseState(l.turns, result)
+	if err := l.AfterResponse(ctx, state); err != nil {
+		return false, err
+	}
+	if injected := state.freeze(); len(injected) > 0 {
+		l.lastSentMessages = append(l.lastSentMessages, injected...)
+		shouldContinue = true
+	}
+	return shouldContinue, nil
 }
 
-func (l *LLM) runToolCall(ctx context.Context, toolbox *tools.Toolbox, toolCall ToolCall, updateChan chan<- Update) Message {
+func (l *LLM) runToolCall(ctx context.Context, toolbox *tools.Toolbox, toolCall ToolCall, emit func(Update)) (Message, error) {
 	if toolCall.ID == "" {
 		panic(fmt.Sprintf("tool call (%s) is missing an ID", toolCall.Name))
 	}
@@ -510,22 +880,49 @@ func (l *LLM) runToolCall(ctx context.Context, toolbox *tools.Toolbox, toolCall
 		// found" error without running anything.
 		t = tools.Unknown(toolCall.Name)
 	}
-	// Create a new context with the ToolCall value
-	ctxWithValue := context.WithValue(ctx, ToolCallContextKey, toolCall)
-	runner := tools.NewRunner(ctxWithValue, toolbox, func(status string) {
+	// Create a new context with the ToolCall value, which can be canceled on
+	// its own with CancelToolCall.
+	callCtx, cancel := context.WithCancelCause(context.WithValue(ctx, ToolCallContextKey, toolCall))
+	l.runningToolCalls.add(toolCall.ID, cancel)
+	defer func() {
+		l.runningToolCalls.remove(toolCall.ID)
+		cancel(nil)
+	}()
+	runner := tools.NewRunner(callCtx, toolbox, func(status string) {
 		select {
 		case <-ctx.Done(): // Don't send if already cancelled
 		default:
-			updateChan <- ToolStatusUpdate{toolCall.ID, status, t}
+			emit(ToolStatusUpdate{toolCall.ID, status, t})
 		}
 	})
 
 	result := toolbox.Run(runner, toolCall.Name, json.RawMessage(toolCall.Arguments))
+	// Only a cancellation of this call replaces its result: once the call is
+	// unregistered, CancelToolCall can't reach it anymore.
+	l.runningToolCalls.remove(toolCall.ID)
+	if errors.Is(context.Cause(callCtx), ErrToolCallCanceled) {
+		result = tools.Error(fmt.Errorf("tool %q was canceled: %w", toolCall.Name, ErrToolCallCanceled))
+	}
+	return l.finishToolCall(ctx, toolCall, t, result, emit)
+}
+
+// finishToolCall runs the AfterToolCall hook on the result of a tool call,
+// reports it, and returns the message that carries it back to the model.
+func (l *LLM) finishToolCall(ctx context.Context, toolCall ToolCall, t tools.Tool, result tools.Result, emit func(Update)) (Message, error) {
+	if l.AfterToolCall != nil {
+		replacement, err := l.AfterToolCall(ctx, toolCall, result)
+		if err != nil {
+			return Message{}, err
+		}
+		if replacement != nil {
+			result = replacement
+		}
+	}
 	select {
 	case <-ctx.Done(): // Don't send if already cancelled
 	default:
 		// TODO: If we ever expose a "tool starting to run" update, the Metadata can be sent there instead.
-		updateChan <- ToolDoneUpdate{ToolCallID: toolCall.ID, Result: result, Tool: t, Metadata: cloneMetadata(toolCall.Metadata)}
+		emit(ToolDoneUpdate{ToolCallID: toolCall.ID, Result: result, Tool: t, Metadata: cloneMetadata(toolCall.Metadata)})
 	}
 
 	return Message{
@@ -534,6 +931,24 @@ func (l *LLM) runToolCall(ctx context.Context, toolbox *tools.Toolbox, toolCall
 		ToolCallID:   toolCall.ID,
 		ToolCallName: toolCall.Name,
 		IsError:      result.Error() != nil,
+	}, nil
+}
+
+// awaitApproval asks the application to approve a tool call and waits for its
+// decision.
+func (l *LLM) awaitApproval(ctx context.Context, toolCall ToolCall, t tools.Tool, emit func(Update)) (toolApproval, error) {
+	decisions := make(chan toolApproval, 1)
+	emit(ToolApprovalRequestUpdate{
+		ToolCallID: toolCall.ID,
+		Tool:       t,
+		Arguments:  append(json.RawMessage{}, toolCall.Arguments...),
+		decisions:  decisions,
+	})
+	select {
+	case <-ctx.Done():
+		return toolApproval{}, ctx.Err()
+	case decision := <-decisions:
+		return decision, nil
 	}
 }
 
@@ -541,14 +956,27 @@ func (l *LLM) prepareBeforeResponse(
 	ctx context.Context,
 	systemPrompt content.Content,
 	messages []Message,
+	forceCompaction bool,
 ) (content.Content, []Message, error) {
-	if l.BeforeResponse == nil {
+	if l.BeforeResponse == nil && l.compactor == nil {
 		return systemPrompt, messages, nil
 	}
 
+	// Requests the hooks make to other providers, such as the summaries of a
+	// Compactor, count towards the usage of the LLM.
+	ctx = context.WithValue(ctx, usageReporterContextKey, func(provider Provider, stream ProviderStream, success bool) {
+		l.addUsage(ctx, l.priceUsage(provider, stream, stream.Usage()), success)
+	})
 	state := newBeforeResponseState(l.turns, systemPrompt, messages)
-	if err := l.BeforeResponse(ctx, state); err != nil {
-		return nil, nil, err
+	if l.BeforeResponse != nil {
+		if err := l.BeforeResponse(ctx, state); err != nil {
+			return nil, nil, err
+		}
+	}
+	if l.compactor != nil {
+		if err := l.compactor.compactState(ctx, state, forceCompaction); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	nextSystemPrompt, nextMessages := state.freeze()
@@ -0,0 +1,77 @@
+package llms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// citingProvider responds with text that cites a source.
+type citingProvider struct {
+	mockProvider
+}
+
+func (p *citingProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) ProviderStream {
+	return &citingStream{mockStream: &mockStream{provider: &p.mockProvider, textToGenerate: "The sky is blue."}}
+}
+
+type citingStream struct {
+	*mockStream
+}
+
+var testCitation = content.Citation{Start: 4, End: 15, Source: "web", URL: "https://example.com/sky", Title: "Sky"}
+
+func (s *citingStream) Iter() func(func(StreamStatus) bool) {
+	return func(yield func(StreamStatus) bool) {
+		if !yield(StreamStatusText) {
+			return
+		}
+		yield(StreamStatusCitation)
+	}
+}
+
+func (s *citingStream) Message() Message {
+	return Message{Role: "assistant", Content: content.Content{&content.Text{Text: s.textToGenerate, Citations: []content.Citation{testCitation}}}}
+}
+
+func (s *citingStream) Citation() content.Citation { return testCitation }
+
+func TestCitationUpdates(t *testing.T) {
+	llm := New(LimitConcurrency(&citingProvider{}, 1))
+
+	var citations []content.Citation
+	for update := range llm.Chat("Why is the sky blue?") {
+		if u, ok := update.(CitationUpdate); ok {
+			citations = append(citations, u.Citation)
+		}
+	}
+	require.NoError(t, llm.Err())
+	assert.Equal(t, []content.Citation{testCitation}, citations)
+
+	text := llm.Messages()[1].Content[0].(*content.Text)
+	assert.Equal(t, "sky is blue", text.Text[testCitation.Start:testCitation.End])
+
+	// Forks get their own copy of the citations.
+	fork := llm.Fork()
+	fork.Messages()[1].Content[0].(*content.Text).Citations[0].URL = "changed"
+	assert.Equal(t, testCitation.URL, text.Citations[0].URL)
+}
+
+func TestMergeContinuationKeepsCitations(t *testing.T) {
+	partial := Message{Role: "assistant", Content: content.FromText("Rain is ")}
+	continuation := Message{Role: "assistant", Content: content.Content{&content.Text{
+		Text:      " wet, says the report.",
+		Citations: []content.Citation{{Start: 1, End: 4, Source: "document"}},
+	}}}
+
+	merged := mergeContinuation(partial, continuation)
+	text := merged.Content[0].(*content.Text)
+	assert.Equal(t, "Rain is wet, says the report.", text.Text)
+	require.Len(t, text.Citations, 1)
+	assert.Equal(t, "wet", text.Text[text.Citations[0].Start:text.Citations[0].End])
+}
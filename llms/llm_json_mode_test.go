@@ -104,10 +104,13 @@ func TestLLM_JSONMode_PassesSchemaToProvider(t *testing.T) {
 	assert.True(t, provider.generateCalled, "Provider should be called")
 	assert.Equal(t, schema, provider.receivedSchema, "Schema should be passed to provider")
 	assert.NoError(t, llm.Err())
-	require.Len(t, updates, 1)
+	require.Len(t, updates, 2)
 	text, ok := updates[0].(TextUpdate)
 	require.True(t, ok)
 	assert.JSONEq(t, `{"foo":"bar"}`, text.Text)
+	partial, ok := updates[1].(PartialObjectUpdate)
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"foo": "bar"}, partial.Object)
 }
 
 func TestLLM_JSONMode_ConflictsWithTools(t *testing.T) {
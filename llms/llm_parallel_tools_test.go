@@ -0,0 +1,109 @@
+package llms
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// slowTool sleeps a little less on every call, so that later calls finish
+// first, and records how many calls were running at once.
+func slowTool(running, maxRunning *atomic.Int32) tools.Tool {
+	var calls atomic.Int32
+	return tools.Func("Slow Tool", "Takes a while", "slow_tool",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				current := maxRunning.Load()
+				if n <= current || maxRunning.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			r.Report("working")
+			time.Sleep(60*time.Millisecond - time.Duration(calls.Add(1))*10*time.Millisecond)
+			toolCall, _ := GetToolCall(r.Context())
+			return tools.SuccessFromString(toolCall.ID)
+		})
+}
+
+func TestParallelToolCalls(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	provider := &mockProvider{toolCallsToMake: []string{"slow_tool", "slow_tool", "slow_tool", "slow_tool"}}
+	llm := New(provider, slowTool(&running, &maxRunning)).WithParallelToolCalls(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	updates := runTestChat(ctx, t, llm, "Run them all")
+	require.NoError(t, llm.Err())
+
+	assert.Equal(t, int32(2), maxRunning.Load(), "At most two tool calls should run at once")
+
+	// Tool messages are in the order the model made the calls.
+	var toolCallIDs []string
+	for _, msg := range llm.lastSentMessages {
+		if msg.Role == "tool" {
+			toolCallIDs = append(toolCallIDs, msg.ToolCallID)
+			assert.JSONEq(t, `{"output":"`+msg.ToolCallID+`"}`, string(msg.Content[0].(*content.JSON).Data))
+		}
+	}
+	assert.Equal(t, []string{"slow_tool-id-0", "slow_tool-id-1", "slow_tool-id-2", "slow_tool-id-3"}, toolCallIDs)
+
+	// Every call's status and done updates come after its start update.
+	started := map[string]bool{}
+	done := map[string]bool{}
+	for _, update := range updates {
+		switch u := update.(type) {
+		case ToolStartUpdate:
+			started[u.ToolCallID] = true
+		case ToolStatusUpdate:
+			assert.True(t, started[u.ToolCallID], "status before start for %s", u.ToolCallID)
+			assert.False(t, done[u.ToolCallID], "status after done for %s", u.ToolCallID)
+		case ToolDoneUpdate:
+			assert.True(t, started[u.ToolCallID], "done before start for %s", u.ToolCallID)
+			done[u.ToolCallID] = true
+		}
+	}
+	assert.Len(t, done, 4)
+}
+
+func TestParallelToolCallsRunConcurrently(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	sleeper := tools.Func("Sleeper", "Sleeps", "sleeper",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			time.Sleep(delay)
+			return tools.SuccessFromString("rested")
+		})
+	provider := &mockProvider{toolCallsToMake: []string{"sleeper", "sleeper", "sleeper"}}
+	llm := New(provider, sleeper).WithParallelToolCalls(3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	runTestChat(ctx, t, llm, "Sleep")
+	require.NoError(t, llm.Err())
+	assert.Less(t, time.Since(start), 3*delay, "The tool calls should overlap")
+}
+
+func TestParallelToolCallPanic(t *testing.T) {
+	panicky := tools.Func("Panicky", "Panics", "panicky",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			panic("oh no")
+		})
+	provider := &mockProvider{toolCallsToMake: []string{"panicky"}}
+	llm := New(provider, panicky).WithParallelToolCalls(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Panic")
+
+	require.Error(t, llm.Err())
+	assert.Contains(t, llm.Err().Error(), "panicked: oh no")
+}
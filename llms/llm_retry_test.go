@@ -0,0 +1,248 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// flakyProvider fails the first failures Generate calls with err, either
+// immediately, after emitting some text (if failMidStream is set) or after
+// starting a message and thinking (if failAfterThinking is set).
+type flakyProvider struct {
+	mockProvider
+	failures          int
+	err               error
+	failMidStream     bool
+	failAfterThinking bool
+	calls             int
+}
+
+func (p *flakyProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	p.calls++
+	if p.calls <= p.failures {
+		if p.failMidStream {
+			return &midStreamErrorStream{err: p.err}
+		}
+		if p.failAfterThinking {
+			return &thinkingErrorStream{midStreamErrorStream{err: p.err}}
+		}
+		return &errorMockStream{err: p.err}
+	}
+	return p.mockProvider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+}
+
+// midStreamErrorStream emits some text and then fails.
+type midStreamErrorStream struct {
+	errorMockStream
+	err  error
+	done bool
+}
+
+func (s *midStreamErrorStream) Err() error {
+	if s.done {
+		return s.err
+	}
+	return nil
+}
+
+func (s *midStreamErrorStream) Iter() func(func(StreamStatus) bool) {
+	return func(yield func(StreamStatus) bool) {
+		defer func() { s.done = true }()
+		yield(StreamStatusText)
+	}
+}
+
+func (s *midStreamErrorStream) Text() string { return "partial" }
+
+// thinkingErrorStream starts a message and thinks, and then fails.
+type thinkingErrorStream struct {
+	midStreamErrorStream
+}
+
+func (s *thinkingErrorStream) Iter() func(func(StreamStatus) bool) {
+	return func(yield func(StreamStatus) bool) {
+		defer func() { s.done = true }()
+		_ = yield(StreamStatusMessageStart) && yield(StreamStatusThinking)
+	}
+}
+
+func (s *thinkingErrorStream) Thought() content.Thought {
+	return content.Thought{Text: "Hmm"}
+}
+
+var fastRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+}
+
+func TestRetryTransientError(t *testing.T) {
+	provider := &flakyProvider{
+		failures: 2,
+		err:      &HTTPError{StatusCode: 529, Status: "529", ErrorType: "overloaded_error", Message: "Overloaded"},
+	}
+	var tracked []bool
+	llm := New(provider).WithRetry(fastRetryPolicy)
+	llm.TrackUsage = func(_ context.Context, _ Usage, success bool) { tracked = append(tracked, success) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	updates := runTestChat(ctx, t, llm, "Hello")
+
+	require.NoError(t, llm.Err())
+	assert.Equal(t, 3, provider.calls)
+	require.Len(t, updates, 3, "Two retry updates followed by the text")
+	for i, attempt := range []int{2, 3} {
+		retry, ok := updates[i].(RetryUpdate)
+		require.True(t, ok, "Update %d should be a RetryUpdate", i)
+		assert.Equal(t, attempt, retry.Attempt)
+		assert.Equal(t, 3, retry.MaxAttempts)
+		assert.LessOrEqual(t, retry.Delay, fastRetryPolicy.MaxBackoff)
+		assert.True(t, IsRetryable(retry.Err))
+	}
+	assert.IsType(t, TextUpdate{}, updates[2])
+	assert.Equal(t, []bool{true}, tracked, "Failed attempts never got a stream with usage")
+
+	// Retries happen within a single turn.
+	assert.Equal(t, 1, llm.turns)
+	assert.Len(t, llm.lastSentMessages, 2)
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	httpErr := &HTTPError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	provider := &flakyProvider{failures: 10, err: httpErr}
+	llm := New(provider).WithRetry(fastRetryPolicy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	updates := runTestChat(ctx, t, llm, "Hello")
+
+	assert.Equal(t, 3, provider.calls)
+	assert.Len(t, updates, 2)
+	require.Error(t, llm.Err())
+	assert.ErrorIs(t, llm.Err(), httpErr)
+}
+
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	provider := &flakyProvider{
+		failures: 1,
+		err:      &HTTPError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request", ErrorType: "invalid_request_error"},
+	}
+	llm := New(provider).WithRetry(fastRetryPolicy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	updates := runTestChat(ctx, t, llm, "Hello")
+
+	assert.Equal(t, 1, provider.calls)
+	assert.Empty(t, updates)
+	require.Error(t, llm.Err())
+}
+
+func TestRetrySkipsAfterOutputWasEmitted(t *testing.T) {
+	provider := &flakyProvider{
+		failures:      1,
+		failMidStream: true,
+		err:           &HTTPError{Status: "API error", ErrorType: "overloaded_error", Message: "Overloaded"},
+	}
+	llm := New(provider).WithRetry(fastRetryPolicy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	updates := runTestChat(ctx, t, llm, "Hello")
+
+	assert.Equal(t, 1, provider.calls, "The consumer already saw text, so the turn can't be retried")
+	require.Len(t, updates, 1)
+	assert.IsType(t, TextUpdate{}, updates[0])
+	require.Error(t, llm.Err())
+}
+
+func TestRetryAfterThinking(t *testing.T) {
+	provider := &flakyProvider{
+		failures:          1,
+		failAfterThinking: true,
+		err:               &HTTPError{Status: "API error", ErrorType: "overloaded_error", Message: "Overloaded"},
+	}
+	llm := New(provider).WithRetry(fastRetryPolicy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	updates := runTestChat(ctx, t, llm, "Hello")
+
+	// Thinking isn't part of the conversation, so the turn is still retried,
+	// and the RetryUpdate tells the consumer to discard what it saw of the
+	// failed attempt.
+	require.NoError(t, llm.Err())
+	assert.Equal(t, 2, provider.calls)
+	require.Len(t, updates, 4)
+	assert.IsType(t, MessageStartUpdate{}, updates[0])
+	assert.Equal(t, ThinkingUpdate{content.Thought{Text: "Hmm"}}, updates[1])
+	assert.IsType(t, RetryUpdate{}, updates[2])
+	assert.IsType(t, TextUpdate{}, updates[3])
+
+	assert.Len(t, llm.Messages(), 2)
+	assert.NotContains(t, llm.Messages()[1].Content, &content.Thought{Text: "Hmm"}, "The failed attempt's thinking isn't kept")
+}
+
+func TestRetryCustomClassifier(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	provider := &flakyProvider{failures: 1, err: errFlaky}
+	policy := fastRetryPolicy
+	policy.Retryable = func(err error) bool { return errors.Is(err, errFlaky) }
+	llm := New(provider).WithRetry(policy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Hello")
+
+	require.NoError(t, llm.Err())
+	assert.Equal(t, 2, provider.calls)
+}
+
+func TestRetryDisabledByDefault(t *testing.T) {
+	provider := &flakyProvider{failures: 1, err: &HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429"}}
+	llm := New(provider)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Hello")
+
+	assert.Equal(t, 1, provider.calls)
+	require.Error(t, llm.Err())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	err := &HTTPError{StatusCode: http.StatusInternalServerError}
+
+	for attempt, upper := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		5: time.Second,
+	} {
+		delay := policy.backoff(attempt, err)
+		assert.LessOrEqual(t, delay, upper, "attempt %d", attempt)
+		assert.GreaterOrEqual(t, delay, upper/2, "attempt %d", attempt)
+	}
+
+	withRetryAfter := &HTTPError{StatusCode: http.StatusTooManyRequests, RetryAfter: 700 * time.Millisecond}
+	assert.Equal(t, 700*time.Millisecond, policy.backoff(1, withRetryAfter))
+	withRetryAfter.RetryAfter = time.Minute
+	assert.Equal(t, time.Second, policy.backoff(1, withRetryAfter), "Retry-After is capped by MaxBackoff")
+}
@@ -0,0 +1,176 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// approvalTestLLM returns an LLM whose provider calls test_tool once, a counter
+// of how often the tool ran, and the arguments it last ran with.
+func approvalTestLLM() (*LLM, *atomic.Int32, *string) {
+	var runs atomic.Int32
+	var lastParam string
+	tool := tools.Func("Test Tool", "A test tool for testing", "test_tool",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			runs.Add(1)
+			lastParam = p.TestParam
+			return tools.SuccessFromString("ran")
+		})
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, tool)
+	llm.RequiresApproval = func(ctx context.Context, toolCall ToolCall, tool tools.Tool) bool {
+		return tool.FuncName() == "test_tool"
+	}
+	return llm, &runs, &lastParam
+}
+
+// chatWithApprovals runs a chat, answering each approval request with decide.
+func chatWithApprovals(t *testing.T, llm *LLM, decide func(ToolApprovalRequestUpdate)) []Update {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var updates []Update
+	for update := range llm.ChatWithContext(ctx, "Do it") {
+		updates = append(updates, update)
+		if request, ok := update.(ToolApprovalRequestUpdate); ok {
+			decide(request)
+		}
+	}
+	return updates
+}
+
+func TestToolApprovalApprove(t *testing.T) {
+	llm, runs, _ := approvalTestLLM()
+	updates := chatWithApprovals(t, llm, func(u ToolApprovalRequestUpdate) {
+		assert.Equal(t, "test_tool-id-0", u.ToolCallID)
+		assert.Equal(t, "test_tool", u.Tool.FuncName())
+		assert.JSONEq(t, `{"test_param":"test_value_test_tool"}`, string(u.Arguments))
+		u.Approve()
+		u.Deny("too late") // Ignored.
+	})
+
+	require.NoError(t, llm.Err())
+	assert.Equal(t, int32(1), runs.Load())
+
+	var types []UpdateType
+	for _, update := range updates {
+		types = append(types, update.Type())
+	}
+	assert.Equal(t, []UpdateType{
+		UpdateTypeText,
+		UpdateTypeToolStart,
+		UpdateTypeToolDelta,
+		UpdateTypeToolDelta,
+		UpdateTypeToolApprovalRequest,
+		UpdateTypeToolDone,
+		UpdateTypeText,
+	}, types)
+}
+
+func TestToolApprovalDeny(t *testing.T) {
+	llm, runs, _ := approvalTestLLM()
+	updates := chatWithApprovals(t, llm, func(u ToolApprovalRequestUpdate) {
+		u.Deny("not on a Friday")
+	})
+
+	require.NoError(t, llm.Err(), "A denial is something the model can adapt to")
+	assert.Equal(t, int32(0), runs.Load())
+
+	var done ToolDoneUpdate
+	for _, update := range updates {
+		if u, ok := update.(ToolDoneUpdate); ok {
+			done = u
+		}
+	}
+	require.ErrorIs(t, done.Result.Error(), ErrToolCallDenied)
+	assert.Contains(t, done.Result.Error().Error(), "not on a Friday")
+
+	toolMessage := llm.lastSentMessages[2]
+	assert.Equal(t, "tool", toolMessage.Role)
+	assert.Equal(t, "test_tool-id-0", toolMessage.ToolCallID)
+	assert.True(t, toolMessage.IsError)
+	assert.Equal(t, "assistant", llm.lastSentMessages[3].Role)
+}
+
+func TestToolApprovalEdit(t *testing.T) {
+	llm, runs, lastParam := approvalTestLLM()
+	edited := json.RawMessage(`{"test_param":"safer"}`)
+	chatWithApprovals(t, llm, func(u ToolApprovalRequestUpdate) {
+		u.Edit(edited)
+	})
+
+	require.NoError(t, llm.Err())
+	assert.Equal(t, int32(1), runs.Load())
+	assert.Equal(t, "safer", *lastParam)
+	assert.JSONEq(t, string(edited), string(llm.lastSentMessages[1].ToolCalls[0].Arguments),
+		"The history should show the call that was actually made")
+}
+
+func TestToolApprovalInvalidEdit(t *testing.T) {
+	for _, arguments := range []json.RawMessage{nil, json.RawMessage(`{"test_param":`)} {
+		llm, runs, _ := approvalTestLLM()
+		updates := chatWithApprovals(t, llm, func(u ToolApprovalRequestUpdate) {
+			u.Edit(arguments)
+		})
+
+		require.NoError(t, llm.Err())
+		assert.Equal(t, int32(0), runs.Load(), "A call with invalid arguments shouldn't run")
+		var done ToolDoneUpdate
+		for _, update := range updates {
+			if u, ok := update.(ToolDoneUpdate); ok {
+				done = u
+			}
+		}
+		assert.ErrorIs(t, done.Result.Error(), ErrInvalidToolCallEdit)
+		assert.JSONEq(t, `{"test_param":"test_value_test_tool"}`, string(llm.lastSentMessages[1].ToolCalls[0].Arguments),
+			"The history should keep the arguments the model sent")
+	}
+}
+
+func TestToolApprovalCanceled(t *testing.T) {
+	llm, runs, _ := approvalTestLLM()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for update := range llm.ChatWithContext(ctx, "Do it") {
+		if _, ok := update.(ToolApprovalRequestUpdate); ok {
+			cancel() // Walk away without deciding.
+		}
+	}
+
+	assert.ErrorIs(t, llm.Err(), context.Canceled)
+	assert.Equal(t, int32(0), runs.Load())
+}
+
+func TestToolApprovalParallelKeepsOrder(t *testing.T) {
+	tool := tools.Func("Test Tool", "A test tool for testing", "test_tool",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			return tools.SuccessFromString("ran")
+		})
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool", "test_tool", "test_tool"}}, tool).WithParallelToolCalls(3)
+	llm.RequiresApproval = func(ctx context.Context, toolCall ToolCall, tool tools.Tool) bool {
+		return true
+	}
+	chatWithApprovals(t, llm, func(u ToolApprovalRequestUpdate) {
+		if u.ToolCallID == "test_tool-id-1" {
+			u.Deny("not this one")
+			return
+		}
+		u.Approve()
+	})
+	require.NoError(t, llm.Err())
+
+	var ids []string
+	for _, message := range llm.lastSentMessages[2:5] {
+		require.Equal(t, "tool", message.Role)
+		ids = append(ids, message.ToolCallID)
+	}
+	assert.Equal(t, []string{"test_tool-id-0", "test_tool-id-1", "test_tool-id-2"}, ids)
+	assert.True(t, llm.lastSentMessages[3].IsError)
+}
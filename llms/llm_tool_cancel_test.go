@@ -0,0 +1,76 @@
+package llms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+func TestCancelToolCall(t *testing.T) {
+	stuck := tools.Func("Stuck", "Never finishes on its own", "stuck",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			<-r.Context().Done()
+			// A canceled call reports the cancellation, whatever it returns.
+			return tools.SuccessFromString("finished anyway")
+		})
+	provider := &mockProvider{toolCallsToMake: []string{"stuck"}}
+	llm := New(provider, stuck)
+
+	assert.False(t, llm.CancelToolCall("stuck-id-0"), "Nothing is running yet")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var done *ToolDoneUpdate
+	for update := range llm.ChatWithContext(ctx, "Get stuck") {
+		switch u := update.(type) {
+		case ToolStartUpdate:
+			// The tool only starts running after its arguments are complete,
+			// so wait for it to be registered.
+			go func() {
+				for !llm.CancelToolCall(u.ToolCallID) {
+					time.Sleep(time.Millisecond)
+				}
+			}()
+		case ToolDoneUpdate:
+			done = &u
+		}
+	}
+
+	require.NoError(t, llm.Err(), "Canceling one tool call shouldn't end the chat")
+	require.NotNil(t, done)
+	assert.ErrorIs(t, done.Result.Error(), ErrToolCallCanceled)
+
+	toolMessage := llm.lastSentMessages[2]
+	assert.Equal(t, "tool", toolMessage.Role)
+	assert.True(t, toolMessage.IsError)
+	assert.Equal(t, "assistant", llm.lastSentMessages[3].Role, "The chat went on to another turn")
+}
+
+func TestToolTimeoutThroughLLM(t *testing.T) {
+	slow := tools.Func("Slow", "Too slow", "slow",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			<-r.Context().Done()
+			return tools.Error(r.Context().Err())
+		}, tools.WithTimeout(10*time.Millisecond))
+	provider := &mockProvider{toolCallsToMake: []string{"slow"}}
+	llm := New(provider, slow)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	updates := runTestChat(ctx, t, llm, "Be slow")
+	require.NoError(t, llm.Err())
+
+	var timeoutErr *tools.TimeoutError
+	for _, update := range updates {
+		if done, ok := update.(ToolDoneUpdate); ok {
+			require.ErrorAs(t, done.Result.Error(), &timeoutErr)
+		}
+	}
+	require.NotNil(t, timeoutErr)
+	assert.Equal(t, "slow", timeoutErr.FuncName)
+}
@@ -32,6 +32,9 @@ type Message struct {
 	// sets is_error on the tool_result block, Gemini receives an "error"-keyed
 	// function response, and OpenAI receives the output wrapped in {"error": ...}.
 	IsError bool `json:"is_error,omitempty"`
+	// StopReason is why the model stopped generating an assistant message.
+	// Providers don't send it back.
+	StopReason StopReason `json:"stop_reason,omitempty"`
 	// Metadata holds provider-specific metadata that should be forwarded unchanged.
 	// Keys are prefixed with the provider name, e.g. "openai:phase".
 	Metadata map[string]string `json:"metadata,omitempty"`
@@ -0,0 +1,101 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// ErrInvalidObject is returned by GenerateObject when the model keeps
+// responding with output that doesn't match the schema.
+var ErrInvalidObject = errors.New("model output does not match the schema")
+
+// DefaultObjectRetries is how many times GenerateObject asks the model to fix
+// invalid output before giving up, unless WithObjectRetries says otherwise.
+const DefaultObjectRetries = 2
+
+// ObjectOption configures GenerateObject.
+type ObjectOption func(*objectConfig)
+
+type objectConfig struct {
+	retries int
+}
+
+// WithObjectRetries sets how many times GenerateObject tells the model what
+// was wrong with its output and asks it to try again. Zero disables retries.
+func WithObjectRetries(retries int) ObjectOption {
+	return func(c *objectConfig) {
+		c.retries = retries
+	}
+}
+
+// GenerateObject sends the prompt to the LLM and decodes its response into a
+// value of type T, which must be a struct. The JSON schema for T is derived
+// the same way as the parameters of a tools.Func tool (including json and
+// description tags) and sent as the LLM's JSONOutputSchema for the duration of
+// the call. Since structured output can't be combined with tools, the LLM must
+// not have any.
+//
+// If the response isn't valid JSON matching the schema, the model is told
+// what's wrong and asked to try again, as part of the same conversation. Once
+// a response is valid, the failed attempts and what the model was told about
+// them are removed from the conversation, which goes on from the prompt and
+// the valid response. Once the retries run out, they are kept, and the
+// returned error wraps ErrInvalidObject.
+func GenerateObject[T any](ctx context.Context, llm *LLM, prompt content.Content, opts ...ObjectOption) (T, error) {
+	var zero T
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return zero, fmt.Errorf("GenerateObject needs a struct type, not %v", typ)
+	}
+	config := objectConfig{retries: DefaultObjectRetries}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	schema := tools.SchemaFor(typ)
+	previousSchema := llm.JSONOutputSchema
+	llm.JSONOutputSchema = &schema
+	defer func() { llm.JSONOutputSchema = previousSchema }()
+
+	start := len(llm.lastSentMessages)
+	for attempt := 0; ; attempt++ {
+		attemptStart := len(llm.lastSentMessages)
+		response, err := llm.Generate(ctx, prompt)
+		if err != nil {
+			return zero, err
+		}
+		value, err := decodeObject[T](schema, response.Text)
+		if err == nil {
+			if attempt > 0 {
+				// Keep the original prompt, followed by the response to the
+				// last correction.
+				messages := llm.lastSentMessages
+				llm.lastSentMessages = append(messages[:start+1:start+1], messages[attemptStart+1:]...)
+			}
+			return value, nil
+		}
+		if attempt >= config.retries {
+			return zero, fmt.Errorf("%w after %d attempts: %w", ErrInvalidObject, attempt+1, err)
+		}
+		prompt = content.FromText(fmt.Sprintf("Your response didn't match the JSON schema: %v. Respond again with only the corrected JSON.", err))
+	}
+}
+
+func decodeObject[T any](schema tools.ValueSchema, text string) (T, error) {
+	var value T
+	data := json.RawMessage(strings.TrimSpace(text))
+	if err := tools.Validate(schema, data); err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
@@ -0,0 +1,89 @@
+package llms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// scriptedProvider responds with the given replies in order.
+type scriptedProvider struct {
+	mockProvider
+	replies []string
+	calls   int
+}
+
+func (p *scriptedProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	p.messages = messages
+	p.jsonOutputSchema = jsonOutputSchema
+	reply := p.replies[min(p.calls, len(p.replies)-1)]
+	p.calls++
+	return &mockStream{provider: &p.mockProvider, textToGenerate: reply}
+}
+
+type capital struct {
+	City       string `json:"city" description:"The capital city"`
+	Population int    `json:"population"`
+}
+
+func TestGenerateObject(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{`{"city": "Paris", "population": 2100000}`}}
+	llm := New(provider)
+
+	answer, err := GenerateObject[capital](context.Background(), llm, content.FromText("Capital of France?"))
+	require.NoError(t, err)
+	assert.Equal(t, capital{City: "Paris", Population: 2100000}, answer)
+
+	require.NotNil(t, provider.jsonOutputSchema)
+	assert.Equal(t, []string{"city", "population"}, provider.jsonOutputSchema.Required)
+	assert.Nil(t, llm.JSONOutputSchema, "The schema is only set for the call")
+}
+
+func TestGenerateObjectRetries(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{
+		`{"city": "Paris"}`,
+		`{"city": "Paris", "population": 2100000}`,
+	}}
+	llm := New(provider)
+
+	answer, err := GenerateObject[capital](context.Background(), llm, content.FromText("Capital of France?"))
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", answer.City)
+	assert.Equal(t, 2, provider.calls)
+
+	// The model was told what was wrong, in the same conversation.
+	require.Len(t, provider.messages, 3)
+	assert.Contains(t, textOf(t, provider.messages[2]), `missing required field: "population"`)
+
+	// Only the prompt and the valid response stay in the conversation.
+	require.Len(t, llm.Messages(), 2)
+	assert.Equal(t, "Capital of France?", textOf(t, llm.Messages()[0]))
+	assert.Equal(t, `{"city": "Paris", "population": 2100000}`, textOf(t, llm.Messages()[1]))
+}
+
+func TestGenerateObjectNeedsStruct(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{`["Paris"]`}}
+	_, err := GenerateObject[[]string](context.Background(), New(provider), content.FromText("Capitals?"))
+	assert.ErrorContains(t, err, "needs a struct type")
+	assert.Equal(t, 0, provider.calls)
+}
+
+func TestGenerateObjectGivesUp(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{`not json`}}
+	llm := New(provider)
+	_, err := GenerateObject[capital](context.Background(), llm, content.FromText("Capital of France?"), WithObjectRetries(1))
+	assert.ErrorIs(t, err, ErrInvalidObject)
+	assert.Equal(t, 2, provider.calls)
+	assert.Len(t, llm.Messages(), 4, "The failed attempts are kept")
+}
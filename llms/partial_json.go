@@ -0,0 +1,182 @@
+package llms
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// PartialJSON assembles JSON that arrives in pieces, such as the text deltas of
+// a response with a JSONOutputSchema, and turns whatever has arrived so far
+// into valid JSON on demand. Open strings, arrays and objects are closed, and
+// anything that can't be completed without guessing (a half-written key, a
+// partial true/false/null, a dangling comma) is left out. Numbers are kept
+// as far as they've been written, so they may still grow.
+//
+// The zero value is ready to use.
+type PartialJSON struct {
+	buf []byte
+
+	// Scanner state, carried over between writes.
+	stack           []partialJSONFrame
+	inString        bool
+	inKey           bool // The open string is an object key.
+	escapeStart     int  // Offset of the backslash of an unfinished escape.
+	escapeRemaining int  // Characters the unfinished escape still needs.
+	inPrimitive     bool // A number or literal is being written.
+	primitiveStart  int
+	complete        bool // A top-level value has been completed.
+}
+
+type partialJSONFrame struct {
+	object    bool
+	expectKey bool
+	// safe is the offset up to which the container's contents are complete,
+	// so that closing the container there yields valid JSON.
+	safe int
+}
+
+// Write appends the next piece of JSON.
+func (p *PartialJSON) Write(delta string) {
+	offset := len(p.buf)
+	p.buf = append(p.buf, delta...)
+	for i := offset; i < len(p.buf); i++ {
+		p.scan(i, p.buf[i])
+	}
+}
+
+func (p *PartialJSON) scan(i int, c byte) {
+	if p.inString {
+		switch {
+		case p.escapeRemaining > 0:
+			if p.escapeRemaining == 1 && c == 'u' && i == p.escapeStart+1 {
+				p.escapeRemaining = 4
+			} else {
+				p.escapeRemaining--
+			}
+		case c == '\\':
+			p.escapeStart, p.escapeRemaining = i, 1
+		case c == '"':
+			p.inString = false
+			if !p.inKey {
+				p.valueDone(i + 1)
+			}
+		}
+		return
+	}
+	switch c {
+	case ' ', '\t', '\n', '\r':
+		p.primitiveDone(i)
+	case '"':
+		p.inString = true
+		p.inKey = len(p.stack) > 0 && p.top().object && p.top().expectKey
+	case '{', '[':
+		p.stack = append(p.stack, partialJSONFrame{object: c == '{', expectKey: c == '{', safe: i + 1})
+	case '}', ']':
+		p.primitiveDone(i)
+		if len(p.stack) > 0 {
+			p.stack = p.stack[:len(p.stack)-1]
+		}
+		p.valueDone(i + 1)
+	case ':':
+		if len(p.stack) > 0 {
+			p.top().expectKey = false
+		}
+	case ',':
+		p.primitiveDone(i)
+		if len(p.stack) > 0 && p.top().object {
+			p.top().expectKey = true
+		}
+	default:
+		if !p.inPrimitive {
+			p.inPrimitive, p.primitiveStart = true, i
+		}
+	}
+}
+
+func (p *PartialJSON) top() *partialJSONFrame {
+	return &p.stack[len(p.stack)-1]
+}
+
+func (p *PartialJSON) primitiveDone(end int) {
+	if p.inPrimitive {
+		p.inPrimitive = false
+		p.valueDone(end)
+	}
+}
+
+func (p *PartialJSON) valueDone(end int) {
+	if len(p.stack) == 0 {
+		p.complete = true
+		return
+	}
+	p.top().safe = end
+}
+
+// JSON returns the JSON so far, completed to be valid, or false if nothing
+// meaningful has arrived yet.
+func (p *PartialJSON) JSON() (json.RawMessage, bool) {
+	var out []byte
+	switch {
+	case p.inString && !p.inKey:
+		end := len(p.buf)
+		if p.escapeRemaining > 0 {
+			end = p.escapeStart
+		}
+		out = append(append(out, p.buf[:end]...), '"')
+	case p.inPrimitive:
+		if token, ok := completePrimitive(p.buf[p.primitiveStart:]); ok {
+			out = append(append(out, p.buf[:p.primitiveStart]...), token...)
+		} else if len(p.stack) > 0 {
+			out = append(out, p.buf[:p.top().safe]...)
+		}
+	case len(p.stack) > 0:
+		out = append(out, p.buf[:p.top().safe]...)
+	case p.complete:
+		out = append(out, p.buf...)
+	}
+	if len(out) == 0 {
+		return nil, false
+	}
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		if p.stack[i].object {
+			out = append(out, '}')
+		} else {
+			out = append(out, ']')
+		}
+	}
+	if !json.Valid(out) {
+		return nil, false
+	}
+	return out, true
+}
+
+// Value returns the JSON so far decoded into maps, slices and other basic Go
+// values, or false if nothing meaningful has arrived yet.
+func (p *PartialJSON) Value() (any, bool) {
+	data, ok := p.JSON()
+	if !ok {
+		return nil, false
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// completePrimitive returns the longest valid prefix of a number or the
+// literal itself, if the token is complete enough to have one.
+func completePrimitive(token []byte) ([]byte, bool) {
+	switch string(token) {
+	case "true", "false", "null":
+		return token, true
+	}
+	if len(token) == 0 || (token[0] != '-' && (token[0] < '0' || token[0] > '9')) {
+		return nil, false
+	}
+	token = bytes.TrimRight(token, ".eE+-")
+	if len(token) == 0 || !json.Valid(token) {
+		return nil, false
+	}
+	return token, true
+}
@@ -0,0 +1,116 @@
+package llms
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+func TestPartialJSON(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string // Empty if nothing is expected yet.
+	}{
+		{``, ``},
+		{`{`, `{}`},
+		{`{"ci`, `{}`},
+		{`{"city"`, `{}`},
+		{`{"city":`, `{}`},
+		{`{"city": "Pa`, `{"city": "Pa"}`},
+		{`{"city": "Paris", `, `{"city": "Paris"}`},
+		{`{"city": "Paris", "population": 21`, `{"city": "Paris", "population": 21}`},
+		{`{"city": "Paris", "population": 2.`, `{"city": "Paris", "population": 2}`},
+		{`{"city": "Paris", "population": -`, `{"city": "Paris"}`},
+		{`{"ok": tr`, `{}`},
+		{`{"ok": true`, `{"ok": true}`},
+		{`{"tags": ["a", "b`, `{"tags": ["a", "b"]}`},
+		{`{"tags": ["a", `, `{"tags": ["a"]}`},
+		{`{"nested": {"deep": [1, {"x": "y\`, `{"nested": {"deep": [1, {"x": "y"}]}}`},
+		{`{"quote": "say \"hi\" \u00`, `{"quote": "say \"hi\" "}`},
+		{`{"quote": "é`, `{"quote": "é"}`},
+		{`{"done": {}}`, `{"done": {}}`},
+		{`"just a str`, `"just a str"`},
+		{`4`, `4`},
+		{`nu`, ``},
+	}
+	for _, tt := range tests {
+		var p PartialJSON
+		// Feed it a byte at a time to exercise the carried-over state.
+		for _, c := range []byte(tt.prefix) {
+			p.Write(string([]byte{c}))
+		}
+		data, ok := p.JSON()
+		if tt.want == "" {
+			assert.False(t, ok, "prefix %s gave %s", tt.prefix, data)
+			continue
+		}
+		require.True(t, ok, "prefix %s", tt.prefix)
+		assert.JSONEq(t, tt.want, string(data), "prefix %s", tt.prefix)
+	}
+}
+
+func TestPartialObjectUpdates(t *testing.T) {
+	provider := &chunkedTextProvider{chunks: []string{`{"city": "Pa`, `ris", `, `"population"`, `: 2100000}`}}
+	llm := New(provider)
+	schema := tools.SchemaFor(reflect.TypeFor[capital]())
+	llm.JSONOutputSchema = &schema
+
+	var partials []capital
+	for update := range llm.ChatUsingContent(context.Background(), content.FromText("Capital of France?")) {
+		if update, ok := update.(PartialObjectUpdate); ok {
+			assert.IsType(t, map[string]any{}, update.Object)
+			value, err := DecodePartialObject[capital](update)
+			require.NoError(t, err)
+			partials = append(partials, value)
+		}
+	}
+	require.NoError(t, llm.Err())
+	// The third chunk completes a key, which doesn't change the object.
+	assert.Equal(t, []capital{
+		{City: "Pa"},
+		{City: "Paris"},
+		{City: "Paris", Population: 2100000},
+	}, partials)
+}
+
+// chunkedTextProvider streams its chunks as separate text deltas.
+type chunkedTextProvider struct {
+	mockProvider
+	chunks []string
+}
+
+func (p *chunkedTextProvider) Generate(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []Message,
+	toolbox *tools.Toolbox,
+	jsonOutputSchema *tools.ValueSchema,
+) ProviderStream {
+	return &chunkedTextStream{mockStream: mockStream{provider: &p.mockProvider, textToGenerate: strings.Join(p.chunks, "")}, chunks: p.chunks}
+}
+
+type chunkedTextStream struct {
+	mockStream
+	chunks  []string
+	current string
+}
+
+func (s *chunkedTextStream) Iter() func(func(StreamStatus) bool) {
+	return func(yield func(StreamStatus) bool) {
+		for _, chunk := range s.chunks {
+			s.current = chunk
+			if !yield(StreamStatusText) {
+				return
+			}
+		}
+	}
+}
+
+func (s *chunkedTextStream) Text() string { return s.current }
@@ -0,0 +1,50 @@
+package llms
+
+import "github.com/flitsinc/go-llms/content"
+
+// ChatOption configures a single chat, such as one started with Chat, Stream
+// or Generate.
+type ChatOption func(*chatConfig)
+
+type chatConfig struct {
+	prefill string
+}
+
+// WithPrefill makes the model's response to the chat's message start with the
+// given text, such as "{" to get JSON or a character's name to keep it in
+// role. The text is streamed as a TextUpdate before the rest of the response
+// and is part of the resulting assistant message, so the history reads as if
+// the model wrote it. Only the first turn of the chat is prefilled, not the
+// turns that respond to tool results.
+//
+// Providers that support prefill (see PrefillProvider) continue the text
+// directly; others are sent it as an assistant message followed by
+// ContinuePrompt, which doesn't become part of the conversation.
+func WithPrefill(text string) ChatOption {
+	return func(c *chatConfig) {
+		c.prefill = text
+	}
+}
+
+// startChat resets the per-chat state of the LLM for a new chat.
+func (l *LLM) startChat(messages []Message, opts []ChatOption) {
+	var config chatConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	l.lastSentMessages = messages
+	l.prefill = config.prefill
+	l.err = nil
+}
+
+// takePrefill returns the partial assistant message to continue in the first
+// turn of a chat, if it was prefilled, and announces its text.
+func (l *LLM) takePrefill(emit func(Update)) *Message {
+	if l.prefill == "" {
+		return nil
+	}
+	prefill := &Message{Role: "assistant", Content: content.FromText(l.prefill)}
+	emit(TextUpdate{l.prefill})
+	l.prefill = ""
+	return prefill
+}
@@ -0,0 +1,78 @@
+package llms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+)
+
+func TestPrefillWithSupport(t *testing.T) {
+	provider := &truncatingProvider{texts: []string{`"answer": 42}`}, prefill: true}
+	llm := New(provider)
+
+	var texts []string
+	response, err := llm.GenerateWithUpdates(context.Background(), content.FromText("Respond in JSON"), func(update Update) {
+		if u, ok := update.(TextUpdate); ok {
+			texts = append(texts, u.Text)
+		}
+	}, WithPrefill("{"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"{", `"answer": 42}`}, texts)
+	assert.Equal(t, `{"answer": 42}`, response.Text)
+	require.Len(t, llm.Messages(), 2)
+	assert.Equal(t, content.FromText(`{"answer": 42}`), llm.Messages()[1].Content)
+
+	require.Len(t, provider.requests, 1)
+	require.Len(t, provider.requests[0], 2)
+	assert.Equal(t, "assistant", provider.requests[0][1].Role)
+	assert.Equal(t, content.FromText("{"), provider.requests[0][1].Content)
+
+	// The prefill only applies to the chat it was given for.
+	_, err = llm.Generate(context.Background(), content.FromText("Again"))
+	require.NoError(t, err)
+	require.Len(t, provider.requests, 2)
+	assert.Equal(t, "user", provider.requests[1][len(provider.requests[1])-1].Role)
+}
+
+func TestPrefillEmulated(t *testing.T) {
+	provider := &truncatingProvider{texts: []string{"Arr, ahoy there!"}}
+	llm := New(provider)
+
+	runTestChatWithOptions(t, llm, "Greet me", WithPrefill("Captain: "))
+	require.NoError(t, llm.Err())
+	require.Len(t, llm.Messages(), 2)
+	assert.Equal(t, content.FromText("Captain: Arr, ahoy there!"), llm.Messages()[1].Content)
+
+	require.Len(t, provider.requests, 1)
+	require.Len(t, provider.requests[0], 3)
+	assert.Equal(t, content.FromText("Captain: "), provider.requests[0][1].Content)
+	assert.Equal(t, content.FromText(ContinuePrompt), provider.requests[0][2].Content)
+}
+
+func TestPrefillOnlyFirstTurn(t *testing.T) {
+	provider := &prefillMockProvider{mockProvider{toolCallsToMake: []string{"test_tool"}}}
+	llm := New(provider, testTool)
+
+	runTestChatWithOptions(t, llm, "Use the tool", WithPrefill("Sure"))
+	require.NoError(t, llm.Err())
+	require.Len(t, llm.Messages(), 4)
+	assert.Equal(t, content.FromText("SureThis is a test message."), llm.Messages()[1].Content)
+	assert.Equal(t, content.FromText("I've processed the results from the tool."), llm.Messages()[3].Content)
+}
+
+// prefillMockProvider is a mockProvider that supports prefill.
+type prefillMockProvider struct {
+	mockProvider
+}
+
+func (p *prefillMockProvider) SupportsPrefill() bool { return true }
+
+func runTestChatWithOptions(t *testing.T, llm *LLM, message string, opts ...ChatOption) {
+	t.Helper()
+	for range llm.ChatWithContext(context.Background(), message, opts...) {
+	}
+}
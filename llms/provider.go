@@ -12,10 +12,39 @@ import (
 
 // Usage represents token usage information from an LLM response.
 type Usage struct {
-	CachedInputTokens        int // Number of cached input tokens (cache reads)
-	CacheCreationInputTokens int // Number of input tokens used to create cache (cache writes)
-	InputTokens              int // Number of input tokens
-	OutputTokens             int // Number of output tokens
+	CachedInputTokens        int `json:"cached_input_tokens,omitempty"`         // Number of cached input tokens (cache reads)
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"` // Number of input tokens used to create cache (cache writes)
+	InputTokens              int `json:"input_tokens,omitempty"`                // Number of input tokens
+	OutputTokens             int `json:"output_tokens,omitempty"`               // Number of output tokens
+
+	// LongCacheCreationInputTokens is the part of CacheCreationInputTokens
+	// that was written to a long-lived (1 hour) cache, which costs more.
+	LongCacheCreationInputTokens int `json:"long_cache_creation_input_tokens,omitempty"`
+
+	// ReasoningTokens is the part of OutputTokens spent on reasoning before
+	// answering. Anthropic doesn't report it.
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+
+	// The parts of InputTokens and OutputTokens that were audio or images,
+	// for providers that report them.
+	AudioInputTokens  int `json:"audio_input_tokens,omitempty"`
+	ImageInputTokens  int `json:"image_input_tokens,omitempty"`
+	AudioOutputTokens int `json:"audio_output_tokens,omitempty"`
+	ImageOutputTokens int `json:"image_output_tokens,omitempty"`
+
+	// ToolUsePromptTokens is the part of InputTokens that came from the
+	// results of tools the provider ran itself, such as Google Search.
+	ToolUsePromptTokens int `json:"tool_use_prompt_tokens,omitempty"`
+
+	// WebSearchRequests and CodeExecutionRequests count how many times the
+	// provider ran its own web search and code execution tools, which are
+	// usually billed per use.
+	WebSearchRequests     int `json:"web_search_requests,omitempty"`
+	CodeExecutionRequests int `json:"code_execution_requests,omitempty"`
+
+	// Cost is the cost of the usage in dollars. Providers leave it at zero;
+	// the LLM fills it in when it has pricing (see LLM.WithPricing).
+	Cost float64 `json:"cost,omitempty"`
 }
 
 func (u *Usage) Add(other Usage) {
@@ -23,8 +52,20 @@ func (u *Usage) Add(other Usage) {
 	u.CacheCreationInputTokens += other.CacheCreationInputTokens
 	u.InputTokens += other.InputTokens
 	u.OutputTokens += other.OutputTokens
+	u.LongCacheCreationInputTokens += other.LongCacheCreationInputTokens
+	u.ReasoningTokens += other.ReasoningTokens
+	u.AudioInputTokens += other.AudioInputTokens
+	u.ImageInputTokens += other.ImageInputTokens
+	u.AudioOutputTokens += other.AudioOutputTokens
+	u.ImageOutputTokens += other.ImageOutputTokens
+	u.ToolUsePromptTokens += other.ToolUsePromptTokens
+	u.WebSearchRequests += other.WebSearchRequests
+	u.CodeExecutionRequests += other.CodeExecutionRequests
+	u.Cost += other.Cost
 }
 
+// ProviderStream is the response of a Provider. Streams can also implement
+// optional interfaces, such as StopReasoner, to report more about the response.
 type ProviderStream interface {
 	Err() error
 	Iter() func(yield func(StreamStatus) bool)
@@ -0,0 +1,84 @@
+package llms
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how an LLM retries a turn that failed because of a
+// transient provider error. The zero value disables retries.
+//
+// A turn is only retried if nothing that ends up in the conversation (text,
+// images, audio or tool calls) was sent on the update channel before the
+// failure, since the consumer has no way of taking those back. Each retry is
+// announced with a RetryUpdate.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made for a single turn,
+	// including the first one. Values below 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the base delay before the first retry. It doubles with
+	// every subsequent retry, and a random jitter of up to half the delay is
+	// subtracted so that many clients failing at once don't retry in lockstep.
+	// Defaults to one second.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between two attempts, including delays the
+	// provider asked for with a Retry-After header. Defaults to 30 seconds.
+	MaxBackoff time.Duration
+
+	// Retryable decides whether an error should be retried. Defaults to
+	// IsRetryable.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy is a reasonable policy for interactive use.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// IsRetryable reports whether err (or any error it wraps) is an HTTPError
+// that is likely to succeed if the request is made again later.
+func IsRetryable(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.IsTransient()
+}
+
+func (p RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the delay before the attempt that follows attempt.
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	initial, maxBackoff := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		return min(httpErr.RetryAfter, maxBackoff)
+	}
+
+	delay := initial
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxBackoff)
+	if jitter := int64(delay / 2); jitter > 0 {
+		delay -= time.Duration(rand.Int64N(jitter + 1))
+	}
+	return delay
+}
@@ -0,0 +1,65 @@
+package llms
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// SnapshotVersion is the version of the Snapshot format written by this
+// version of the package. Restore rejects snapshots from newer versions.
+const SnapshotVersion = 1
+
+// ErrUnsupportedSnapshotVersion is returned by Restore for a snapshot with a
+// version this package doesn't know how to read.
+var ErrUnsupportedSnapshotVersion = errors.New("unsupported snapshot version")
+
+// Snapshot is the state of a conversation, which can be encoded as JSON to
+// resume the conversation later, possibly in another process. It doesn't
+// include configuration such as the provider, tools or system prompt, which
+// are expected to be set up again by the code that restores it.
+type Snapshot struct {
+	Version    int           `json:"version"`
+	Messages   []Message     `json:"messages"`
+	Turns      int           `json:"turns"`
+	TotalUsage Usage         `json:"total_usage"`
+	ToolChoice *tools.Choice `json:"tool_choice,omitempty"`
+}
+
+// Snapshot returns a copy of the current conversation state. It must not be
+// called while a chat is in progress.
+func (l *LLM) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Version:    SnapshotVersion,
+		Messages:   cloneMessages(l.lastSentMessages),
+		Turns:      l.turns,
+		TotalUsage: l.TotalUsage,
+	}
+	if snapshot.Messages == nil {
+		snapshot.Messages = []Message{}
+	}
+	if l.toolbox != nil && l.toolbox.Choice.Mode != "" {
+		choice := l.toolbox.Choice
+		choice.AllowedTools = append([]string(nil), choice.AllowedTools...)
+		snapshot.ToolChoice = &choice
+	}
+	return snapshot
+}
+
+// Restore replaces the conversation state with the one in the snapshot, so
+// that the next call to ChatUsingContent continues from there. It must not be
+// called while a chat is in progress.
+func (l *LLM) Restore(snapshot *Snapshot) error {
+	if snapshot.Version < 1 || snapshot.Version > SnapshotVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSnapshotVersion, snapshot.Version)
+	}
+	l.lastSentMessages = cloneMessages(snapshot.Messages)
+	l.turns = snapshot.Turns
+	l.TotalUsage = snapshot.TotalUsage
+	l.err = nil
+	if snapshot.ToolChoice != nil {
+		l.SetToolChoice(*snapshot.ToolChoice)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	provider := &mockProvider{toolCallsToMake: []string{"test_tool"}}
+	llm := New(provider, testTool).SetToolChoice(tools.AllowOnly("test_tool"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	runTestChat(ctx, t, llm, "Use the tool")
+	require.NoError(t, llm.Err())
+
+	data, err := json.Marshal(llm.Snapshot())
+	require.NoError(t, err)
+
+	var snapshot Snapshot
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	assert.Equal(t, SnapshotVersion, snapshot.Version)
+	assert.Equal(t, 2, snapshot.Turns)
+	assert.Equal(t, Usage{CachedInputTokens: 20, InputTokens: 40, OutputTokens: 60}, snapshot.TotalUsage)
+	require.NotNil(t, snapshot.ToolChoice)
+	assert.Equal(t, tools.AllowOnly("test_tool"), *snapshot.ToolChoice)
+
+	// Resume in a fresh LLM, as another process would.
+	resumed := New(&mockProvider{}, testTool)
+	require.NoError(t, resumed.Restore(&snapshot))
+	assert.Equal(t, llm.lastSentMessages, resumed.lastSentMessages)
+	assert.Equal(t, llm.TotalUsage, resumed.TotalUsage)
+	assert.Equal(t, 2, resumed.turns)
+	assert.Equal(t, tools.AllowOnly("test_tool"), resumed.Toolbox().Choice)
+
+	runTestChat(ctx, t, resumed, "And again")
+	require.NoError(t, resumed.Err())
+	assert.Len(t, resumed.lastSentMessages, len(llm.lastSentMessages)+2)
+}
+
+func TestSnapshotIsACopy(t *testing.T) {
+	llm := New(&mockProvider{})
+	llm.lastSentMessages = []Message{{Role: "user", Content: content.FromText("Hi")}}
+
+	snapshot := llm.Snapshot()
+	snapshot.Messages[0].Content[0].(*content.Text).Text = "Changed"
+	assert.Equal(t, "Hi", llm.lastSentMessages[0].Content[0].(*content.Text).Text)
+	assert.Nil(t, snapshot.ToolChoice, "There is no toolbox to take a choice from")
+}
+
+func TestRestoreRejectsUnknownVersions(t *testing.T) {
+	llm := New(&mockProvider{})
+	assert.ErrorIs(t, llm.Restore(&Snapshot{Version: 0}), ErrUnsupportedSnapshotVersion)
+	assert.ErrorIs(t, llm.Restore(&Snapshot{Version: SnapshotVersion + 1}), ErrUnsupportedSnapshotVersion)
+}
+
+func testConversationStore(t *testing.T, store ConversationStore) {
+	ctx := context.Background()
+
+	_, err := store.Load(ctx, "missing")
+	require.ErrorIs(t, err, ErrConversationNotFound)
+
+	snapshot := &Snapshot{
+		Version: SnapshotVersion,
+		Messages: []Message{
+			{Role: "user", Content: content.FromText("Hello")},
+			{Role: "assistant", Content: content.FromText("Hi!"), ToolCalls: []ToolCall{{ID: "call_1", Name: "test_tool", Arguments: json.RawMessage(`{"a":1}`)}}},
+			{Role: "tool", ToolCallID: "call_1", Content: content.FromText("done")},
+		},
+		Turns:      1,
+		TotalUsage: Usage{InputTokens: 3, OutputTokens: 4},
+	}
+	require.NoError(t, store.Save(ctx, "conversation-1", snapshot))
+
+	loaded, err := store.Load(ctx, "conversation-1")
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, loaded)
+
+	snapshot.Turns = 2
+	require.NoError(t, store.Save(ctx, "conversation-1", snapshot))
+	loaded, err = store.Load(ctx, "conversation-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, loaded.Turns)
+
+	require.NoError(t, store.Delete(ctx, "conversation-1"))
+	require.NoError(t, store.Delete(ctx, "conversation-1"))
+	_, err = store.Load(ctx, "conversation-1")
+	require.ErrorIs(t, err, ErrConversationNotFound)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testConversationStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "conversations")
+	store := NewFileStore(dir)
+	testConversationStore(t, store)
+
+	for _, id := range []string{"", "..", "a/b", `a\b`} {
+		assert.ErrorIs(t, store.Save(context.Background(), id, &Snapshot{}), ErrInvalidConversationID, "id %q", id)
+	}
+
+	require.NoError(t, store.Save(context.Background(), "kept", &Snapshot{Version: SnapshotVersion}))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "No temporary files should be left behind")
+	assert.Equal(t, "kept.json", entries[0].Name())
+}
@@ -0,0 +1,99 @@
+package llms
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// StopReason describes why the model stopped generating, normalized across
+// providers.
+type StopReason string
+
+const (
+	// StopReasonEndTurn means the model finished its response.
+	StopReasonEndTurn StopReason = "end_turn"
+	// StopReasonToolUse means the model stopped to have its tool calls run.
+	StopReasonToolUse StopReason = "tool_use"
+	// StopReasonMaxTokens means the response was cut off at the output token
+	// limit (see ErrOutputTruncated).
+	StopReasonMaxTokens StopReason = "max_tokens"
+	// StopReasonStopSequence means the model produced one of the requested
+	// stop sequences.
+	StopReasonStopSequence StopReason = "stop_sequence"
+	// StopReasonContentFilter means the provider blocked the response, or the
+	// prompt, for safety reasons (see ErrContentFiltered).
+	StopReasonContentFilter StopReason = "content_filter"
+	// StopReasonRefusal means the model declined to respond. Whatever it said
+	// instead, such as OpenAI's refusal message, is in the message content.
+	StopReasonRefusal StopReason = "refusal"
+	// StopReasonPauseTurn means the provider paused a long-running turn, such
+	// as one with many server-side tool calls. The LLM continues it with
+	// another request.
+	StopReasonPauseTurn StopReason = "pause_turn"
+	// StopReasonOther is any reason the provider gave that has no normalized
+	// equivalent.
+	StopReasonOther StopReason = "other"
+)
+
+// StopReasoner is implemented by provider streams that report why the model
+// stopped. The LLM records it on the assistant message, unless the stream's
+// Message already has a StopReason.
+type StopReasoner interface {
+	ProviderStream
+	// StopReason returns why the model stopped, once the stream is done.
+	StopReason() StopReason
+}
+
+var (
+	// ErrContentFiltered is returned when the provider blocked the response
+	// or the prompt for safety reasons.
+	ErrContentFiltered = errors.New("content filtered")
+	// ErrUnexpectedStopReason is returned when a response stopped for a reason
+	// the provider doesn't normally stop for.
+	ErrUnexpectedStopReason = errors.New("unexpected stop reason")
+)
+
+// SafetyRating is a provider's assessment of how likely a response or prompt
+// is to be harmful in a category (Gemini).
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability,omitempty"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// StopReasonError is returned when a response stopped for a reason that makes
+// it unusable, such as a content filter. It wraps ErrContentFiltered or
+// ErrUnexpectedStopReason, depending on the Reason.
+type StopReasonError struct {
+	Reason StopReason
+	// ProviderReason is the provider's own name for the reason, such as
+	// "SAFETY" or "content_filter".
+	ProviderReason string
+	// SafetyRatings holds the safety ratings of a filtered response or prompt,
+	// if the provider gave any.
+	SafetyRatings []SafetyRating
+}
+
+func (e *StopReasonError) Error() string {
+	msg := fmt.Sprintf("%v (reason=%q)", e.Unwrap(), e.ProviderReason)
+	var blocked []string
+	for _, rating := range e.SafetyRatings {
+		if rating.Blocked {
+			blocked = append(blocked, rating.Category)
+		}
+	}
+	if len(blocked) > 0 {
+		msg += fmt.Sprintf(", blocked for %s", strings.Join(blocked, ", "))
+	}
+	return msg
+}
+
+func (e *StopReasonError) Unwrap() error {
+	switch e.Reason {
+	case StopReasonContentFilter:
+		return ErrContentFiltered
+	default:
+		return ErrUnexpectedStopReason
+	}
+}
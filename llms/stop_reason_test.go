@@ -0,0 +1,84 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// stopReasonProvider responds with the given stop reasons in turn.
+type stopReasonProvider struct {
+	mockProvider
+	reasons []StopReason
+	calls   int
+}
+
+func (p *stopReasonProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) ProviderStream {
+	reason := p.reasons[min(p.calls, len(p.reasons)-1)]
+	p.calls++
+	return &stopReasonStream{mockStream: &mockStream{provider: &p.mockProvider, textToGenerate: "Hello"}, reason: reason}
+}
+
+type stopReasonStream struct {
+	*mockStream
+	reason StopReason
+}
+
+func (s *stopReasonStream) StopReason() StopReason { return s.reason }
+
+// stopErrorProvider fails every request with the given error.
+type stopErrorProvider struct {
+	mockProvider
+	err error
+}
+
+func (p *stopErrorProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) ProviderStream {
+	return &errorStream{err: p.err}
+}
+
+func TestStopReasonOnMessage(t *testing.T) {
+	llm := New(&stopReasonProvider{reasons: []StopReason{StopReasonStopSequence}})
+	response, err := llm.Generate(context.Background(), content.FromText("Hi"))
+	require.NoError(t, err)
+	assert.Equal(t, StopReasonStopSequence, response.Message.StopReason)
+	assert.Equal(t, StopReasonStopSequence, response.StopReason)
+}
+
+func TestStopReasonPauseTurnContinues(t *testing.T) {
+	provider := &stopReasonProvider{reasons: []StopReason{StopReasonPauseTurn, StopReasonEndTurn}}
+	llm := New(provider)
+	response, err := llm.Generate(context.Background(), content.FromText("Hi"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, provider.calls)
+	require.Len(t, llm.Messages(), 3)
+	assert.Equal(t, StopReasonPauseTurn, llm.Messages()[1].StopReason)
+	assert.Equal(t, StopReasonEndTurn, response.StopReason)
+}
+
+func TestStopReasonError(t *testing.T) {
+	stopErr := &StopReasonError{
+		Reason:         StopReasonContentFilter,
+		ProviderReason: "SAFETY",
+		SafetyRatings: []SafetyRating{
+			{Category: "HARM_CATEGORY_HARASSMENT", Probability: "LOW"},
+			{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Probability: "HIGH", Blocked: true},
+		},
+	}
+	assert.ErrorIs(t, stopErr, ErrContentFiltered)
+	assert.Equal(t, `content filtered (reason="SAFETY"), blocked for HARM_CATEGORY_DANGEROUS_CONTENT`, stopErr.Error())
+	assert.ErrorIs(t, &StopReasonError{Reason: StopReasonOther}, ErrUnexpectedStopReason)
+
+	llm := New(&stopErrorProvider{err: stopErr})
+	response, err := llm.Generate(context.Background(), content.FromText("Hi"))
+	var got *StopReasonError
+	require.ErrorAs(t, err, &got)
+	assert.Equal(t, stopErr.SafetyRatings, got.SafetyRatings)
+	assert.Equal(t, StopReasonContentFilter, response.StopReason)
+	assert.False(t, errors.Is(err, ErrOutputTruncated))
+}
@@ -0,0 +1,162 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrConversationNotFound is returned by ConversationStore.Load for an ID
+	// that has no saved conversation.
+	ErrConversationNotFound = errors.New("conversation not found")
+	// ErrInvalidConversationID is returned for IDs a store can't use.
+	ErrInvalidConversationID = errors.New("invalid conversation ID")
+)
+
+// ConversationStore persists conversation snapshots by ID, so that a
+// conversation can be resumed later or elsewhere:
+//
+//	if err := store.Save(ctx, id, llm.Snapshot()); err != nil { ... }
+//	...
+//	snapshot, err := store.Load(ctx, id)
+//	if err != nil { ... }
+//	err = llm.Restore(snapshot)
+type ConversationStore interface {
+	// Save stores the snapshot under the given ID, replacing any snapshot
+	// that was stored under it before.
+	Save(ctx context.Context, id string, snapshot *Snapshot) error
+	// Load returns the snapshot stored under the given ID, or an error
+	// wrapping ErrConversationNotFound if there is none.
+	Load(ctx context.Context, id string) (*Snapshot, error)
+	// Delete removes the snapshot stored under the given ID. Deleting an ID
+	// that has no snapshot is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryStore is a ConversationStore that keeps snapshots in memory. It is safe
+// for concurrent use. Snapshots are stored encoded, so the ones it returns
+// never share memory with the ones it was given.
+type MemoryStore struct {
+	mu        sync.Mutex
+	snapshots map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{snapshots: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, id string, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[id] = data
+	return nil
+}
+
+func (s *MemoryStore) Load(ctx context.Context, id string) (*Snapshot, error) {
+	s.mu.Lock()
+	data, ok := s.snapshots[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrConversationNotFound, id)
+	}
+	return decodeSnapshot(data)
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.snapshots, id)
+	return nil
+}
+
+// FileStore is a ConversationStore that keeps each snapshot in a JSON file
+// named after its ID in a directory. IDs can't contain path separators.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore that keeps its files in dir, which is
+// created on the first Save if it doesn't exist.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidConversationID, id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *FileStore) Save(ctx context.Context, id string, snapshot *Snapshot) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that a crash halfway through never
+	// leaves a truncated snapshot behind.
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Load(ctx context.Context, id string) (*Snapshot, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q", ErrConversationNotFound, id)
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeSnapshot(data)
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func decodeSnapshot(data []byte) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,62 @@
+package llms
+
+import (
+	"context"
+	"iter"
+
+	"github.com/flitsinc/go-llms/content"
+)
+
+// Stream sends a message history to the LLM and returns an iterator over the
+// updates, like ChatUsingMessages does over a channel. Rather than starting a
+// goroutine, the turns run as the iterator is ranged over, and an error that
+// ends the chat is yielded as the last element with a nil Update:
+//
+//	for update, err := range llm.Stream(ctx, messages) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// Breaking out of the loop cancels the chat, including the provider request
+// and any running tools, before the loop exits; the conversation is left as
+// it was after the last completed turn, and Err reports context.Canceled.
+// Unlike with ChatUsingMessages, a panic in a provider or tool isn't
+// recovered.
+func (l *LLM) Stream(ctx context.Context, messages []Message, opts ...ChatOption) iter.Seq2[Update, error] {
+	return func(yield func(Update, error) bool) {
+		l.startChat(messages, opts)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// run only emits from this goroutine, even for parallel tool calls,
+		// so updates are yielded here until the consumer breaks out of the
+		// loop.
+		stopped := false
+		emit := func(update Update) {
+			if stopped {
+				return
+			}
+			if !yield(update, nil) {
+				stopped = true
+				cancel()
+			}
+		}
+
+		l.err = l.run(ctx, emit)
+		if l.err != nil && !stopped {
+			yield(nil, l.err)
+		}
+	}
+}
+
+// StreamContent is like Stream, but sends a single user message, like
+// ChatUsingContent does.
+func (l *LLM) StreamContent(ctx context.Context, message content.Content, opts ...ChatOption) iter.Seq2[Update, error] {
+	return l.Stream(ctx, append(l.lastSentMessages, Message{
+		Role:    "user",
+		Content: message,
+	}), opts...)
+}
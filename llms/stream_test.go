@@ -0,0 +1,100 @@
+package llms
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+func TestStream(t *testing.T) {
+	llm := New(&mockProvider{toolCallsToMake: []string{"test_tool"}}, testTool)
+
+	var types []UpdateType
+	for update, err := range llm.StreamContent(context.Background(), content.FromText("Use the tool")) {
+		require.NoError(t, err)
+		types = append(types, update.Type())
+	}
+	require.NoError(t, llm.Err())
+	assert.Equal(t, []UpdateType{
+		UpdateTypeText, UpdateTypeToolStart, UpdateTypeToolDelta, UpdateTypeToolDelta, UpdateTypeToolDone,
+		UpdateTypeText,
+	}, types)
+	assert.Len(t, llm.Messages(), 4)
+}
+
+// goroutineID returns the ID of the current goroutine, from its stack trace.
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	return string(bytes.Fields(buf)[1])
+}
+
+func TestStreamYieldsOnCallersGoroutine(t *testing.T) {
+	reporter := tools.Func("Reporter", "Reports its progress", "reporter",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			r.Report("working")
+			return tools.SuccessFromString("done")
+		})
+	llm := New(&mockProvider{toolCallsToMake: []string{"reporter", "reporter"}}, reporter).WithParallelToolCalls(2)
+
+	caller := goroutineID()
+	statuses := 0
+	for update, err := range llm.StreamContent(context.Background(), content.FromText("Report")) {
+		require.NoError(t, err)
+		assert.Equal(t, caller, goroutineID(), "%T was yielded from another goroutine", update)
+		if _, ok := update.(ToolStatusUpdate); ok {
+			statuses++
+		}
+	}
+	require.NoError(t, llm.Err())
+	assert.Equal(t, 2, statuses)
+}
+
+func TestStreamYieldsError(t *testing.T) {
+	llm := New(&errorMockProvider{errorMessage: "boom"})
+
+	var errs []error
+	for update, err := range llm.Stream(context.Background(), []Message{{Role: "user", Content: content.FromText("Hi")}}) {
+		assert.Nil(t, update)
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "boom")
+	assert.Equal(t, errs[0], llm.Err())
+}
+
+func TestStreamBreakCancels(t *testing.T) {
+	var canceled atomic.Bool
+	blocker := tools.Func("Blocker", "Blocks until canceled", "blocker",
+		func(r tools.Runner, p TestToolParams) tools.Result {
+			r.Report("waiting")
+			<-r.Context().Done()
+			canceled.Store(true)
+			return tools.Error(r.Context().Err())
+		})
+	llm := New(&mockProvider{toolCallsToMake: []string{"blocker", "blocker"}}, blocker).WithParallelToolCalls(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for update, err := range llm.StreamContent(ctx, content.FromText("Block")) {
+		require.NoError(t, err)
+		if _, ok := update.(ToolStatusUpdate); ok {
+			break
+		}
+	}
+
+	// Both tools were canceled, and nothing runs after the loop.
+	assert.True(t, canceled.Load())
+	assert.ErrorIs(t, llm.Err(), context.Canceled)
+	assert.NoError(t, ctx.Err(), "The parent context is left alone")
+	assert.Len(t, llm.Messages(), 1, "The unfinished turn isn't recorded")
+}
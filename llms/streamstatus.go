@@ -26,4 +26,7 @@ const (
 	// StreamStatusSearch means the stream surfaced a provider-run search the model performed
 	// (e.g. xAI's web_search / x_search Agent Tools), with its query and any result count.
 	StreamStatusSearch
+	// StreamStatusCitation means the stream attributed a span of the text it
+	// produced to a source.
+	StreamStatusCitation
 )
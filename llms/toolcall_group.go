@@ -0,0 +1,102 @@
+package llms
+
+import (
+	"fmt"
+	"sync"
+)
+
+// toolCallGroup runs tool calls in the background, at most limit at a time,
+// and hands back their messages in the order the calls were started, no matter
+// which order they finished in. The updates of the tool calls are passed to
+// the goroutine of the turn, which forwards them with relay and wait, so that
+// updates are only ever emitted from one goroutine.
+type toolCallGroup struct {
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	updates chan Update
+
+	mu      sync.Mutex
+	results []Message
+	err     error // The first error or panic of a tool call.
+}
+
+func newToolCallGroup(limit int) *toolCallGroup {
+	return &toolCallGroup{sem: make(chan struct{}, limit), updates: make(chan Update)}
+}
+
+// emit is the emit function of the tool calls. It blocks until the turn
+// forwards the update.
+func (g *toolCallGroup) emit(update Update) {
+	g.updates <- update
+}
+
+// relay forwards the updates that tool calls are waiting to send, without
+// waiting for more.
+func (g *toolCallGroup) relay(emit func(Update)) {
+	for {
+		select {
+		case update := <-g.updates:
+			emit(update)
+		default:
+			return
+		}
+	}
+}
+
+// start runs the tool call in a new goroutine once a slot is free. It never
+// blocks, so the caller can keep reading the provider's stream.
+func (g *toolCallGroup) start(toolCall ToolCall, run func() (Message, error)) {
+	g.mu.Lock()
+	index := len(g.results)
+	g.results = append(g.results, Message{})
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		g.sem <- struct{}{}
+		defer func() { <-g.sem }()
+		defer func() {
+			if rec := recover(); rec != nil {
+				g.mu.Lock()
+				if g.err == nil {
+					g.err = fmt.Errorf("tool call %q (%s) panicked: %v", toolCall.ID, toolCall.Name, rec)
+				}
+				g.mu.Unlock()
+			}
+		}()
+		message, err := run()
+		g.mu.Lock()
+		g.results[index] = message
+		if err != nil && g.err == nil {
+			g.err = err
+		}
+		g.mu.Unlock()
+	}()
+}
+
+// wait blocks until every started tool call has finished, forwarding their
+// updates to emit in the meantime, and returns their messages in the order
+// they were started, or the first error one of them failed with. It is safe
+// to call more than once.
+func (g *toolCallGroup) wait(emit func(Update)) ([]Message, error) {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	for waiting := true; waiting; {
+		select {
+		case update := <-g.updates:
+			emit(update)
+		case <-done:
+			waiting = false
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.results, nil
+}
@@ -2,6 +2,8 @@ package llms
 
 import (
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/flitsinc/go-llms/content"
 	"github.com/flitsinc/go-llms/tools"
@@ -10,17 +12,22 @@ import (
 type UpdateType string
 
 const (
-	UpdateTypeToolStart    UpdateType = "tool_start"
-	UpdateTypeToolDelta    UpdateType = "tool_delta"
-	UpdateTypeToolStatus   UpdateType = "tool_status"
-	UpdateTypeToolDone     UpdateType = "tool_done"
-	UpdateTypeText         UpdateType = "text"
-	UpdateTypeImage        UpdateType = "image"
-	UpdateTypeAudio        UpdateType = "audio"
-	UpdateTypeThinking     UpdateType = "thinking"
-	UpdateTypeThinkingDone UpdateType = "thinking_done"
-	UpdateTypeMessageStart UpdateType = "message_start"
-	UpdateTypeSearch       UpdateType = "search"
+	UpdateTypeToolStart     UpdateType = "tool_start"
+	UpdateTypeToolDelta     UpdateType = "tool_delta"
+	UpdateTypeToolStatus    UpdateType = "tool_status"
+	UpdateTypeToolDone      UpdateType = "tool_done"
+	UpdateTypeText          UpdateType = "text"
+	UpdateTypeImage         UpdateType = "image"
+	UpdateTypeAudio         UpdateType = "audio"
+	UpdateTypeThinking      UpdateType = "thinking"
+	UpdateTypeThinkingDone  UpdateType = "thinking_done"
+	UpdateTypeMessageStart  UpdateType = "message_start"
+	UpdateTypeSearch        UpdateType = "search"
+	UpdateTypeCitation      UpdateType = "citation"
+	UpdateTypeRetry         UpdateType = "retry"
+	UpdateTypePartialObject UpdateType = "partial_object"
+
+	UpdateTypeToolApprovalRequest UpdateType = "tool_approval_request"
 )
 
 const UpdateTypeToolArgumentFinalization UpdateType = "tool_argument_finalization"
@@ -161,3 +168,127 @@ type SearchUpdate struct {
 func (u SearchUpdate) Type() UpdateType {
 	return UpdateTypeSearch
 }
+
+// CitationUpdate is sent when the model cited a source for a span of the text
+// streamed so far. The citation is also attached to the Text item it belongs
+// to in the message content, with the same offsets.
+type CitationUpdate struct {
+	Citation content.Citation
+}
+
+func (u CitationUpdate) Type() UpdateType {
+	return UpdateTypeCitation
+}
+
+// RetryUpdate is sent when a turn failed with a transient error and is about to
+// be retried according to the LLM's RetryPolicy. Nothing from the failed
+// attempt made it into the conversation: a turn is only retried if none of its
+// text, images, audio or tool calls were sent. It may have sent a
+// MessageStartUpdate, thinking and searches, though, which a UI should discard
+// before it shows "retrying..." for Delay and continues as if the attempt
+// never happened. The next attempt starts over, usually with a
+// MessageStartUpdate of its own.
+type RetryUpdate struct {
+	// Attempt is the number of the attempt that is about to start, so the
+	// first retry is attempt 2.
+	Attempt     int
+	MaxAttempts int
+	// Delay is how long the LLM waits before making the next attempt.
+	Delay time.Duration
+	// Err is the error that caused the retry.
+	Err error
+}
+
+func (u RetryUpdate) Type() UpdateType {
+	return UpdateTypeRetry
+}
+
+// PartialObjectUpdate is sent after each TextUpdate that changes the response
+// when the LLM has a JSONOutputSchema, with the JSON so far completed on a
+// best-effort basis (see PartialJSON) so that it can be rendered before the
+// response is done. Use DecodePartialObject to decode it into a struct.
+type PartialObjectUpdate struct {
+	// Object is the response so far, decoded into maps, slices and other
+	// basic Go values.
+	Object any
+	// JSON is the response so far, completed to be valid JSON.
+	JSON json.RawMessage
+}
+
+func (u PartialObjectUpdate) Type() UpdateType {
+	return UpdateTypePartialObject
+}
+
+// DecodePartialObject decodes the response so far into a value of type T.
+// Fields that haven't arrived yet are left at their zero value, and the last
+// field that did arrive may still be incomplete.
+func DecodePartialObject[T any](u PartialObjectUpdate) (T, error) {
+	var value T
+	err := json.Unmarshal(u.JSON, &value)
+	return value, err
+}
+
+// ToolApprovalRequestUpdate is sent when a tool call needs the application's
+// approval before it runs (see LLM.RequiresApproval). The chat is paused until
+// exactly one of Approve, Deny or Edit is called; later calls are ignored. The
+// methods may be called from any goroutine.
+type ToolApprovalRequestUpdate struct {
+	ToolCallID string
+	Tool       tools.Tool
+	// Arguments are the final arguments the model wants to call the tool with.
+	Arguments json.RawMessage
+
+	decisions chan<- toolApproval
+}
+
+func (u ToolApprovalRequestUpdate) Type() UpdateType {
+	return UpdateTypeToolApprovalRequest
+}
+
+// Approve lets the tool call run as the model requested.
+func (u ToolApprovalRequestUpdate) Approve() {
+	u.decide(toolApproval{})
+}
+
+// Deny keeps the tool call from running. The model receives an error result
+// wrapping ErrToolCallDenied, including the reason if one is given.
+func (u ToolApprovalRequestUpdate) Deny(reason string) {
+	u.decide(toolApproval{denied: true, reason: reason})
+}
+
+// Edit lets the tool call run, but with different arguments. The assistant
+// message in the conversation history is updated to match, so the model sees
+// the call as it was actually made. Arguments that aren't valid JSON can't be
+// sent back to the provider, so the call doesn't run and the model receives
+// an error result wrapping ErrInvalidToolCallEdit instead.
+func (u ToolApprovalRequestUpdate) Edit(arguments json.RawMessage) {
+	if !json.Valid(arguments) {
+		u.decide(toolApproval{denied: true, invalidEdit: true})
+		return
+	}
+	u.decide(toolApproval{arguments: append(json.RawMessage{}, arguments...)})
+}
+
+func (u ToolApprovalRequestUpdate) decide(decision toolApproval) {
+	select {
+	case u.decisions <- decision:
+	default: // Already decided.
+	}
+}
+
+type toolApproval struct {
+	denied      bool
+	reason      string
+	arguments   json.RawMessage
+	invalidEdit bool
+}
+
+func (a toolApproval) err() error {
+	if a.invalidEdit {
+		return ErrInvalidToolCallEdit
+	}
+	if a.reason == "" {
+		return ErrToolCallDenied
+	}
+	return fmt.Errorf("%w: %s", ErrToolCallDenied, a.reason)
+}
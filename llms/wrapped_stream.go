@@ -0,0 +1,63 @@
+package llms
+
+import (
+	"encoding/json"
+
+	"github.com/flitsinc/go-llms/content"
+)
+
+// wrappedStream is embedded by the streams of providers that wrap other
+// providers. It reports the provider that produced the stream, and forwards
+// the optional stream capabilities, which the embedded interface hides.
+type wrappedStream struct {
+	ProviderStream
+	provider Provider
+}
+
+var _ StopReasoner = (*wrappedStream)(nil)
+
+// Company returns the company of the provider that produced the stream.
+func (s *wrappedStream) Company() string {
+	if c, ok := s.ProviderStream.(interface{ Company() string }); ok {
+		return c.Company()
+	}
+	return s.provider.Company()
+}
+
+// Model returns the model of the provider that produced the stream.
+func (s *wrappedStream) Model() string {
+	if m, ok := s.ProviderStream.(interface{ Model() string }); ok {
+		return m.Model()
+	}
+	return s.provider.Model()
+}
+
+func (s *wrappedStream) Search() SearchActivity {
+	if searcher, ok := s.ProviderStream.(interface{ Search() SearchActivity }); ok {
+		return searcher.Search()
+	}
+	return SearchActivity{}
+}
+
+func (s *wrappedStream) Citation() content.Citation {
+	if citer, ok := s.ProviderStream.(interface{ Citation() content.Citation }); ok {
+		return citer.Citation()
+	}
+	return content.Citation{}
+}
+
+func (s *wrappedStream) StopReason() StopReason {
+	if stopper, ok := s.ProviderStream.(StopReasoner); ok {
+		return stopper.StopReason()
+	}
+	return ""
+}
+
+func (s *wrappedStream) ToolArgumentFinalization() (json.RawMessage, bool) {
+	if finalizer, ok := s.ProviderStream.(interface {
+		ToolArgumentFinalization() (json.RawMessage, bool)
+	}); ok {
+		return finalizer.ToolArgumentFinalization()
+	}
+	return nil, false
+}
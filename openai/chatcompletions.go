@@ -479,6 +479,31 @@ func (m *ChatCompletionsAPI) Generate(
 	return m.DoRequest(ctx, payload)
 }
 
+// CountTokens estimates the input tokens of a request locally (see
+// llms.EstimateTokens), since OpenAI-compatible endpoints have no way to count
+// them. The request is converted like Generate converts it, so that requests
+// Generate would reject fail here too, and the tools are counted as sent.
+func (m *ChatCompletionsAPI) CountTokens(
+	ctx context.Context,
+	systemPrompt content.Content,
+	messages []llms.Message,
+	toolbox *tools.Toolbox,
+) (int, error) {
+	payload, err := m.BuildPayload(systemPrompt, messages, toolbox, nil)
+	if err != nil {
+		return 0, err
+	}
+	tokens := llms.EstimateRequestTokens(systemPrompt, messages, nil)
+	if apiTools, ok := payload["tools"]; ok {
+		data, err := json.Marshal(apiTools)
+		if err != nil {
+			return 0, fmt.Errorf("error encoding tools: %w", err)
+		}
+		tokens += llms.EstimateContentTokens(content.FromRawJSON(data))
+	}
+	return tokens, nil
+}
+
 // DoRequest sends a pre-built payload and returns a streaming response.
 // This is exported so wrapper providers (e.g. OpenRouter) can build/modify a
 // payload via BuildPayload and then send it.
@@ -532,6 +557,7 @@ func (m *ChatCompletionsAPI) DoRequest(ctx context.Context, payload map[string]a
 			return &ChatCompletionsStream{err: &llms.HTTPError{
 				StatusCode: resp.StatusCode,
 				Status:     resp.Status,
+				RetryAfter: llms.ParseRetryAfter(resp.Header),
 				Message:    body,
 			}}
 		}
@@ -539,6 +565,7 @@ func (m *ChatCompletionsAPI) DoRequest(ctx context.Context, payload map[string]a
 		return &ChatCompletionsStream{err: &llms.HTTPError{
 			StatusCode: resp.StatusCode,
 			Status:     resp.Status,
+			RetryAfter: llms.ParseRetryAfter(resp.Header),
 		}}
 	}
 
@@ -568,8 +595,11 @@ type ChatCompletionsStream struct {
 	lastText    string
 	lastThought *content.Thought
 	usage       *usage
+	refused     bool
 }
 
+var _ llms.StopReasoner = (*ChatCompletionsStream)(nil)
+
 func (s *ChatCompletionsStream) Err() error {
 	return s.err
 }
@@ -602,6 +632,27 @@ func (s *ChatCompletionsStream) Thought() content.Thought {
 	return content.Thought{}
 }
 
+// StopReason returns why the model stopped, once the stream is done.
+func (s *ChatCompletionsStream) StopReason() llms.StopReason {
+	return s.message.StopReason
+}
+
+// chatStopReason normalizes a Chat Completions finish_reason.
+func chatStopReason(reason string) llms.StopReason {
+	switch reason {
+	case "stop":
+		return llms.StopReasonEndTurn
+	case "tool_calls", "function_call":
+		return llms.StopReasonToolUse
+	case "length":
+		return llms.StopReasonMaxTokens
+	case "content_filter":
+		return llms.StopReasonContentFilter
+	default:
+		return llms.StopReasonOther
+	}
+}
+
 func (s *ChatCompletionsStream) Usage() llms.Usage {
 	if s.usage == nil {
 		return llms.Usage{}
@@ -610,6 +661,9 @@ func (s *ChatCompletionsStream) Usage() llms.Usage {
 		CachedInputTokens: s.usage.PromptTokensDetails.CachedTokens,
 		InputTokens:       s.usage.PromptTokens,
 		OutputTokens:      s.usage.CompletionTokens,
+		ReasoningTokens:   s.usage.CompletionTokensDetails.ReasoningTokens,
+		AudioInputTokens:  s.usage.PromptTokensDetails.AudioTokens,
+		AudioOutputTokens: s.usage.CompletionTokensDetails.AudioTokens,
 	}
 }
 
@@ -937,6 +991,22 @@ func (s *ChatCompletionsStream) Iter() func(yield func(llms.StreamStatus) bool)
 					return
 				}
 			}
+			// A refusal is streamed like text, so it ends up in the message
+			// content and the chat can carry on from it.
+			if delta.Refusal != nil && *delta.Refusal != "" {
+				s.refused = true
+				if s.lastThought != nil {
+					s.lastThought = nil
+					if !yield(llms.StreamStatusThinkingDone) {
+						return
+					}
+				}
+				s.lastText = *delta.Refusal
+				s.message.Content.Append(s.lastText)
+				if !yield(llms.StreamStatusText) {
+					return
+				}
+			}
 
 			// Handle Tool Calls Delta
 			if len(delta.ToolCalls) > 0 {
@@ -1006,8 +1076,12 @@ func (s *ChatCompletionsStream) Iter() func(yield func(llms.StreamStatus) bool)
 			}
 			// Check if the overall message is finished
 			if chunk.Choices[0].FinishReason != nil {
+				s.message.StopReason = chatStopReason(*chunk.Choices[0].FinishReason)
+				if s.refused {
+					s.message.StopReason = llms.StopReasonRefusal
+				}
 				switch *chunk.Choices[0].FinishReason {
-				case "tool_calls":
+				case "tool_calls", "function_call":
 					if activeToolCallIndex != -1 {
 						if !yield(llms.StreamStatusToolCallReady) {
 							return // Abort if yield fails
@@ -1019,6 +1093,8 @@ func (s *ChatCompletionsStream) Iter() func(yield func(llms.StreamStatus) bool)
 					// Do not return here. The stream may still deliver a usage chunk
 					// (with empty choices) that populates s.usage. The loop will exit
 					// naturally when the stream ends, and s.err is returned via Err().
+				case "content_filter":
+					s.err = &llms.StopReasonError{Reason: llms.StopReasonContentFilter, ProviderReason: *chunk.Choices[0].FinishReason}
 				}
 			}
 		}
@@ -562,6 +562,23 @@ func TestBuildPayload_EncodesVideoURLContent(t *testing.T) {
 	assert.Equal(t, map[string]any{"url": "https://example.com/clip.mp4"}, videoPart["video_url"])
 }
 
+func TestConvertContent_Document(t *testing.T) {
+	cl, err := convertContentWithOptions(content.Content{
+		&content.Document{URL: "data:application/pdf;base64,JVBERi0="},
+		&content.Document{URL: "data:application/pdf;base64,JVBERi0=", Title: "report.pdf"},
+	}, chatMessageEncodingOptions{})
+	require.NoError(t, err)
+	require.Len(t, cl, 2)
+	assert.Equal(t, "file", cl[0].Type)
+	assert.Equal(t, &file{Filename: "document.pdf", FileData: "data:application/pdf;base64,JVBERi0="}, cl[0].File)
+	assert.Equal(t, "report.pdf", cl[1].File.Filename)
+
+	_, err = convertContentWithOptions(content.Content{
+		&content.Document{URL: "https://example.com/paper.pdf"},
+	}, chatMessageEncodingOptions{})
+	assert.Error(t, err, "Chat Completions only accepts inline files")
+}
+
 func TestBuildPayload_EncodesAudioURLContent(t *testing.T) {
 	m := NewChatCompletionsAPI("", "gpt-4o-audio-preview")
 	payload, err := m.BuildPayload(
@@ -835,6 +852,84 @@ func TestChatCompletionsStream_ReasoningSummaryDeltaAndAggregate(t *testing.T) {
 	assert.Equal(t, "anthropic-claude-v1", summary.Metadata["openai:reasoning_format"])
 }
 
+func TestChatCompletionsStream_UsageDetails(t *testing.T) {
+	sse := strings.Join([]string{
+		`data: {"id":"chat_1","choices":[{"delta":{"role":"assistant","content":"Hi"}}]}`,
+		`data: {"id":"chat_1","choices":[],"usage":{"prompt_tokens":100,"completion_tokens":50,"total_tokens":150,"prompt_tokens_details":{"cached_tokens":20,"audio_tokens":30},"completion_tokens_details":{"reasoning_tokens":10,"audio_tokens":5}}}`,
+		`data: [DONE]`,
+		"",
+	}, "\n")
+
+	stream := &ChatCompletionsStream{ctx: context.Background(), model: "test", stream: strings.NewReader(sse)}
+	for range stream.Iter() {
+	}
+	require.NoError(t, stream.Err())
+	assert.Equal(t, llms.Usage{
+		CachedInputTokens: 20,
+		InputTokens:       100,
+		OutputTokens:      50,
+		ReasoningTokens:   10,
+		AudioInputTokens:  30,
+		AudioOutputTokens: 5,
+	}, stream.Usage())
+}
+
+func TestChatCompletionsStream_StopReasons(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		chunks []string
+		want   llms.StopReason
+		err    error
+		text   string
+	}{
+		{
+			name:   "stop",
+			chunks: []string{`{"id":"c","choices":[{"delta":{"content":"Hi"},"finish_reason":"stop"}]}`},
+			want:   llms.StopReasonEndTurn,
+			text:   "Hi",
+		},
+		{
+			name:   "content filter",
+			chunks: []string{`{"id":"c","choices":[{"delta":{},"finish_reason":"content_filter"}]}`},
+			want:   llms.StopReasonContentFilter,
+			err:    llms.ErrContentFiltered,
+		},
+		{
+			name: "refusal",
+			chunks: []string{
+				`{"id":"c","choices":[{"delta":{"refusal":"I can't "}}]}`,
+				`{"id":"c","choices":[{"delta":{"refusal":"help with that."},"finish_reason":"stop"}]}`,
+			},
+			want: llms.StopReasonRefusal,
+			text: "I can't help with that.",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var sse strings.Builder
+			for _, chunk := range tc.chunks {
+				sse.WriteString("data: " + chunk + "\n")
+			}
+			sse.WriteString("data: [DONE]\n")
+			stream := &ChatCompletionsStream{ctx: context.Background(), model: "test", stream: strings.NewReader(sse.String())}
+			var streamed strings.Builder
+			for status := range stream.Iter() {
+				if status == llms.StreamStatusText {
+					streamed.WriteString(stream.Text())
+				}
+			}
+			if tc.err == nil {
+				require.NoError(t, stream.Err())
+			} else {
+				require.ErrorIs(t, stream.Err(), tc.err)
+			}
+			assert.Equal(t, tc.want, stream.StopReason())
+			text, _ := stream.Message().Content.AsString()
+			assert.Equal(t, tc.text, text)
+			assert.Equal(t, tc.text, streamed.String())
+		})
+	}
+}
+
 func TestChatCompletionsStream_ApplyReasoningDetail_DoesNotMatchDifferentIDByIndex(t *testing.T) {
 	stream := &ChatCompletionsStream{
 		message: llms.Message{
@@ -1107,3 +1202,20 @@ func TestChatCompletionsStream_LegacyReasoningFieldAloneStillStreams(t *testing.
 func intPtr(v int) *int {
 	return &v
 }
+
+func TestChatCompletions_CountTokensEstimates(t *testing.T) {
+	m := NewChatCompletionsAPI("", "gpt-4o")
+	messages := []llms.Message{{Role: "user", Content: content.FromText("What's the weather in Paris?")}}
+
+	withoutTools, err := llms.CountTokens(context.Background(), m, content.FromText("Be brief."), messages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, llms.EstimateRequestTokens(content.FromText("Be brief."), messages, nil), withoutTools)
+
+	weatherSchema := tools.FunctionSchema{Name: "get_weather", Description: "Get the weather for a city", Parameters: tools.ValueSchema{Type: "object"}}
+	toolbox := tools.Box(tools.External("Weather", &weatherSchema, func(r tools.Runner, params json.RawMessage) tools.Result {
+		return tools.SuccessFromString("ok")
+	}))
+	withTools, err := m.CountTokens(context.Background(), content.FromText("Be brief."), messages, toolbox)
+	require.NoError(t, err)
+	assert.Greater(t, withTools, withoutTools)
+}
@@ -3,6 +3,9 @@ package openai
 import (
 	"encoding/json"
 	"fmt"
+	"mime"
+	"net/url"
+	"path"
 	"strings"
 
 	"github.com/flitsinc/go-llms/content"
@@ -37,6 +40,11 @@ type videoURL struct {
 	URL string `json:"url"`
 }
 
+type file struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+}
+
 // CacheControl represents a cache control directive on a content part.
 type CacheControl struct {
 	Type string `json:"type"`
@@ -50,6 +58,7 @@ type ContentPart struct {
 	ImageURL     *imageURL     `json:"image_url,omitempty"`
 	InputAudio   *inputAudio   `json:"input_audio,omitempty"`
 	VideoURL     *videoURL     `json:"video_url,omitempty"`
+	File         *file         `json:"file,omitempty"`
 	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
@@ -94,6 +103,13 @@ func convertContentWithOptions(c content.Content, opts chatMessageEncodingOption
 		case *content.VideoURL:
 			cp.Type = "video_url"
 			cp.VideoURL = &videoURL{URL: v.URL}
+		case *content.Document:
+			// Files can only be sent inline.
+			if !strings.HasPrefix(v.URL, "data:") {
+				return nil, fmt.Errorf("openai chat completions: documents must be data URIs, got %q", v.URL)
+			}
+			cp.Type = "file"
+			cp.File = &file{Filename: documentFilename(v), FileData: v.URL}
 		case *content.JSON:
 			cp.Type = "text"
 			text := string(v.Data)
@@ -101,6 +117,9 @@ func convertContentWithOptions(c content.Content, opts chatMessageEncodingOption
 		case *content.Thought:
 			// Thoughts are encoded separately as reasoning_details when enabled.
 			continue
+		case *content.ServerTool:
+			// Another provider's server tool call, which can't be replayed here.
+			continue
 		case *content.CacheHint:
 			if opts.cacheControlPromptHints {
 				if i := len(cl) - 1; i >= 0 {
@@ -116,6 +135,28 @@ func convertContentWithOptions(c content.Content, opts chatMessageEncodingOption
 	return cl, nil
 }
 
+// documentFilename returns the filename to send a document as, which the API
+// requires and uses to tell the model what the file is.
+func documentFilename(doc *content.Document) string {
+	if doc.Title != "" {
+		return doc.Title
+	}
+	if !strings.HasPrefix(doc.URL, "data:") {
+		if u, err := url.Parse(doc.URL); err == nil && path.Base(u.Path) != "." && path.Base(u.Path) != "/" {
+			return path.Base(u.Path)
+		}
+	}
+	name := "document"
+	mimeType := doc.MimeType
+	if mimeType == "" {
+		mimeType = content.ExtractMIMETypeFromURIOrURL(doc.URL)
+	}
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		name += exts[0]
+	}
+	return name
+}
+
 func inputAudioFromContent(item *content.AudioURL) *inputAudio {
 	data := item.URL
 	mimeType := item.MimeType
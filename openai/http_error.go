@@ -32,6 +32,7 @@ func parseHTTPError(resp *http.Response, bodyBytes []byte) (*llms.HTTPError, boo
 	return &llms.HTTPError{
 		StatusCode: resp.StatusCode,
 		Status:     resp.Status,
+		RetryAfter: llms.ParseRetryAfter(resp.Header),
 		ErrorCode:  rawJSONScalarString(openAIError.Error.Code),
 		ErrorType:  openAIError.Error.Type,
 		Message:    openAIError.Error.Message,
@@ -231,6 +231,7 @@ func (m *ResponsesAPI) Generate(
 		return newResponsesStreamError(&llms.HTTPError{
 			StatusCode: resp.StatusCode,
 			Status:     resp.Status,
+			RetryAfter: llms.ParseRetryAfter(resp.Header),
 		})
 	}
 
@@ -252,6 +253,8 @@ type ResponsesStream struct {
 	stream                  io.Reader
 }
 
+var _ llms.StopReasoner = (*ResponsesStream)(nil)
+
 func newResponsesStreamError(err error) *ResponsesStream {
 	return &ResponsesStream{responsesEventProcessor: responsesEventProcessor{err: err}}
 }
@@ -303,14 +306,7 @@ func (s *ResponsesStream) Search() llms.SearchActivity {
 }
 
 func (s *ResponsesStream) Usage() llms.Usage {
-	if s.usage == nil {
-		return llms.Usage{}
-	}
-	return llms.Usage{
-		CachedInputTokens: s.usage.InputTokensDetails.CachedTokens,
-		InputTokens:       s.usage.InputTokens,
-		OutputTokens:      s.usage.OutputTokens,
-	}
+	return s.llmUsage()
 }
 
 func (s *ResponsesStream) Iter() func(yield func(llms.StreamStatus) bool) {
@@ -465,6 +461,8 @@ func convertMessageToInput(msg llms.Message, customCallIDs map[string]bool) ([]R
 				seenReasoningIDs[v.ID] = true
 			case *content.CacheHint:
 				// Cache hints are input-only markers; ignore when replaying assistant output.
+			case *content.ServerTool:
+				// Another provider's server tool call, which can't be replayed here.
 			default:
 				return nil, fmt.Errorf("openai responses: unsupported assistant content item type %T", item)
 			}
@@ -569,6 +567,14 @@ func convertContentToInputContent(c content.Content) ([]InputContent, error) {
 				ImageURL: v.URL,
 				Detail:   "auto",
 			})
+		case *content.Document:
+			file := InputFile{Type: "input_file", Filename: documentFilename(v)}
+			if strings.HasPrefix(v.URL, "data:") {
+				file.FileData = v.URL
+			} else {
+				file.FileURL = v.URL
+			}
+			inputContent = append(inputContent, file)
 		case *content.JSON:
 			inputContent = append(inputContent, InputText{
 				Type: "input_text",
@@ -576,6 +582,8 @@ func convertContentToInputContent(c content.Content) ([]InputContent, error) {
 			})
 		case *content.Thought:
 			// Skip thoughts in input
+		case *content.ServerTool:
+			// Skip other providers' server tool calls
 		case *content.CacheHint:
 			// Skip cache hints
 		default:
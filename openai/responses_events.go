@@ -31,6 +31,15 @@ type responsesEventProcessor struct {
 	// x_user_search / x_keyword_search server-side) by their output item id, so the streamed
 	// query can be accumulated and surfaced once the call completes.
 	hostedSearch map[string]*hostedSearchCall
+	// webSearchCalls and codeInterpreterCalls count the provider-run tool
+	// calls of the response, which are billed per call.
+	webSearchCalls, codeInterpreterCalls int
+	// refused is set if the model refused to respond.
+	refused bool
+	// textPartStart is where the current output_text part starts in the last
+	// text item of the message, since annotations index into the part.
+	textPartStart int
+	lastCitation  content.Citation
 }
 
 type toolArgumentFinalization struct {
@@ -43,6 +52,93 @@ type hostedSearchCall struct {
 	input  strings.Builder
 }
 
+// StopReason returns why the model stopped, once the stream is done.
+func (p *responsesEventProcessor) StopReason() llms.StopReason {
+	return p.message.StopReason
+}
+
+// Citation returns the citation of the last StreamStatusCitation.
+func (p *responsesEventProcessor) Citation() content.Citation {
+	return p.lastCitation
+}
+
+// citationFromAnnotation converts an output_text annotation to a citation,
+// or reports false for annotations that aren't citations.
+func (p *responsesEventProcessor) citationFromAnnotation(raw json.RawMessage) (content.Citation, bool) {
+	var annotation struct {
+		Type        string `json:"type"`
+		URL         string `json:"url"`
+		Title       string `json:"title"`
+		FileID      string `json:"file_id"`
+		Filename    string `json:"filename"`
+		ContainerID string `json:"container_id"`
+		Index       int    `json:"index"`
+		StartIndex  int    `json:"start_index"`
+		EndIndex    int    `json:"end_index"`
+	}
+	if err := json.Unmarshal(raw, &annotation); err != nil {
+		return content.Citation{}, false
+	}
+	citation := content.Citation{Metadata: map[string]string{"openai:type": annotation.Type}}
+	switch annotation.Type {
+	case "url_citation":
+		citation.Source = "web"
+		citation.URL = annotation.URL
+		citation.Title = annotation.Title
+	case "file_citation":
+		// File citations point at a position rather than a span.
+		annotation.StartIndex, annotation.EndIndex = annotation.Index, annotation.Index
+		citation.Source = "file"
+		citation.FileID = annotation.FileID
+		citation.Title = annotation.Filename
+	case "container_file_citation":
+		citation.Source = "file"
+		citation.FileID = annotation.FileID
+		citation.Title = annotation.Filename
+		citation.Metadata["openai:container_id"] = annotation.ContainerID
+	default:
+		return content.Citation{}, false
+	}
+	// Annotations index characters of the current part, while citations
+	// index bytes of the whole text item.
+	var text string
+	if l := len(p.message.Content); l > 0 {
+		if tc, ok := p.message.Content[l-1].(*content.Text); ok && p.textPartStart <= len(tc.Text) {
+			text = tc.Text[p.textPartStart:]
+		}
+	}
+	citation.Start = p.textPartStart + byteOffset(text, annotation.StartIndex)
+	citation.End = p.textPartStart + byteOffset(text, annotation.EndIndex)
+	return citation, true
+}
+
+// byteOffset returns the byte offset of the n-th character of s, or the
+// length of s if it's shorter.
+func byteOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+// llmUsage returns the usage of the response so far.
+func (p *responsesEventProcessor) llmUsage() llms.Usage {
+	usage := llms.Usage{
+		WebSearchRequests:     p.webSearchCalls,
+		CodeExecutionRequests: p.codeInterpreterCalls,
+	}
+	if p.usage != nil {
+		usage.CachedInputTokens = p.usage.InputTokensDetails.CachedTokens
+		usage.InputTokens = p.usage.InputTokens
+		usage.OutputTokens = p.usage.OutputTokens
+		usage.ReasoningTokens = p.usage.OutputTokensDetails.ReasoningTokens
+	}
+	return usage
+}
+
 // processImageItem processes a single image_generation_call item and yields
 // StreamStatusImage. It returns true when the caller should stop processing
 // (i.e. the yield callback returned false).
@@ -232,6 +328,49 @@ func (p *responsesEventProcessor) processEvent(
 			}
 		}
 
+	// A refusal is streamed like text, so it ends up in the message content
+	// and the chat can carry on from it.
+	case "response.refusal.delta":
+		var delta struct {
+			Delta string `json:"delta"`
+		}
+		if err := json.Unmarshal(rawJSON, &delta); err == nil && delta.Delta != "" {
+			p.refused = true
+			p.lastText = delta.Delta
+			p.message.Content.Append(p.lastText)
+			if !yield(llms.StreamStatusText) {
+				return true
+			}
+		}
+
+	case "response.refusal.done":
+		if !p.refused && event.Refusal != "" {
+			// No deltas were streamed, so the whole refusal is in this event.
+			p.lastText = event.Refusal
+			p.message.Content.Append(p.lastText)
+			if !yield(llms.StreamStatusText) {
+				return true
+			}
+		}
+		p.refused = true
+
+	case "response.content_part.added":
+		var part struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(event.Part, &part); err == nil && part.Type == "output_text" {
+			p.textPartStart = p.message.Content.TextLen()
+		}
+
+	case "response.output_text.annotation.added":
+		if citation, ok := p.citationFromAnnotation(event.Annotation); ok {
+			p.message.Content.AddCitation(citation)
+			p.lastCitation = citation
+			if !yield(llms.StreamStatusCitation) {
+				return true
+			}
+		}
+
 	case "response.output_text.delta":
 		var delta struct {
 			Delta string `json:"delta"`
@@ -369,6 +508,7 @@ func (p *responsesEventProcessor) processEvent(
 		if err := json.Unmarshal(event.Item, &itemHdr); err == nil {
 			switch itemHdr.Type {
 			case "web_search_call":
+				p.webSearchCalls++
 				// A completed provider-run web search. The query lives in the search action,
 				// which also carries the result sources; open_page / find actions carry a URL
 				// instead, so they yield no query.
@@ -410,6 +550,8 @@ func (p *responsesEventProcessor) processEvent(
 						}
 					}
 				}
+			case "code_interpreter_call":
+				p.codeInterpreterCalls++
 			case "image_generation_call":
 				if p.processImageItem(event.Item, yield) {
 					return true
@@ -471,9 +613,14 @@ func (p *responsesEventProcessor) processEvent(
 				}
 				switch reason {
 				case "max_output_tokens":
+					p.message.StopReason = llms.StopReasonMaxTokens
 					p.err = fmt.Errorf("%w (reason=%q)", llms.ErrOutputTruncated, reason)
+				case "content_filter":
+					p.message.StopReason = llms.StopReasonContentFilter
+					p.err = &llms.StopReasonError{Reason: p.message.StopReason, ProviderReason: reason}
 				default:
-					p.err = fmt.Errorf("response incomplete (reason=%q)", reason)
+					p.message.StopReason = llms.StopReasonOther
+					p.err = &llms.StopReasonError{Reason: p.message.StopReason, ProviderReason: reason}
 				}
 			}
 		}
@@ -487,6 +634,14 @@ func (p *responsesEventProcessor) processEvent(
 		return true
 
 	case "response.completed":
+		switch {
+		case p.refused:
+			p.message.StopReason = llms.StopReasonRefusal
+		case len(p.message.ToolCalls) > 0:
+			p.message.StopReason = llms.StopReasonToolUse
+		default:
+			p.message.StopReason = llms.StopReasonEndTurn
+		}
 		if event.Response != nil {
 			var response struct {
 				Usage  *responsesUsage   `json:"usage"`
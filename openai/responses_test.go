@@ -286,12 +286,66 @@ func TestConvertMessageToInput_AssistantReasoningAndOutput(t *testing.T) {
 	}
 }
 
+func TestConvertContentToInputContent_Document(t *testing.T) {
+	input, err := convertContentToInputContent(content.Content{
+		&content.Document{URL: "data:application/pdf;base64,JVBERi0=", Title: "report.pdf"},
+		&content.Document{URL: "https://example.com/files/paper.pdf"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []InputContent{
+		InputFile{Type: "input_file", FileData: "data:application/pdf;base64,JVBERi0=", Filename: "report.pdf"},
+		InputFile{Type: "input_file", FileURL: "https://example.com/files/paper.pdf", Filename: "paper.pdf"},
+	}, input)
+}
+
+func TestResponsesStream_Citations(t *testing.T) {
+	sse := strings.Join([]string{
+		`data: {"type":"response.created"}`,
+		`data: {"type":"response.output_item.added","item":{"type":"message","id":"msg_1","role":"assistant"}}`,
+		`data: {"type":"response.content_part.added","part":{"type":"output_text","text":""},"item_id":"msg_1","content_index":0}`,
+		`data: {"type":"response.output_text.delta","delta":"Café news: it rained."}`,
+		`data: {"type":"response.output_text.annotation.added","annotation_index":0,"annotation":{"type":"url_citation","url":"https://example.com/rain","title":"Rain","start_index":11,"end_index":20}}`,
+		`data: {"type":"response.output_text.annotation.added","annotation_index":1,"annotation":{"type":"file_citation","file_id":"file_1","filename":"notes.txt","index":20}}`,
+		`data: {"type":"response.completed","response":{"status":"completed"}}`,
+		"",
+	}, "\n")
+
+	stream := &ResponsesStream{ctx: context.Background(), model: "gpt-5", stream: strings.NewReader(sse)}
+	var citations []content.Citation
+	for status := range stream.Iter() {
+		if status == llms.StreamStatusCitation {
+			citations = append(citations, stream.Citation())
+		}
+	}
+	require.NoError(t, stream.Err())
+
+	// Indices count characters, so the "é" shifts the byte offsets by one.
+	require.Len(t, citations, 2)
+	assert.Equal(t, content.Citation{
+		Start:    12,
+		End:      21,
+		Source:   "web",
+		URL:      "https://example.com/rain",
+		Title:    "Rain",
+		Metadata: map[string]string{"openai:type": "url_citation"},
+	}, citations[0])
+	assert.Equal(t, "it rained", "Café news: it rained."[citations[0].Start:citations[0].End])
+	assert.Equal(t, "file", citations[1].Source)
+	assert.Equal(t, "file_1", citations[1].FileID)
+	assert.Equal(t, 21, citations[1].Start)
+
+	text := stream.Message().Content[0].(*content.Text)
+	assert.Equal(t, citations, text.Citations)
+}
+
 func TestResponsesStream_UsageWithCachedTokens(t *testing.T) {
 	sse := strings.Join([]string{
 		`data: {"type":"response.created"}`,
 		`data: {"type":"response.output_item.added","item":{"type":"message","role":"assistant"}}`,
 		`data: {"type":"response.content_part.added","part":{"type":"text","text":"Hello"},"item_id":"msg_1","content_index":0}`,
 		`data: {"type":"response.content_part.done","part":{"type":"text","text":"Hello"},"item_id":"msg_1","content_index":0}`,
+		`data: {"type":"response.output_item.done","item":{"type":"web_search_call","id":"ws_1","status":"completed","action":{"type":"search","query":"weather"}}}`,
+		`data: {"type":"response.output_item.done","item":{"type":"code_interpreter_call","id":"ci_1","status":"completed"}}`,
 		`data: {"type":"response.completed","response":{"usage":{"input_tokens":100,"output_tokens":50,"total_tokens":150,"input_tokens_details":{"cached_tokens":25},"output_tokens_details":{"reasoning_tokens":10}}}}`,
 		"",
 	}, "\n")
@@ -315,6 +369,12 @@ func TestResponsesStream_UsageWithCachedTokens(t *testing.T) {
 	if usage.CachedInputTokens != 25 {
 		t.Errorf("expected CachedInputTokens=25, got %d", usage.CachedInputTokens)
 	}
+	if usage.ReasoningTokens != 10 {
+		t.Errorf("expected ReasoningTokens=10, got %d", usage.ReasoningTokens)
+	}
+	if usage.WebSearchRequests != 1 || usage.CodeExecutionRequests != 1 {
+		t.Errorf("expected 1 web search and 1 code execution, got %d and %d", usage.WebSearchRequests, usage.CodeExecutionRequests)
+	}
 }
 
 func TestConvertMessageToInput_ForeignToolCallOmitsResponsesItemID(t *testing.T) {
@@ -781,3 +841,65 @@ func TestConvertMessageToInput_ToolErrorResult(t *testing.T) {
 		t.Fatalf("expected JSON error payload to pass through unchanged, got %q", out.Output)
 	}
 }
+
+func TestResponsesStream_StopReasons(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		events []string
+		want   llms.StopReason
+		err    error
+		text   string
+	}{
+		{
+			name:   "completed",
+			events: []string{`data: {"type":"response.completed","response":{}}`},
+			want:   llms.StopReasonEndTurn,
+		},
+		{
+			name: "refusal",
+			events: []string{
+				`data: {"type":"response.refusal.delta","delta":"I can't "}`,
+				`data: {"type":"response.refusal.delta","delta":"help with that."}`,
+				`data: {"type":"response.refusal.done","refusal":"I can't help with that."}`,
+				`data: {"type":"response.completed","response":{}}`,
+			},
+			want: llms.StopReasonRefusal,
+			text: "I can't help with that.",
+		},
+		{
+			name: "refusal without deltas",
+			events: []string{
+				`data: {"type":"response.refusal.done","refusal":"I can't help with that."}`,
+				`data: {"type":"response.completed","response":{}}`,
+			},
+			want: llms.StopReasonRefusal,
+			text: "I can't help with that.",
+		},
+		{
+			name:   "content filter",
+			events: []string{`data: {"type":"response.incomplete","response":{"incomplete_details":{"reason":"content_filter"}}}`},
+			want:   llms.StopReasonContentFilter,
+			err:    llms.ErrContentFiltered,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sse := strings.Join(append([]string{`data: {"type":"response.created"}`}, tc.events...), "\n") + "\n"
+			stream := &ResponsesStream{ctx: context.Background(), model: "gpt-4o", stream: strings.NewReader(sse)}
+			var streamed strings.Builder
+			for status := range stream.Iter() {
+				if status == llms.StreamStatusText {
+					streamed.WriteString(stream.Text())
+				}
+			}
+			if tc.err == nil {
+				require.NoError(t, stream.Err())
+			} else {
+				require.ErrorIs(t, stream.Err(), tc.err)
+			}
+			assert.Equal(t, tc.want, stream.StopReason())
+			text, _ := stream.Message().Content.AsString()
+			assert.Equal(t, tc.text, text)
+			assert.Equal(t, tc.text, streamed.String())
+		})
+	}
+}
@@ -66,6 +66,7 @@ type InputFile struct {
 	Type     string `json:"type"` // "input_file"
 	FileID   string `json:"file_id,omitempty"`
 	FileData string `json:"file_data,omitempty"`
+	FileURL  string `json:"file_url,omitempty"`
 	Filename string `json:"filename,omitempty"`
 }
 
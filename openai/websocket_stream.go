@@ -19,6 +19,8 @@ type WebSocketStream struct {
 	onDone                  func(responseID string)
 }
 
+var _ llms.StopReasoner = (*WebSocketStream)(nil)
+
 func newWebSocketStreamError(err error) *WebSocketStream {
 	return &WebSocketStream{
 		responsesEventProcessor: responsesEventProcessor{err: err},
@@ -63,14 +65,7 @@ func (s *WebSocketStream) Search() llms.SearchActivity {
 }
 
 func (s *WebSocketStream) Usage() llms.Usage {
-	if s.usage == nil {
-		return llms.Usage{}
-	}
-	return llms.Usage{
-		CachedInputTokens: s.usage.InputTokensDetails.CachedTokens,
-		InputTokens:       s.usage.InputTokens,
-		OutputTokens:      s.usage.OutputTokens,
-	}
+	return s.llmUsage()
 }
 
 func (s *WebSocketStream) Iter() func(yield func(llms.StreamStatus) bool) {
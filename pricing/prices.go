@@ -0,0 +1,88 @@
+package pricing
+
+import "github.com/flitsinc/go-llms/llms"
+
+// Anthropic charges a multiple of the input price for cache reads and writes,
+// with writes to the 1 hour cache costing more than to the 5 minute one.
+const (
+	anthropicCacheRead      = 0.1
+	anthropicCacheWrite     = 1.25
+	anthropicLongCacheWrite = 2
+)
+
+func anthropicPrice(input, output float64) llms.Price {
+	return llms.Price{
+		Input:                  input,
+		CachedInput:            input * anthropicCacheRead,
+		CacheCreationInput:     input * anthropicCacheWrite,
+		LongCacheCreationInput: input * anthropicLongCacheWrite,
+		Output:                 output,
+	}
+}
+
+// anthropicLongContextPrice is for models with a 1M token context window,
+// which cost more for prompts over 200K tokens.
+func anthropicLongContextPrice(input, output, longInput, longOutput float64) llms.Price {
+	price := anthropicPrice(input, output)
+	long := anthropicPrice(longInput, longOutput)
+	price.LongContextThreshold = 200_000
+	price.LongContext = &long
+	return price
+}
+
+// OpenAI and Google include cached tokens in the input tokens they report.
+func cachedInputPrice(input, cachedInput, output float64) llms.Price {
+	return llms.Price{
+		Input:               input,
+		CachedInput:         cachedInput,
+		Output:              output,
+		InputIncludesCached: true,
+	}
+}
+
+// geminiLongContextPrice is for Gemini models that cost more for prompts over
+// 200K tokens.
+func geminiLongContextPrice(input, cachedInput, output, longInput, longCachedInput, longOutput float64) llms.Price {
+	price := cachedInputPrice(input, cachedInput, output)
+	long := cachedInputPrice(longInput, longCachedInput, longOutput)
+	price.LongContextThreshold = 200_000
+	price.LongContext = &long
+	return price
+}
+
+// builtin holds the list prices in dollars per million tokens.
+var builtin = map[string]map[string]llms.Price{
+	"Anthropic": {
+		"claude-opus-4-6":   anthropicPrice(5, 25),
+		"claude-opus-4-5":   anthropicPrice(5, 25),
+		"claude-opus-4-1":   anthropicPrice(15, 75),
+		"claude-opus-4":     anthropicPrice(15, 75),
+		"claude-sonnet-4-6": anthropicLongContextPrice(3, 15, 6, 22.5),
+		"claude-sonnet-4-5": anthropicLongContextPrice(3, 15, 6, 22.5),
+		"claude-sonnet-4":   anthropicLongContextPrice(3, 15, 6, 22.5),
+		"claude-3-7-sonnet": anthropicPrice(3, 15),
+		"claude-haiku-4-5":  anthropicPrice(1, 5),
+		"claude-3-5-haiku":  anthropicPrice(0.8, 4),
+	},
+	"OpenAI": {
+		"gpt-5.1":      cachedInputPrice(1.25, 0.125, 10),
+		"gpt-5":        cachedInputPrice(1.25, 0.125, 10),
+		"gpt-5-mini":   cachedInputPrice(0.25, 0.025, 2),
+		"gpt-5-nano":   cachedInputPrice(0.05, 0.005, 0.4),
+		"gpt-4.1":      cachedInputPrice(2, 0.5, 8),
+		"gpt-4.1-mini": cachedInputPrice(0.4, 0.1, 1.6),
+		"gpt-4.1-nano": cachedInputPrice(0.1, 0.025, 0.4),
+		"gpt-4o":       cachedInputPrice(2.5, 1.25, 10),
+		"gpt-4o-mini":  cachedInputPrice(0.15, 0.075, 0.6),
+		"o3":           cachedInputPrice(2, 0.5, 8),
+		"o3-mini":      cachedInputPrice(1.1, 0.55, 4.4),
+		"o4-mini":      cachedInputPrice(1.1, 0.275, 4.4),
+	},
+	"Google": {
+		"gemini-3-pro-preview":  geminiLongContextPrice(2, 0.2, 12, 4, 0.4, 18),
+		"gemini-2.5-pro":        geminiLongContextPrice(1.25, 0.125, 10, 2.5, 0.25, 15),
+		"gemini-2.5-flash":      cachedInputPrice(0.3, 0.03, 2.5),
+		"gemini-2.5-flash-lite": cachedInputPrice(0.1, 0.01, 0.4),
+		"gemini-2.0-flash":      cachedInputPrice(0.1, 0.025, 0.4),
+	},
+}
@@ -0,0 +1,146 @@
+// Package pricing knows what common models cost, so that token usage can be
+// turned into money:
+//
+//	llm := llms.New(provider).WithPricing(pricing.NewDefault())
+//
+// The built-in prices are the providers' published list prices at the time of
+// writing. Prices change, and discounts such as batch pricing aren't included,
+// so override them with Set or LoadJSON where it matters.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/flitsinc/go-llms/llms"
+)
+
+// Registry is an llms.CostCalculator with prices keyed by the company and
+// model names that providers report through Company() and Model(). It is safe
+// for concurrent use.
+type Registry struct {
+	mu     sync.RWMutex
+	prices map[string]map[string]llms.Price
+}
+
+var _ llms.CostCalculator = (*Registry)(nil)
+
+// New returns an empty Registry.
+func New() *Registry {
+	return &Registry{prices: make(map[string]map[string]llms.Price)}
+}
+
+// NewDefault returns a Registry with the built-in prices.
+func NewDefault() *Registry {
+	r := New()
+	for company, models := range builtin {
+		for model, price := range models {
+			r.Set(company, model, price)
+		}
+	}
+	return r
+}
+
+var defaultRegistry = NewDefault()
+
+// Cost returns the cost in dollars of the usage of a single request, at the
+// built-in prices.
+func Cost(company, model string, usage llms.Usage) (float64, bool) {
+	return defaultRegistry.Cost(company, model, usage)
+}
+
+// Set sets the price of a model, replacing any price it had.
+func (r *Registry) Set(company, model string, price llms.Price) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	models, ok := r.prices[company]
+	if !ok {
+		models = make(map[string]llms.Price)
+		r.prices[company] = models
+	}
+	models[model] = price
+}
+
+// LoadJSON sets the prices in data, which maps company names to model names
+// to prices, in dollars per million tokens:
+//
+//	{"OpenAI": {"gpt-5": {"input": 1.25, "cached_input": 0.125, "output": 10, "input_includes_cached": true}}}
+//
+// Models that aren't in data keep their price.
+func (r *Registry) LoadJSON(data []byte) error {
+	var prices map[string]map[string]llms.Price
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return fmt.Errorf("decoding prices: %w", err)
+	}
+	for company, models := range prices {
+		for model, price := range models {
+			r.Set(company, model, price)
+		}
+	}
+	return nil
+}
+
+// Lookup returns the price of a model. A model without a price of its own
+// gets the price of the longest model name it extends with a dated or
+// versioned suffix, so "claude-sonnet-4-5-20250929" and
+// "claude-sonnet-4-5@20250929" are priced as "claude-sonnet-4-5". If the
+// company has no price for the model, other companies' prices for it are
+// used, since the same models are served by several clouds.
+func (r *Registry) Lookup(company, model string) (llms.Price, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if price, ok := lookupModel(r.prices[company], model); ok {
+		return price, true
+	}
+	companies := make([]string, 0, len(r.prices))
+	for c := range r.prices {
+		if c != company {
+			companies = append(companies, c)
+		}
+	}
+	sort.Strings(companies)
+	for _, c := range companies {
+		if price, ok := lookupModel(r.prices[c], model); ok {
+			return price, true
+		}
+	}
+	return llms.Price{}, false
+}
+
+// Cost returns the cost in dollars of the usage of a single request to the
+// model, or false if the model has no price.
+func (r *Registry) Cost(company, model string, usage llms.Usage) (float64, bool) {
+	price, ok := r.Lookup(company, model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(usage), true
+}
+
+// versionSuffix matches what a dated or versioned snapshot adds to the name
+// of its model. Other suffixes name different models ("gpt-5-pro", say), which
+// can cost much more.
+var versionSuffix = regexp.MustCompile(`^(-(\d{8}|\d{4}-\d{2}-\d{2}|\d{3}|latest)|@.+)$`)
+
+func lookupModel(models map[string]llms.Price, model string) (llms.Price, bool) {
+	if price, ok := models[model]; ok {
+		return price, true
+	}
+	var best string
+	for name := range models {
+		if len(name) <= len(best) || !strings.HasPrefix(model, name) {
+			continue
+		}
+		if versionSuffix.MatchString(model[len(name):]) {
+			best = name
+		}
+	}
+	if best == "" {
+		return llms.Price{}, false
+	}
+	return models[best], true
+}
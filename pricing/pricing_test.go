@@ -0,0 +1,105 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/llms"
+)
+
+func TestCost(t *testing.T) {
+	usage := llms.Usage{InputTokens: 100_000, OutputTokens: 10_000}
+	cost, ok := Cost("Anthropic", "claude-sonnet-4-5", usage)
+	require.True(t, ok)
+	assert.InDelta(t, 0.3+0.15, cost, 1e-9)
+
+	cost, ok = Cost("Anthropic", "claude-sonnet-4-5-20250929", usage)
+	require.True(t, ok, "Dated snapshots are priced as their model")
+	assert.InDelta(t, 0.45, cost, 1e-9)
+
+	cost, ok = Cost("Google", "claude-sonnet-4-5@20250929", usage)
+	require.True(t, ok, "Claude on Vertex AI is priced as on Anthropic")
+	assert.InDelta(t, 0.45, cost, 1e-9)
+
+	_, ok = Cost("Anthropic", "claude-sonnet", usage)
+	assert.False(t, ok)
+	_, ok = Cost("OpenAI", "unknown-model", usage)
+	assert.False(t, ok)
+}
+
+func TestCostLongestModelPrefix(t *testing.T) {
+	usage := llms.Usage{InputTokens: 1_000_000}
+	cost, ok := Cost("OpenAI", "gpt-5-mini-2025-08-07", usage)
+	require.True(t, ok)
+	assert.InDelta(t, 0.25, cost, 1e-9)
+}
+
+func TestCostOtherModelsArentPrefixMatches(t *testing.T) {
+	usage := llms.Usage{InputTokens: 1_000_000}
+	for _, model := range []string{"gpt-5-pro", "gpt-5-pro-2025-10-06", "o3-pro", "o3-deep-research", "gpt-4o-audio-preview"} {
+		_, ok := Cost("OpenAI", model, usage)
+		assert.False(t, ok, "%s isn't priced as a model it extends", model)
+	}
+	for _, model := range []string{"gpt-4o-2024-11-20", "o3-2025-04-16", "gpt-5-latest", "gemini-2.0-flash-001"} {
+		_, ok := Cost("", model, usage)
+		assert.True(t, ok, "%s is a snapshot of a priced model", model)
+	}
+}
+
+func TestCostAnthropicCache(t *testing.T) {
+	usage := llms.Usage{
+		InputTokens:                  1_000_000,
+		CachedInputTokens:            1_000_000,
+		CacheCreationInputTokens:     3_000_000,
+		LongCacheCreationInputTokens: 1_000_000,
+	}
+	cost, ok := Cost("Anthropic", "claude-haiku-4-5", usage)
+	require.True(t, ok)
+	// 1 input, 0.1 cache read, 2 * 1.25 short and 1 * 2 long cache writes.
+	assert.InDelta(t, 1+0.1+2.5+2, cost, 1e-9)
+}
+
+func TestCostOpenAICachedInput(t *testing.T) {
+	usage := llms.Usage{InputTokens: 1_000_000, CachedInputTokens: 400_000}
+	cost, ok := Cost("OpenAI", "gpt-4.1", usage)
+	require.True(t, ok)
+	assert.InDelta(t, 0.6*2+0.4*0.5, cost, 1e-9)
+}
+
+func TestCostGeminiLongContext(t *testing.T) {
+	short := llms.Usage{InputTokens: 200_000, OutputTokens: 1_000}
+	cost, ok := Cost("Google", "gemini-2.5-pro", short)
+	require.True(t, ok)
+	assert.InDelta(t, 0.2*1.25+0.001*10, cost, 1e-9)
+
+	long := llms.Usage{InputTokens: 200_001, OutputTokens: 1_000}
+	cost, ok = Cost("Google", "gemini-2.5-pro", long)
+	require.True(t, ok)
+	assert.InDelta(t, 0.200001*2.5+0.001*15, cost, 1e-9)
+}
+
+func TestRegistryOverrides(t *testing.T) {
+	r := NewDefault()
+	r.Set("OpenAI", "gpt-4.1", llms.Price{Input: 1, Output: 1})
+	require.NoError(t, r.LoadJSON([]byte(`{
+		"Acme": {"acme-1": {"input": 2, "output": 4}}
+	}`)))
+
+	usage := llms.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000}
+	cost, ok := r.Cost("OpenAI", "gpt-4.1", usage)
+	require.True(t, ok)
+	assert.InDelta(t, 2.0, cost, 1e-9)
+	cost, ok = r.Cost("Acme", "acme-1", usage)
+	require.True(t, ok)
+	assert.InDelta(t, 6.0, cost, 1e-9)
+	_, ok = r.Cost("Anthropic", "claude-opus-4-1", usage)
+	assert.True(t, ok, "Other built-in prices are kept")
+
+	cost, ok = Cost("OpenAI", "gpt-4.1", usage)
+	require.True(t, ok)
+	assert.InDelta(t, 10.0, cost, 1e-9, "Other registries are unaffected")
+
+	assert.Error(t, r.LoadJSON([]byte(`{"Acme": []}`)))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flitsinc/go-llms/anthropic"
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/openai"
+)
+
+// sseServer serves the given server-sent events for every request.
+func sseServer(t *testing.T, events ...string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			w.Write([]byte(event + "\n\n"))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestRefusalIsTheSameAcrossProviders checks that a refusal completes the chat
+// with StopReasonRefusal and the model's answer in the message content, no
+// matter which provider it came from.
+func TestRefusalIsTheSameAcrossProviders(t *testing.T) {
+	const refusal = "I can't help with that."
+	providers := map[string]func(t *testing.T) llms.Provider{
+		"Anthropic": func(t *testing.T) llms.Provider {
+			server := sseServer(t,
+				`data: {"type":"message_start","message":{"id":"msg_1","role":"assistant","content":[],"usage":{"input_tokens":1}}}`,
+				`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"I can't help with that."}}`,
+				`data: {"type":"content_block_stop","index":0}`,
+				`data: {"type":"message_delta","delta":{"stop_reason":"refusal"},"usage":{"output_tokens":6}}`,
+				`data: {"type":"message_stop"}`,
+			)
+			return anthropic.New("key", "claude-sonnet-4-5").WithEndpoint(server.URL, "Anthropic")
+		},
+		"OpenAI Chat Completions": func(t *testing.T) llms.Provider {
+			server := sseServer(t,
+				`data: {"id":"c","choices":[{"index":0,"delta":{"role":"assistant","refusal":"I can't "}}]}`,
+				`data: {"id":"c","choices":[{"index":0,"delta":{"refusal":"help with that."},"finish_reason":"stop"}]}`,
+				`data: [DONE]`,
+			)
+			return openai.NewChatCompletionsAPI("key", "gpt-4o").WithEndpoint(server.URL, "OpenAI")
+		},
+		"OpenAI Responses": func(t *testing.T) llms.Provider {
+			server := sseServer(t,
+				`data: {"type":"response.created","response":{"id":"resp_1"}}`,
+				`data: {"type":"response.refusal.delta","delta":"I can't "}`,
+				`data: {"type":"response.refusal.delta","delta":"help with that."}`,
+				`data: {"type":"response.refusal.done","refusal":"I can't help with that."}`,
+				`data: {"type":"response.completed","response":{"id":"resp_1"}}`,
+			)
+			return openai.NewResponsesAPI("key", "gpt-4o").WithEndpoint(server.URL, "OpenAI")
+		},
+	}
+	for name, newProvider := range providers {
+		t.Run(name, func(t *testing.T) {
+			llm := llms.New(newProvider(t))
+			var streamed strings.Builder
+			for update := range llm.Chat("How do I pick a lock?") {
+				if text, ok := update.(llms.TextUpdate); ok {
+					streamed.WriteString(text.Text)
+				}
+			}
+			require.NoError(t, llm.Err())
+
+			messages := llm.Messages()
+			require.Len(t, messages, 2)
+			assert.Equal(t, llms.StopReasonRefusal, messages[1].StopReason)
+			text, _ := messages[1].Content.AsString()
+			assert.Equal(t, refusal, text)
+			assert.Equal(t, refusal, streamed.String())
+
+			response, err := llms.New(newProvider(t)).Generate(context.Background(), content.FromText("How do I pick a lock?"))
+			require.NoError(t, err)
+			assert.Equal(t, llms.StopReasonRefusal, response.StopReason)
+		})
+	}
+}
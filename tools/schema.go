@@ -114,6 +114,24 @@ func generateSchema(name, description string, typ reflect.Type) FunctionSchema {
 	}
 }
 
+// SchemaFor returns the JSON schema for values of the given type, derived the
+// same way as the parameters of a Func tool: exported struct fields are
+// properties named by their json tag, required unless tagged omitempty, and
+// described by their description tag. It panics on types that JSON schema
+// can't describe, such as channels and functions.
+func SchemaFor(typ reflect.Type) ValueSchema {
+	return fieldTypeToJSONSchema(typ)
+}
+
+// Validate checks that data is JSON conforming to the schema.
+func Validate(schema ValueSchema, data json.RawMessage) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errors.New("invalid JSON format")
+	}
+	return validateField(schema, value)
+}
+
 // fieldTypeToJSONSchema maps Go data types to corresponding JSON Schema properties consistently
 func fieldTypeToJSONSchema(t reflect.Type) ValueSchema {
 	switch t.Kind() {
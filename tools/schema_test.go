@@ -523,3 +523,26 @@ func TestValidateJSON(t *testing.T) {
 		assert.Contains(t, err.Error(), "schema error: received an invalid object schema")
 	})
 }
+
+func TestSchemaForAndValidate(t *testing.T) {
+	type Answer struct {
+		City       string   `json:"city" description:"The city"`
+		Population int      `json:"population"`
+		Landmarks  []string `json:"landmarks,omitempty"`
+	}
+	schema := SchemaFor(reflect.TypeFor[Answer]())
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, []string{"city", "population"}, schema.Required)
+	city, ok := schema.Properties.Get("city")
+	require.True(t, ok)
+	assert.Equal(t, "The city", city.(ValueSchema).Description)
+
+	assert.NoError(t, Validate(schema, json.RawMessage(`{"city":"Paris","population":2100000}`)))
+	assert.ErrorContains(t, Validate(schema, json.RawMessage(`{"city":"Paris"}`)), `missing required field: "population"`)
+	assert.ErrorContains(t, Validate(schema, json.RawMessage(`{"city":"Paris","population":"many"}`)), "expected integer")
+	assert.ErrorContains(t, Validate(schema, json.RawMessage(`Paris`)), "invalid JSON format")
+
+	list := SchemaFor(reflect.TypeFor[[]int]())
+	assert.NoError(t, Validate(list, json.RawMessage(`[1, 2]`)))
+	assert.Error(t, Validate(list, json.RawMessage(`[1, "2"]`)))
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Option configures a tool created with Func, External or FuncGrammar.
+type Option func(*tool)
+
+// WithTimeout limits how long a single call of the tool may run. When the
+// timeout is exceeded, the tool's context is canceled and the model receives a
+// TimeoutError result instead. This overrides the Toolbox's Timeout.
+//
+// Tools implemented outside this package can support the same behavior by
+// providing a Timeout() time.Duration method.
+func WithTimeout(timeout time.Duration) Option {
+	return func(t *tool) {
+		t.timeout = timeout
+	}
+}
+
+// TimeoutError is the error carried by the result of a tool call that did not
+// finish within its timeout.
+type TimeoutError struct {
+	FuncName string
+	Timeout  time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("tool %q timed out after %s", e.FuncName, e.Timeout)
+}
+
+// PanicError is what a tool's panic is raised again as when the tool ran in a
+// goroutine of its own to enforce its timeout, so that the stack of the panic
+// isn't lost.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it's an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// deadlineRunner is the runner of a tool with a timeout. It's the caller's
+// runner with the context of the deadline, and drops status reports once the
+// result is no longer wanted.
+type deadlineRunner struct {
+	Runner
+	ctx context.Context
+
+	mu        sync.Mutex
+	abandoned bool
+}
+
+func (r *deadlineRunner) Context() context.Context {
+	return r.ctx
+}
+
+func (r *deadlineRunner) Report(status string) {
+	// The lock makes sure no report is in flight once Run has returned, since
+	// the function they're forwarded to may not be usable anymore.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.abandoned {
+		r.Runner.Report(status)
+	}
+}
+
+// runWithDeadline runs the tool in its own goroutine, with a context that
+// expires after timeout, and returns as soon as either the tool returns or
+// the context is done. A tool that ignores its context is left running, but
+// its status reports are dropped from then on.
+func runWithDeadline(r Runner, tool Tool, params json.RawMessage, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	runner := &deadlineRunner{Runner: r, ctx: ctx}
+
+	type outcome struct {
+		result Result
+		panic  *PanicError
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- outcome{panic: &PanicError{Value: rec, Stack: debug.Stack()}}
+			}
+		}()
+		done <- outcome{result: tool.Run(runner, params)}
+	}()
+
+	select {
+	case o := <-done:
+		if o.panic != nil {
+			// Let the panic reach the caller like it would without a timeout.
+			panic(o.panic)
+		}
+		return o.result
+	case <-ctx.Done():
+		runner.mu.Lock()
+		runner.abandoned = true
+		runner.mu.Unlock()
+		if r.Context().Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Error(&TimeoutError{FuncName: tool.FuncName(), Timeout: timeout})
+		}
+		return Error(fmt.Errorf("tool %q was canceled: %w", tool.FuncName(), context.Cause(r.Context())))
+	}
+}
@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sleepyTool sleeps for the given duration unless its context ends first,
+// optionally ignoring the context altogether.
+func sleepyTool(name string, sleep time.Duration, ignoreContext bool, opts ...Option) Tool {
+	return Func("Sleepy", "Sleeps", name, func(r Runner, params struct{}) Result {
+		r.Report("sleeping")
+		if ignoreContext {
+			time.Sleep(sleep)
+			return SuccessFromString("woke up")
+		}
+		select {
+		case <-time.After(sleep):
+			return SuccessFromString("woke up")
+		case <-r.Context().Done():
+			return Error(r.Context().Err())
+		}
+	}, opts...)
+}
+
+func TestToolbox_Run_ToolTimeout(t *testing.T) {
+	tb := Box(sleepyTool("sleepy", time.Second, false, WithTimeout(10*time.Millisecond)))
+
+	result := tb.Run(NopRunner, "sleepy", json.RawMessage(`{}`))
+
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, result.Error(), &timeoutErr)
+	assert.Equal(t, "sleepy", timeoutErr.FuncName)
+	assert.Equal(t, 10*time.Millisecond, timeoutErr.Timeout)
+}
+
+func TestToolbox_Run_DefaultTimeout(t *testing.T) {
+	tb := Box(
+		sleepyTool("default", time.Second, false),
+		sleepyTool("override", 50*time.Millisecond, false, WithTimeout(time.Second)),
+	)
+	tb.Timeout = 10 * time.Millisecond
+
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, tb.Run(NopRunner, "default", json.RawMessage(`{}`)).Error(), &timeoutErr)
+	assert.Equal(t, 10*time.Millisecond, timeoutErr.Timeout)
+
+	assert.NoError(t, tb.Run(NopRunner, "override", json.RawMessage(`{}`)).Error(), "The tool's own timeout wins")
+}
+
+func TestToolbox_Run_TimeoutAbandonsStubbornTool(t *testing.T) {
+	var reports atomic.Int32
+	tool := Func("Stubborn", "Ignores its context", "stubborn", func(r Runner, params struct{}) Result {
+		time.Sleep(50 * time.Millisecond)
+		r.Report("still here")
+		return SuccessFromString("done")
+	}, WithTimeout(5*time.Millisecond))
+	runner := NewRunner(context.Background(), nil, func(string) { reports.Add(1) })
+
+	start := time.Now()
+	result := Box(tool).Run(runner, "stubborn", json.RawMessage(`{}`))
+	assert.Less(t, time.Since(start), 40*time.Millisecond, "Run shouldn't wait for the tool")
+
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, result.Error(), &timeoutErr)
+
+	time.Sleep(80 * time.Millisecond)
+	assert.Equal(t, int32(0), reports.Load(), "Reports after the timeout should be dropped")
+}
+
+func TestToolbox_Run_Canceled(t *testing.T) {
+	errStop := errors.New("stop")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	runner := NewRunner(ctx, nil, func(string) {})
+	time.AfterFunc(10*time.Millisecond, func() { cancel(errStop) })
+
+	// Without a timeout, the tool runs on the caller's goroutine, and what it
+	// returns is kept, even if it ignored the cancellation.
+	result := Box(sleepyTool("sleepy", 50*time.Millisecond, true)).Run(runner, "sleepy", json.RawMessage(`{}`))
+	require.NoError(t, result.Error())
+	require.Error(t, ctx.Err())
+
+	// With one, a tool that ignores its context is abandoned.
+	ctx, cancel = context.WithCancelCause(context.Background())
+	runner = NewRunner(ctx, nil, func(string) {})
+	time.AfterFunc(10*time.Millisecond, func() { cancel(errStop) })
+	start := time.Now()
+	result = Box(sleepyTool("sleepy", time.Second, true, WithTimeout(time.Minute))).Run(runner, "sleepy", json.RawMessage(`{}`))
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "Run shouldn't wait for the tool")
+
+	require.ErrorIs(t, result.Error(), errStop)
+	var timeoutErr *TimeoutError
+	assert.False(t, errors.As(result.Error(), &timeoutErr))
+}
+
+// customRunner is a runner with behavior of its own.
+type customRunner struct {
+	Runner
+	reports []string
+}
+
+func (r *customRunner) Report(status string) {
+	r.reports = append(r.reports, "custom: "+status)
+}
+
+func TestToolbox_Run_KeepsRunner(t *testing.T) {
+	var got Runner
+	tool := Func("Spy", "Keeps its runner", "spy", func(r Runner, params struct{}) Result {
+		got = r
+		r.Report("hi")
+		return SuccessFromString("done")
+	})
+	runner := &customRunner{Runner: NopRunner}
+
+	// Without a timeout, the tool gets the caller's runner as is.
+	require.NoError(t, Box(tool).Run(runner, "spy", json.RawMessage(`{}`)).Error())
+	assert.Same(t, runner, got)
+
+	// With one, only its context is replaced.
+	tb := Box(tool)
+	tb.Timeout = time.Second
+	require.NoError(t, tb.Run(runner, "spy", json.RawMessage(`{}`)).Error())
+	assert.NotSame(t, runner, got)
+	assert.NotEqual(t, runner.Context(), got.Context())
+	assert.Equal(t, []string{"custom: hi", "custom: hi"}, runner.reports)
+}
+
+func TestToolbox_Run_ForwardsReportsAndPanics(t *testing.T) {
+	var reports atomic.Int32
+	runner := NewRunner(context.Background(), nil, func(string) { reports.Add(1) })
+	result := Box(sleepyTool("sleepy", time.Millisecond, false, WithTimeout(time.Second))).Run(runner, "sleepy", json.RawMessage(`{}`))
+	require.NoError(t, result.Error())
+	assert.Equal(t, int32(1), reports.Load())
+
+	panicky := Func("Panicky", "Panics", "panicky", func(r Runner, params struct{}) Result {
+		panic("boom")
+	}, WithTimeout(time.Second))
+	defer func() {
+		panicErr, ok := recover().(*PanicError)
+		require.True(t, ok)
+		assert.Equal(t, "boom", panicErr.Value)
+		assert.Contains(t, string(panicErr.Stack), "timeout_test.go", "The stack of the tool is kept")
+	}()
+	Box(panicky).Run(NopRunner, "panicky", json.RawMessage(`{}`))
+	t.Fatal("Run should have panicked")
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Tool interface {
@@ -24,7 +25,7 @@ type Tool interface {
 var jsonRawMessageType = reflect.TypeOf(json.RawMessage{})
 
 // Func returns a tool for a function implementation with the given name and description.
-func Func[Params any](label, description, funcName string, fn func(r Runner, params Params) Result) Tool {
+func Func[Params any](label, description, funcName string, fn func(r Runner, params Params) Result, opts ...Option) Tool {
 	var zeroParams Params
 	schemaType := reflect.TypeOf(zeroParams)
 	if schemaType.Kind() != reflect.Struct && schemaType != jsonRawMessageType {
@@ -51,13 +52,14 @@ func Func[Params any](label, description, funcName string, fn func(r Runner, par
 			return fn(r, p)
 		},
 	}
+	t.apply(opts)
 	return t
 }
 
 // External returns a tool where the schema is provided explicitly, and the
 // handler function receives raw JSON parameters. This is suitable for external
 // tools where schema generation via reflection is not possible or desired.
-func External(label string, schema *FunctionSchema, fn func(r Runner, params json.RawMessage) Result) Tool {
+func External(label string, schema *FunctionSchema, fn func(r Runner, params json.RawMessage) Result, opts ...Option) Tool {
 	if schema == nil {
 		panic("External requires a non-nil schema")
 	}
@@ -68,6 +70,7 @@ func External(label string, schema *FunctionSchema, fn func(r Runner, params jso
 		fn:          fn,                 // Handler directly accepts raw JSON
 		grammar:     NewJSONGrammarWithSchema(schema, true /*skipValidation*/),
 	}
+	t.apply(opts)
 	return t
 }
 
@@ -78,6 +81,15 @@ type tool struct {
 
 	// If non-nil, this is a grammar-based tool (custom tool for providers that support it).
 	grammar Grammar
+
+	// If positive, how long a single run of the tool may take.
+	timeout time.Duration
+}
+
+func (t *tool) apply(opts []Option) {
+	for _, opt := range opts {
+		opt(t)
+	}
 }
 
 func (t *tool) Label() string {
@@ -96,6 +108,8 @@ func (t *tool) Run(r Runner, params json.RawMessage) Result { return t.fn(r, par
 
 func (t *tool) Grammar() Grammar { return t.grammar }
 
+func (t *tool) Timeout() time.Duration { return t.timeout }
+
 // Grammar specifies input format for grammar-based tools.
 // Providers that support custom tools can expose these to the model.
 type Grammar interface{ isGrammar() }
@@ -191,7 +205,7 @@ func Regex(definition string) Grammar { return RegexGrammar{Definition: strings.
 // The input is derived from the provider's streaming arguments. If the raw
 // parameters are a JSON string, it's unmarshaled; otherwise, the raw bytes are
 // interpreted as a plain string.
-func FuncGrammar(grammar Grammar, label, description, funcName string, fn func(r Runner, input string) Result) Tool {
+func FuncGrammar(grammar Grammar, label, description, funcName string, fn func(r Runner, input string) Result, opts ...Option) Tool {
 	if grammar == nil {
 		panic("FuncGrammar requires a non-nil grammar (use tools.Text(), tools.Lark(), or tools.Regex())")
 	}
@@ -207,5 +221,6 @@ func FuncGrammar(grammar Grammar, label, description, funcName string, fn func(r
 		input := string(params)
 		return fn(r, input)
 	}
+	t.apply(opts)
 	return t
 }
@@ -3,6 +3,7 @@ package tools
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type Toolbox struct {
@@ -10,6 +11,9 @@ type Toolbox struct {
 	tools []Tool
 	// Choice controls tool selection policy for providers.
 	Choice Choice
+	// Timeout, if positive, limits how long a single tool call may run. Tools
+	// created with their own WithTimeout option use that instead.
+	Timeout time.Duration
 }
 
 // Box returns a new Toolbox containing the given tools.
@@ -58,10 +62,25 @@ func (t *Toolbox) Get(funcName string) Tool {
 }
 
 // Run runs the tool with the given name and parameters, which should be provided as a JSON string.
+//
+// A tool with a timeout (see WithTimeout and Toolbox.Timeout) runs with a
+// context that expires after it. If that context is done before the tool
+// returns, Run stops waiting for it and returns a TimeoutError result, or an
+// error wrapping the context's cause if the runner's own context was canceled.
+// Tools should still stop working when their context is done, since Run can't
+// stop them. A tool without a timeout runs on the caller's goroutine, and its
+// result is returned as is.
 func (t *Toolbox) Run(r Runner, funcName string, params json.RawMessage) Result {
 	tool := t.Get(funcName)
 	if tool == nil {
 		return Error(&NotFoundError{FuncName: funcName})
 	}
+	timeout := t.Timeout
+	if timed, ok := tool.(interface{ Timeout() time.Duration }); ok && timed.Timeout() > 0 {
+		timeout = timed.Timeout()
+	}
+	if timeout > 0 {
+		return runWithDeadline(r, tool, params, timeout)
+	}
 	return tool.Run(r, params)
 }